@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -9,6 +10,7 @@ import (
 	"github.com/chzyer/readline"
 
 	"github.com/leonardinius/goloxvm/internal/vm"
+	"github.com/leonardinius/goloxvm/internal/vm/vmstd"
 )
 
 // Main is main entry point for the GoLox-VM
@@ -17,22 +19,34 @@ import (
 func Main(args ...string) int {
 	vm.InitVM()
 	defer vm.FreeVM()
+	vm.GlobalVM.Sandbox = vm.LoadSandboxConfigFromEnv()
 
 	var err error
-	if len(args) == 0 {
+	if vm.IsSpawnedVM() {
+		err = vm.RunSpawned()
+	} else if len(args) == 0 {
 		fmt.Println("Welcome to the GoLox-VM REPL!")
 		err = repl("repl")
-	} else if len(args) == 1 {
-		err = runFile(args[0])
-	} else {
-		fmt.Printf("Usage: %s [path]\n", filepath.Base(os.Args[0]))
+	} else if args[0] == "-h" || args[0] == "--help" || (args[0] == "check" && len(args) != 2) {
+		fmt.Printf("Usage: %s [path [args...]]\n", filepath.Base(os.Args[0]))
+		fmt.Printf("       %s check path\n", filepath.Base(os.Args[0]))
 		return 64
+	} else if args[0] == "check" {
+		err = checkFile(args[1])
+	} else {
+		vm.DefineArgs(args[1:])
+		err = runFile(args[0])
 	}
 
 	if err == nil {
 		return 0
 	}
 
+	var exitErr *vmstd.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+
 	// interpreter reports errors to stderr
 	switch err {
 	case vm.InterpretRuntimeError:
@@ -58,8 +72,11 @@ func repl(welcome string) error {
 			return err
 		}
 
+		var exitErr *vmstd.ExitError
 		if value, err := vm.Interpret(line); err == nil {
 			vm.PrintlnValue(value)
+		} else if errors.As(err, &exitErr) {
+			return err
 		}
 		// else {
 		// Do nothing
@@ -77,6 +94,15 @@ func runFile(script string) error {
 	return err
 }
 
+// checkFile reports the syntax and the type errors of the script without running it.
+func checkFile(script string) error {
+	data, err := os.ReadFile(script) //nolint:gosec
+	if err == nil {
+		err = vm.Check(data)
+	}
+	return err
+}
+
 func ioClose(c io.Closer) {
 	if err := c.Close(); err != nil {
 		fmt.Fprintf(os.Stderr, "[WARN ] close: %s\n", err)
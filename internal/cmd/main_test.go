@@ -0,0 +1,83 @@
+package cmd_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/leonardinius/goloxvm/internal/cmd"
+	"github.com/leonardinius/goloxvm/internal/vm"
+)
+
+// TestMain runs the spawned VM when the test binary is started by `spawn`, as the interpreter does.
+func TestMain(m *testing.M) {
+	if vm.IsSpawnedVM() {
+		os.Exit(cmd.Main())
+	}
+	os.Exit(m.Run())
+}
+
+func writeScript(t *testing.T, source string) string {
+	t.Helper()
+	script := filepath.Join(t.TempDir(), "script.lox")
+	require.NoError(t, os.WriteFile(script, []byte(source), 0o600))
+	return script
+}
+
+func TestMainArgs(t *testing.T) {
+	script := writeScript(t, `
+if (len(args) != 2) exit(1);
+if (args[0] != "first") exit(2);
+if (args[1] != "second") exit(3);
+exit(42);
+`)
+
+	assert.Equal(t, 42, cmd.Main(script, "first", "second"))
+}
+
+func TestMainSandbox(t *testing.T) {
+	script := writeScript(t, `exit(3);`)
+
+	t.Setenv("GLOX_SANDBOX", "")
+	assert.Equal(t, 3, cmd.Main(script))
+
+	t.Setenv("GLOX_SANDBOX", "env,exec")
+	assert.Equal(t, 3, cmd.Main(script))
+
+	for _, sandbox := range []string{"exit", "all"} {
+		t.Setenv("GLOX_SANDBOX", sandbox)
+		assert.Equal(t, 70, cmd.Main(script), sandbox)
+	}
+
+	t.Setenv("GLOX_SANDBOX", "exec")
+	assert.Equal(t, 70, cmd.Main(writeScript(t, `exec("echo", []);`)))
+
+	t.Setenv("GLOX_SANDBOX", "env")
+	assert.Equal(t, 70, cmd.Main(writeScript(t, `getenv("HOME");`)))
+	assert.Equal(t, 70, cmd.Main(writeScript(t, `setenv("HOME", nil);`)))
+}
+
+func TestMainCheck(t *testing.T) {
+	assert.Equal(t, 0, cmd.Main("check", writeScript(t, `
+fun add(a: Number, b: Number): Number { return a + b; }
+var sum: Number = add(1, 2);
+exit(1);
+`)))
+	assert.Equal(t, 65, cmd.Main("check", writeScript(t, `var name: String = 1;`)))
+	assert.Equal(t, 65, cmd.Main("check", writeScript(t, `var name: = 1;`)))
+	assert.Equal(t, 64, cmd.Main("check"))
+}
+
+func TestMainSpawn(t *testing.T) {
+	// the test binary runs the spawned VM from TestMain, the profiler settings are not passed to it
+	t.Setenv("GLOX_PPROF", "off")
+	script := writeScript(t, `
+fun worker(n) { return getenv("GLOX_PPROF") == nil and n * 2; }
+spawn(worker, 21).then(fun(result) { exit(result); });
+`)
+
+	assert.Equal(t, 42, cmd.Main(script))
+}
@@ -11,11 +11,14 @@ const (
 	OpTrue
 	OpFalse
 	OpPop
+	OpDup
+	OpDupUnder
 	OpGetLocal
 	OpSetLocal
 	OpGetUpvalue
 	OpSetUpvalue
 	OpDefineGlobal
+	OpDefineConst
 	OpGetGlobal
 	OpSetGlobal
 	OpEqual
@@ -25,11 +28,23 @@ const (
 	OpSubtract
 	OpMultiply
 	OpDivide
+	OpModulo
+	OpIncrement
+	OpDecrement
+	OpBitAnd
+	OpBitOr
+	OpBitXor
+	OpBitNot
+	OpShiftLeft
+	OpShiftRight
 	OpNot
 	OpNegate
 	OpPrint
 	OpJump
 	OpJumpIfFalse
+	OpJumpIfArgPassed
+	OpJumpIfNil
+	OpJumpIfNotNil
 	OpLoop
 	OpCall
 	OpClosure
@@ -38,51 +53,112 @@ const (
 	OpSetProperty
 	OpGetProperty
 	OpMethod
+	OpAbstractMethod
+	OpStaticMethod
+	OpStaticField
+	OpGetter
+	OpSetter
 	OpInvoke
 	OpSuperInvoke
 	OpInherit
+	OpTrait
+	OpAbstractClass
+	OpMixin
+	OpEndClass
+	OpEnum
+	OpEnumMember
+	OpIs
 	OpGetSuper
+	OpList
+	OpMap
+	OpGetIndex
+	OpSetIndex
+	OpUnpackList
+	OpUnpackField
+	OpMatchList
+	OpListRest
+	OpIterator
+	OpYield
+	OpAwait
 	OpReturn
 )
 
 var gOpCodeStrings = map[OpCode]string{
-	OpConstant:     "OP_CONSTANT",
-	OpNil:          "OP_NIL",
-	OpTrue:         "OP_TRUE",
-	OpFalse:        "OP_FALSE",
-	OpEqual:        "OP_EQUAL",
-	OpGreater:      "OP_GREATER",
-	OpLess:         "OP_LESS",
-	OpPop:          "OP_POP",
-	OpGetLocal:     "OP_GET_LOCAL",
-	OpSetLocal:     "OP_SET_LOCAL",
-	OpGetUpvalue:   "OP_GET_UPVALUE",
-	OpSetUpvalue:   "OP_SET_UPVALUE",
-	OpGetGlobal:    "OP_GET_GLOBAL",
-	OpSetGlobal:    "OP_SET_GLOBAL",
-	OpDefineGlobal: "OP_DEFINE_GLOBAL",
-	OpAdd:          "OP_ADD",
-	OpSubtract:     "OP_SUBTRACT",
-	OpMultiply:     "OP_MULTIPLY",
-	OpDivide:       "OP_DIVIDE",
-	OpNot:          "OP_NOT",
-	OpNegate:       "OP_NEGATE",
-	OpPrint:        "OP_PRINT",
-	OpJump:         "OP_JUMP",
-	OpJumpIfFalse:  "OP_JUMP_IF_FALSE",
-	OpLoop:         "OP_LOOP",
-	OpCall:         "OP_CALL",
-	OpClosure:      "OP_CLOSURE",
-	OpCloseUpvalue: "OP_CLOSE_UPVALUE",
-	OpClass:        "OP_CLASS",
-	OpReturn:       "OP_RETURN",
-	OpSetProperty:  "OP_SET_PROPERTY",
-	OpGetProperty:  "OP_GET_PROPERTY",
-	OpMethod:       "OP_METHOD",
-	OpInvoke:       "OP_INVOKE",
-	OpSuperInvoke:  "OP_SUPER_INVOKE",
-	OpInherit:      "OP_INHERIT",
-	OpGetSuper:     "OP_GET_SUPER",
+	OpConstant:        "OP_CONSTANT",
+	OpNil:             "OP_NIL",
+	OpTrue:            "OP_TRUE",
+	OpFalse:           "OP_FALSE",
+	OpEqual:           "OP_EQUAL",
+	OpGreater:         "OP_GREATER",
+	OpLess:            "OP_LESS",
+	OpPop:             "OP_POP",
+	OpDup:             "OP_DUP",
+	OpDupUnder:        "OP_DUP_UNDER",
+	OpGetLocal:        "OP_GET_LOCAL",
+	OpSetLocal:        "OP_SET_LOCAL",
+	OpGetUpvalue:      "OP_GET_UPVALUE",
+	OpSetUpvalue:      "OP_SET_UPVALUE",
+	OpGetGlobal:       "OP_GET_GLOBAL",
+	OpSetGlobal:       "OP_SET_GLOBAL",
+	OpDefineGlobal:    "OP_DEFINE_GLOBAL",
+	OpDefineConst:     "OP_DEFINE_CONST",
+	OpAdd:             "OP_ADD",
+	OpSubtract:        "OP_SUBTRACT",
+	OpMultiply:        "OP_MULTIPLY",
+	OpDivide:          "OP_DIVIDE",
+	OpModulo:          "OP_MODULO",
+	OpIncrement:       "OP_INCREMENT",
+	OpDecrement:       "OP_DECREMENT",
+	OpBitAnd:          "OP_BIT_AND",
+	OpBitOr:           "OP_BIT_OR",
+	OpBitXor:          "OP_BIT_XOR",
+	OpBitNot:          "OP_BIT_NOT",
+	OpShiftLeft:       "OP_SHIFT_LEFT",
+	OpShiftRight:      "OP_SHIFT_RIGHT",
+	OpNot:             "OP_NOT",
+	OpNegate:          "OP_NEGATE",
+	OpPrint:           "OP_PRINT",
+	OpJump:            "OP_JUMP",
+	OpJumpIfFalse:     "OP_JUMP_IF_FALSE",
+	OpJumpIfArgPassed: "OP_JUMP_IF_ARG_PASSED",
+	OpJumpIfNil:       "OP_JUMP_IF_NIL",
+	OpJumpIfNotNil:    "OP_JUMP_IF_NOT_NIL",
+	OpLoop:            "OP_LOOP",
+	OpCall:            "OP_CALL",
+	OpClosure:         "OP_CLOSURE",
+	OpCloseUpvalue:    "OP_CLOSE_UPVALUE",
+	OpClass:           "OP_CLASS",
+	OpReturn:          "OP_RETURN",
+	OpSetProperty:     "OP_SET_PROPERTY",
+	OpGetProperty:     "OP_GET_PROPERTY",
+	OpMethod:          "OP_METHOD",
+	OpAbstractMethod:  "OP_ABSTRACT_METHOD",
+	OpStaticMethod:    "OP_STATIC_METHOD",
+	OpStaticField:     "OP_STATIC_FIELD",
+	OpGetter:          "OP_GETTER",
+	OpSetter:          "OP_SETTER",
+	OpInvoke:          "OP_INVOKE",
+	OpSuperInvoke:     "OP_SUPER_INVOKE",
+	OpInherit:         "OP_INHERIT",
+	OpTrait:           "OP_TRAIT",
+	OpAbstractClass:   "OP_ABSTRACT_CLASS",
+	OpMixin:           "OP_MIXIN",
+	OpEndClass:        "OP_END_CLASS",
+	OpEnum:            "OP_ENUM",
+	OpEnumMember:      "OP_ENUM_MEMBER",
+	OpIs:              "OP_IS",
+	OpGetSuper:        "OP_GET_SUPER",
+	OpList:            "OP_LIST",
+	OpMap:             "OP_MAP",
+	OpGetIndex:        "OP_GET_INDEX",
+	OpSetIndex:        "OP_SET_INDEX",
+	OpUnpackList:      "OP_UNPACK_LIST",
+	OpUnpackField:     "OP_UNPACK_FIELD",
+	OpMatchList:       "OP_MATCH_LIST",
+	OpListRest:        "OP_LIST_REST",
+	OpIterator:        "OP_ITERATOR",
+	OpYield:           "OP_YIELD",
+	OpAwait:           "OP_AWAIT",
 }
 
 func (op OpCode) String() string {
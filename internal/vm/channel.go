@@ -0,0 +1,329 @@
+package vm
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/leonardinius/goloxvm/internal/vm/vmvalue"
+)
+
+var (
+	errChannelCapacity      = errors.New("Channel.new: capacity must be a non-negative integer")
+	errChannelClosed        = errors.New("channel is closed")
+	errChannelAlreadyClosed = errors.New("channel is already closed")
+	errChannelUnknown       = errors.New("unknown channel")
+	errChannelNoSender      = errors.New("nothing can send to the channel anymore")
+	errChannelNoReceiver    = errors.New("nothing can receive from the channel anymore")
+)
+
+// channelBackend carries the messages of the channels. The root VM owns the channels,
+// the spawned VMs forward the channel operations to their parent VM.
+// The operations are started in order and call done once complete, which may be right away
+// or later from another goroutine.
+type channelBackend interface {
+	newChannel(capacity int) (int64, error)
+	send(id int64, message Message, done func(err error))
+	// receive completes with ok false once the channel is closed and drained
+	receive(id int64, done func(message Message, ok bool, err error))
+	close(id int64) error
+	// trackSpawned counts the VMs spawned by this VM, which can exchange the messages with it
+	trackSpawned(delta int)
+	// idle is called once the VM has nothing to do but to wait for its channel operations
+	idle()
+}
+
+// channelHub is the channel backend of the root VM, it is used by the relay goroutines too.
+// Once no spawned VM is running and the root VM is idle, the waiting operations fail,
+// as nothing else can ever complete them.
+type channelHub struct {
+	mu       sync.Mutex
+	channels map[int64]*hubChannel
+	lastID   int64
+	running  int
+}
+
+type hubChannel struct {
+	capacity  int
+	buffer    []Message
+	senders   []hubSender // wait for a receiver or for room in the buffer
+	receivers []hubReceiver
+	closed    bool
+}
+
+type hubSender struct {
+	message Message
+	done    func(err error)
+}
+
+type hubReceiver func(message Message, ok bool, err error)
+
+var _ channelBackend = (*channelHub)(nil)
+
+func (h *channelHub) newChannel(capacity int) (int64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.channels == nil {
+		h.channels = make(map[int64]*hubChannel)
+	}
+	h.lastID++
+	h.channels[h.lastID] = &hubChannel{capacity: capacity}
+	return h.lastID, nil
+}
+
+// send and receive complete the operations once the hub is unlocked, the callbacks may take locks of their own.
+func (h *channelHub) send(id int64, message Message, done func(err error)) {
+	h.mu.Lock()
+	complete := h.trySend(id, message, done)
+	h.mu.Unlock()
+	complete()
+}
+
+func (h *channelHub) trySend(id int64, message Message, done func(err error)) (complete func()) {
+	c, found := h.channels[id]
+	switch {
+	case !found:
+		return func() { done(errChannelUnknown) }
+	case c.closed:
+		return func() { done(errChannelClosed) }
+	case len(c.receivers) > 0:
+		receiver := c.receivers[0]
+		c.receivers = c.receivers[1:]
+		return func() {
+			receiver(message, true, nil)
+			done(nil)
+		}
+	case len(c.buffer) < c.capacity:
+		c.buffer = append(c.buffer, message)
+		return func() { done(nil) }
+	default:
+		c.senders = append(c.senders, hubSender{message: message, done: done})
+		return func() {}
+	}
+}
+
+func (h *channelHub) receive(id int64, done func(message Message, ok bool, err error)) {
+	h.mu.Lock()
+	complete := h.tryReceive(id, done)
+	h.mu.Unlock()
+	complete()
+}
+
+func (h *channelHub) tryReceive(id int64, done func(message Message, ok bool, err error)) (complete func()) {
+	c, found := h.channels[id]
+	switch {
+	case !found:
+		return func() { done(Message{}, false, errChannelUnknown) }
+	case len(c.buffer) > 0:
+		message := c.buffer[0]
+		c.buffer = c.buffer[1:]
+		if len(c.senders) == 0 {
+			return func() { done(message, true, nil) }
+		}
+		// the first waiting sender gets the room in the buffer
+		sender := c.senders[0]
+		c.senders = c.senders[1:]
+		c.buffer = append(c.buffer, sender.message)
+		return func() {
+			sender.done(nil)
+			done(message, true, nil)
+		}
+	case len(c.senders) > 0:
+		sender := c.senders[0]
+		c.senders = c.senders[1:]
+		return func() {
+			sender.done(nil)
+			done(sender.message, true, nil)
+		}
+	case c.closed:
+		// the messages sent before close have been delivered
+		return func() { done(Message{}, false, nil) }
+	default:
+		c.receivers = append(c.receivers, done)
+		return func() {}
+	}
+}
+
+// close fails the waiting senders, the waiting receivers get nil as the buffer is empty then.
+func (h *channelHub) close(id int64) error {
+	h.mu.Lock()
+	c, found := h.channels[id]
+	if !found {
+		h.mu.Unlock()
+		return errChannelUnknown
+	}
+	if c.closed {
+		h.mu.Unlock()
+		return errChannelAlreadyClosed
+	}
+	c.closed = true
+	senders, receivers := c.senders, c.receivers
+	c.senders, c.receivers = nil, nil
+	h.mu.Unlock()
+
+	for _, sender := range senders {
+		sender.done(errChannelClosed)
+	}
+	for _, receiver := range receivers {
+		receiver(Message{}, false, nil)
+	}
+	return nil
+}
+
+func (h *channelHub) trackSpawned(delta int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.running += delta
+}
+
+// idle fails the waiting operations unless a spawned VM is still running.
+func (h *channelHub) idle() {
+	h.mu.Lock()
+	if h.running > 0 {
+		h.mu.Unlock()
+		return
+	}
+	var senders []hubSender
+	var receivers []hubReceiver
+	// in the order the channels were created, so the failures are reported the same way every run
+	for _, id := range slices.Sorted(maps.Keys(h.channels)) {
+		c := h.channels[id]
+		senders = append(senders, c.senders...)
+		receivers = append(receivers, c.receivers...)
+		c.senders, c.receivers = nil, nil
+	}
+	h.mu.Unlock()
+
+	for _, sender := range senders {
+		sender.done(errChannelNoReceiver)
+	}
+	for _, receiver := range receivers {
+		receiver(Message{}, false, errChannelNoSender)
+	}
+}
+
+// channels returns the channel backend of the VM, the root VM creates its hub on first use.
+func channels() channelBackend {
+	if GlobalVM.Channels == nil {
+		GlobalVM.Channels = &channelHub{}
+	}
+	return GlobalVM.Channels
+}
+
+// defineChannelClass defines `Channel` class with `new(capacity)` static native,
+// the channel is unbuffered unless the capacity is given.
+func defineChannelClass() {
+	klass := defineNativeClass("Channel")
+	defineStaticNative(klass, "new", 1, func(args ...vmvalue.Value) (vmvalue.Value, error) {
+		capacity := vmvalue.IntAsValue(0)
+		if !vmvalue.IsNil(args[0]) {
+			capacity = args[0]
+		}
+		if !vmvalue.IsInt(capacity) || vmvalue.ValueAsInt(capacity) < 0 {
+			return vmvalue.NilValue, errChannelCapacity
+		}
+		id, err := channels().newChannel(int(vmvalue.ValueAsInt(capacity)))
+		if err != nil {
+			return vmvalue.NilValue, err
+		}
+		return vmvalue.ObjAsValue(vmvalue.NewChannel(id)), nil
+	}).MinArity = 0
+}
+
+// invokeChannel calls `send(value)`, `receive()` or `close()` method of the channel.
+// The values are copied, `send` and `receive` return the promises settled by the event loop,
+// `receive()` fulfills with nil once the channel is closed and drained.
+func invokeChannel(channel *vmvalue.ObjChannel, name *vmvalue.ObjString, argCount byte) (ok bool) {
+	var arity byte
+	switch name {
+	case GlobalVM.SendString:
+		arity = 1
+	case GlobalVM.ReceiveString, GlobalVM.CloseString:
+		arity = 0
+	default:
+		return runtimeError("Undefined property '%s'.", vmvalue.PropertyName(name))
+	}
+	if argCount != arity {
+		return runtimeError("Expected %d arguments but got %d.", arity, argCount)
+	}
+
+	result := vmvalue.NilValue
+	switch name {
+	case GlobalVM.SendString:
+		message, err := encodeMessage(Peek(0))
+		if err != nil {
+			return runtimeError("Channel.send: %s", err)
+		}
+		op, promise := startChannelOp("Channel.send")
+		result = vmvalue.ObjAsValue(promise)
+		channels().send(channel.ID, message, op.sent)
+	case GlobalVM.ReceiveString:
+		op, promise := startChannelOp("Channel.receive")
+		result = vmvalue.ObjAsValue(promise)
+		channels().receive(channel.ID, op.received)
+	case GlobalVM.CloseString:
+		if err := channels().close(channel.ID); err != nil {
+			return runtimeError("Channel.close: %s", err)
+		}
+	}
+
+	GlobalVM.StackTop -= int(argCount)
+	SetStackAt(GlobalVM.StackTop-1, result)
+	return true
+}
+
+// channelOp is the send or receive in progress, the event loop settles its promise once it completes.
+type channelOp struct {
+	name        string
+	site        string // the stack frame which has started the operation
+	completions *completionQueue
+
+	message Message
+	ok      bool // false once the channel is closed and drained
+	err     error
+}
+
+// startChannelOp returns the operation and its promise, which is kept by the event loop until settled.
+func startChannelOp(name string) (*channelOp, *vmvalue.ObjPromise) {
+	loop := &GlobalVM.Loop
+	if loop.operations == nil {
+		loop.operations = make(map[*channelOp]*vmvalue.ObjPromise)
+	}
+	op := &channelOp{name: name, site: currentSite(), completions: loop.completionQueue()}
+	promise := vmvalue.NewPromise()
+	loop.operations[op] = promise
+	return op, promise
+}
+
+func (op *channelOp) sent(err error) {
+	op.err = err
+	op.completions.deliver(op)
+}
+
+func (op *channelOp) received(message Message, ok bool, err error) {
+	op.message, op.ok, op.err = message, ok, err
+	op.completions.deliver(op)
+}
+
+func (op *channelOp) settle() error {
+	loop := &GlobalVM.Loop
+	promise, found := loop.operations[op]
+	if !found {
+		// the script has failed meanwhile
+		return nil
+	}
+	// the promise stays reachable until settled, the message is decoded into the heap
+	if op.err != nil {
+		reason := vmvalue.StringInternCopy([]byte(op.name + ": " + op.err.Error()))
+		settlePromiseAt(promise, vmvalue.PromiseRejected, vmvalue.ObjAsValue(reason), op.site)
+	} else {
+		value := vmvalue.NilValue
+		if op.ok {
+			value = decodeMessage(&op.message)
+		}
+		settlePromise(promise, vmvalue.PromiseFulfilled, value)
+	}
+	delete(loop.operations, op)
+	return nil
+}
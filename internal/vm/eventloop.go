@@ -0,0 +1,494 @@
+package vm
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/leonardinius/goloxvm/internal/vm/vmvalue"
+)
+
+var (
+	errTimerCallback = errors.New("setTimeout: callback must be a function")
+	errTimerDelay    = errors.New("setTimeout: delay must be a non-negative number")
+	errTimerID       = errors.New("clearTimeout: argument must be a timer id")
+)
+
+// unhandledRejectionMessage is reported for the rejected promises nobody has handled.
+const unhandledRejectionMessage = "Unhandled promise rejection: %s"
+
+// EventLoop is the single-threaded loop owned by the VM. Microtasks run the promise reactions
+// as soon as the running code returns to the loop, timers run their callbacks once due.
+type EventLoop struct {
+	// queued microtasks are kept until they have run, so the GC marks the running one too
+	microtasks []microtask
+	head       int
+
+	timers  timerQueue
+	active  map[int64]*timer
+	timerID int64
+	seq     uint64
+
+	// the promises of the running spawned VMs and of the channel operations in progress,
+	// which complete on the other goroutines
+	spawned     map[*spawnedVM]*vmvalue.ObjPromise
+	operations  map[*channelOp]*vmvalue.ObjPromise
+	completions *completionQueue
+
+	// the promises rejected before any reaction was added, reported once the loop drains
+	rejected []rejection
+}
+
+type rejection struct {
+	Promise *vmvalue.ObjPromise
+	Site    string // the stack frame which has rejected the promise, empty for the event loop
+}
+
+// completion is the result of the work done on another goroutine, the event loop settles it.
+type completion interface {
+	settle() error
+}
+
+// completionQueue passes the completions of the other goroutines to the event loop.
+type completionQueue struct {
+	mu    sync.Mutex
+	items []completion
+	ready chan struct{} // signalled once an item is added
+}
+
+func (q *completionQueue) deliver(c completion) {
+	q.mu.Lock()
+	q.items = append(q.items, c)
+	q.mu.Unlock()
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (q *completionQueue) take() []completion {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	items := q.items
+	q.items = nil
+	return items
+}
+
+func (loop *EventLoop) completionQueue() *completionQueue {
+	if loop.completions == nil {
+		loop.completions = &completionQueue{ready: make(chan struct{}, 1)}
+	}
+	return loop.completions
+}
+
+type microtask struct {
+	Reaction vmvalue.PromiseReaction
+	State    vmvalue.PromiseState
+	Value    vmvalue.Value
+}
+
+type timer struct {
+	ID       int64
+	Due      time.Time
+	Interval time.Duration // zero for setTimeout and sleep
+	Callback vmvalue.Value
+	Promise  *vmvalue.ObjPromise // resolved by sleep
+
+	seq   uint64
+	index int
+}
+
+// timerQueue is the min-heap of timers ordered by due time, then by scheduling order.
+type timerQueue []*timer
+
+var _ heap.Interface = (*timerQueue)(nil)
+
+func (q timerQueue) Len() int { return len(q) }
+
+func (q timerQueue) Less(i, j int) bool {
+	if q[i].Due.Equal(q[j].Due) {
+		return q[i].seq < q[j].seq
+	}
+	return q[i].Due.Before(q[j].Due)
+}
+
+func (q timerQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *timerQueue) Push(x any) {
+	t := x.(*timer) //nolint:forcetypeassert // only timers are queued
+	t.index = len(*q)
+	*q = append(*q, t)
+}
+
+func (q *timerQueue) Pop() any {
+	old := *q
+	n := len(old)
+	t := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	t.index = -1
+	return t
+}
+
+func defineTimerNatives() {
+	defineNative2("setTimeout", func(callback, delay vmvalue.Value) (vmvalue.Value, error) {
+		return scheduleTimer(callback, delay, false)
+	})
+	defineNative2("setInterval", func(callback, delay vmvalue.Value) (vmvalue.Value, error) {
+		return scheduleTimer(callback, delay, true)
+	})
+	defineNative1("clearTimeout", clearTimer)
+	defineNative1("clearInterval", clearTimer)
+	defineNative1("sleep", func(delay vmvalue.Value) (vmvalue.Value, error) {
+		duration, err := timerDelay(delay)
+		if err != nil {
+			return vmvalue.NilValue, err
+		}
+		promise := vmvalue.NewPromise()
+		addTimer(&timer{Due: time.Now().Add(duration), Callback: vmvalue.NilValue, Promise: promise})
+		return vmvalue.ObjAsValue(promise), nil
+	})
+}
+
+// scheduleTimer adds the timer which calls the callback after the delay in milliseconds,
+// returns the timer id.
+func scheduleTimer(callback, delay vmvalue.Value, repeat bool) (vmvalue.Value, error) {
+	if !isFunction(callback) {
+		return vmvalue.NilValue, errTimerCallback
+	}
+	duration, err := timerDelay(delay)
+	if err != nil {
+		return vmvalue.NilValue, err
+	}
+
+	t := &timer{Due: time.Now().Add(duration), Callback: callback}
+	if repeat {
+		t.Interval = duration
+	}
+	addTimer(t)
+	return vmvalue.IntAsValue(t.ID), nil
+}
+
+func timerDelay(delay vmvalue.Value) (time.Duration, error) {
+	if !vmvalue.IsNumber(delay) || vmvalue.ValueAsNumber(delay) < 0 {
+		return 0, errTimerDelay
+	}
+	return time.Duration(vmvalue.ValueAsNumber(delay) * float64(time.Millisecond)), nil
+}
+
+func addTimer(t *timer) {
+	loop := &GlobalVM.Loop
+	if loop.active == nil {
+		loop.active = make(map[int64]*timer)
+	}
+	loop.timerID++
+	t.ID = loop.timerID
+	loop.active[t.ID] = t
+	pushTimer(t)
+}
+
+func pushTimer(t *timer) {
+	loop := &GlobalVM.Loop
+	loop.seq++
+	t.seq = loop.seq
+	heap.Push(&loop.timers, t)
+}
+
+// clearTimer cancels the timer, unknown or finished timers are ignored.
+func clearTimer(id vmvalue.Value) (vmvalue.Value, error) {
+	if !vmvalue.IsInt(id) {
+		return vmvalue.NilValue, errTimerID
+	}
+	loop := &GlobalVM.Loop
+	if t, found := loop.active[vmvalue.ValueAsInt(id)]; found {
+		delete(loop.active, t.ID)
+		if t.index >= 0 {
+			heap.Remove(&loop.timers, t.index)
+		}
+	}
+	return vmvalue.NilValue, nil
+}
+
+func isFunction(value vmvalue.Value) bool {
+	return vmvalue.IsClosure(value) || vmvalue.IsNativeFn(value) || vmvalue.IsBoundMethod(value)
+}
+
+func enqueueMicrotask(reaction vmvalue.PromiseReaction, state vmvalue.PromiseState, value vmvalue.Value) {
+	loop := &GlobalVM.Loop
+	loop.microtasks = append(loop.microtasks, microtask{Reaction: reaction, State: state, Value: value})
+}
+
+// currentSite is the location of the running stack frame, empty once the script has returned to the loop.
+func currentSite() string {
+	if GlobalVM.FrameCount == 0 {
+		return ""
+	}
+	return frameLocation(&GlobalVM.Frames[GlobalVM.FrameCount-1])
+}
+
+// trackRejection remembers the promise rejected without reactions, and where it was rejected.
+func trackRejection(promise *vmvalue.ObjPromise, site string) {
+	loop := &GlobalVM.Loop
+	loop.rejected = append(loop.rejected, rejection{Promise: promise, Site: site})
+}
+
+// reportUnhandledRejections reports the rejections no reaction has handled as the runtime error.
+func reportUnhandledRejections() error {
+	loop := &GlobalVM.Loop
+	if len(loop.rejected) == 0 {
+		return nil
+	}
+	for _, r := range loop.rejected {
+		loopError(r.Site, unhandledRejectionMessage, vmvalue.SprintValue(r.Promise.Value))
+	}
+	clear(loop.rejected)
+	loop.rejected = loop.rejected[:0]
+	return InterpretRuntimeError
+}
+
+// loopError reports the runtime error found by the event loop, the site is the stack frame
+// which has started the failed work, if any.
+func loopError(site, format string, messageAndArgs ...any) {
+	fmt.Fprintf(os.Stderr, format, messageAndArgs...)
+	fmt.Fprintln(os.Stderr)
+	if site != "" {
+		fmt.Fprintln(os.Stderr, site)
+	}
+}
+
+// runEventLoop runs the microtasks, the timers and settles the work completed on the other goroutines
+// until there is nothing left to wait for.
+func runEventLoop() error {
+	loop := &GlobalVM.Loop
+	for {
+		for loop.head < len(loop.microtasks) {
+			if err := runMicrotask(loop.microtasks[loop.head]); err != nil {
+				return err
+			}
+			loop.head++
+		}
+		loop.microtasks = loop.microtasks[:0]
+		loop.head = 0
+
+		if settled, err := settleCompletions(); err != nil {
+			return err
+		} else if settled {
+			continue
+		}
+		loop.rejected = slices.DeleteFunc(loop.rejected, func(r rejection) bool {
+			return r.Promise.Handled
+		})
+
+		if len(loop.timers) == 0 && len(loop.spawned) == 0 {
+			if len(loop.operations) == 0 {
+				return reportUnhandledRejections()
+			}
+			// only the channel operations are left, which nothing else may complete
+			channels().idle()
+		}
+		if waitEventLoop() {
+			if err := runTimer(heap.Pop(&loop.timers).(*timer)); err != nil { //nolint:forcetypeassert // only timers are queued
+				return err
+			}
+		}
+	}
+}
+
+// settleCompletions settles the work completed on the other goroutines, in the order it was delivered.
+func settleCompletions() (settled bool, err error) {
+	loop := &GlobalVM.Loop
+	if loop.completions == nil {
+		return false, nil
+	}
+	items := loop.completions.take()
+	for _, item := range items {
+		if err = item.settle(); err != nil {
+			return true, err
+		}
+	}
+	return len(items) > 0, nil
+}
+
+// waitEventLoop waits until the next timer is due or until some work has completed
+// on another goroutine, reports whether the timer is due.
+func waitEventLoop() (timerDue bool) {
+	loop := &GlobalVM.Loop
+	if len(loop.timers) == 0 {
+		<-loop.completionQueue().ready
+		return false
+	}
+	wait := time.Until(loop.timers[0].Due)
+	if wait <= 0 {
+		return true
+	}
+	if len(loop.spawned) == 0 && len(loop.operations) == 0 {
+		time.Sleep(wait)
+		return true
+	}
+	due := time.NewTimer(wait)
+	defer due.Stop()
+	select {
+	case <-loop.completionQueue().ready:
+		return false
+	case <-due.C:
+		return true
+	}
+}
+
+// runTimer calls the timer callback or resolves the promise of sleep, the interval is scheduled
+// again before the callback runs, so the callback can clear it.
+func runTimer(t *timer) error {
+	if t.Interval > 0 {
+		t.Due = t.Due.Add(t.Interval)
+		pushTimer(t)
+	} else {
+		delete(GlobalVM.Loop.active, t.ID)
+	}
+
+	if t.Promise != nil {
+		settlePromise(t.Promise, vmvalue.PromiseFulfilled, vmvalue.NilValue)
+		return nil
+	}
+	_, err := callFunction(t.Callback)
+	return err
+}
+
+// runMicrotask resumes the fiber awaiting the settled promise, or runs the promise reaction.
+func runMicrotask(task microtask) error {
+	reaction := task.Reaction
+	switch {
+	case reaction.Fiber != nil:
+		return resumeAwaitingFiber(reaction.Fiber, task.State, task.Value)
+	case reaction.Values != nil:
+		settleAllItem(reaction, task.State, task.Value)
+		return nil
+	}
+
+	handler := reaction.OnFulfilled
+	if task.State == vmvalue.PromiseRejected {
+		handler = reaction.OnRejected
+	}
+	if vmvalue.IsNil(handler) {
+		// no handler, the result promise settles the same way
+		if task.State == vmvalue.PromiseRejected {
+			settlePromise(reaction.Result, task.State, task.Value)
+			return nil
+		}
+		if !resolvePromise(reaction.Result, task.Value) {
+			return runError()
+		}
+		return nil
+	}
+
+	var args []vmvalue.Value
+	if acceptsArgument(handler) {
+		args = append(args, task.Value)
+	}
+	result, err := callFunction(handler, args...)
+	if err != nil {
+		return err
+	}
+	Push(result)
+	if !resolvePromise(reaction.Result, result) {
+		return runError()
+	}
+	Pop()
+	return nil
+}
+
+// resumeAwaitingFiber continues the async function, `await` evaluates to the fulfilled value
+// or fails with the rejection reason.
+func resumeAwaitingFiber(fiber *vmvalue.ObjFiber, state vmvalue.PromiseState, value vmvalue.Value) error {
+	baseFrame := GlobalVM.FrameCount
+	Push(vmvalue.ObjAsValue(fiber))
+	if state == vmvalue.PromiseRejected {
+		if !resumeFiber(fiber, vmvalue.NilValue, vmvalue.ResumeValue) {
+			return runError()
+		}
+		// the error is reported at the `await` of the resumed frame, the queued microtask keeps the reason
+		runtimeError("Promise rejected: %s", vmvalue.SprintValue(value))
+		return runError()
+	}
+	if !resumeFiber(fiber, value, vmvalue.ResumeValue) {
+		return runError()
+	}
+	_, err := run(baseFrame)
+	return err
+}
+
+// callFunction calls the function from the event loop and runs it to completion.
+func callFunction(callee vmvalue.Value, args ...vmvalue.Value) (vmvalue.Value, error) {
+	baseFrame := GlobalVM.FrameCount
+	Push(callee)
+	for _, arg := range args {
+		Push(arg)
+	}
+	if !CallValue(callee, byte(len(args))) {
+		return vmvalue.NilValue, runError()
+	}
+	if GlobalVM.FrameCount == baseFrame {
+		// native function or generator has returned right away
+		return Pop(), nil
+	}
+	return run(baseFrame)
+}
+
+// acceptsArgument reports whether the handler declares parameters, so `then(fun() { ... })`
+// does not fail with an arity error.
+func acceptsArgument(handler vmvalue.Value) bool {
+	var fn *vmvalue.ObjFunction
+	switch {
+	case vmvalue.IsClosure(handler):
+		fn = vmvalue.ValueAsClosure(handler).Fn
+	case vmvalue.IsBoundMethod(handler):
+		fn = vmvalue.ValueAsBoundMethod(handler).Method.Fn
+	default:
+		return true
+	}
+	return fn.Arity > 0 || fn.Variadic
+}
+
+// clearEventLoop drops the pending tasks, once the script has failed they never run.
+func clearEventLoop() {
+	loop := &GlobalVM.Loop
+	clear(loop.microtasks)
+	loop.microtasks = loop.microtasks[:0]
+	loop.head = 0
+	clear(loop.timers)
+	loop.timers = loop.timers[:0]
+	clear(loop.active)
+	clear(loop.rejected)
+	loop.rejected = loop.rejected[:0]
+	clear(loop.operations)
+	killSpawned()
+}
+
+func markEventLoop() {
+	loop := &GlobalVM.Loop
+	for i := loop.head; i < len(loop.microtasks); i++ {
+		task := &loop.microtasks[i]
+		task.Reaction.Mark()
+		vmvalue.MarkValue(task.Value)
+	}
+	for _, t := range loop.timers {
+		vmvalue.MarkValue(t.Callback)
+		vmvalue.MarkObject(t.Promise)
+	}
+	for _, promise := range loop.spawned {
+		vmvalue.MarkObject(promise)
+	}
+	for _, promise := range loop.operations {
+		vmvalue.MarkObject(promise)
+	}
+	for _, r := range loop.rejected {
+		vmvalue.MarkObject(r.Promise)
+	}
+}
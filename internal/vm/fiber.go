@@ -0,0 +1,311 @@
+package vm
+
+import (
+	"unsafe"
+
+	"github.com/leonardinius/goloxvm/internal/vm/vmmem"
+	"github.com/leonardinius/goloxvm/internal/vm/vmstd"
+	"github.com/leonardinius/goloxvm/internal/vm/vmvalue"
+)
+
+// defineFiberClass defines `Fiber` class with `Fiber.new(fn)` and `Fiber.suspend(value)` static natives.
+func defineFiberClass() {
+	klass := defineNativeClass("Fiber")
+	defineStaticNative(klass, "new", 1, func(args ...vmvalue.Value) (vmvalue.Value, error) {
+		return vmstd.StdFiberNew(args[0])
+	})
+	// the running fiber is suspended by CallNative once the native has returned the value
+	defineStaticNative(klass, "suspend", 1, func(args ...vmvalue.Value) (vmvalue.Value, error) {
+		GlobalVM.PendingYield = true
+		return args[0], nil
+	}).MinArity = 0
+}
+
+// callGenerator turns the frame just pushed by Call into the suspended fiber, which replaces the callee.
+func callGenerator(closure *vmvalue.ObjClosure) (ok bool) {
+	base := GlobalVM.FrameCount - 1
+	slotsTop := GlobalVM.Frames[base].SlotsTop
+	fiber := vmvalue.NewFiber(closure)
+	Push(vmvalue.ObjAsValue(fiber))
+	fiber.State = vmvalue.FiberSuspended
+	saveFiberFrames(fiber, base)
+	saveFiberStack(fiber, slotsTop, GlobalVM.StackTop-1)
+
+	GlobalVM.FrameCount = base
+	GlobalVM.StackTop = slotsTop
+	Push(vmvalue.ObjAsValue(fiber))
+	return true
+}
+
+// invokeFiber calls `resume(value)`, `isDone()` or iterator protocol methods of the fiber.
+func invokeFiber(fiber *vmvalue.ObjFiber, name *vmvalue.ObjString, argCount byte) (ok bool) {
+	if name == GlobalVM.ResumeString {
+		if argCount > 1 {
+			return runtimeError("Expected 0 to 1 arguments but got %d.", argCount)
+		}
+		value := vmvalue.NilValue
+		if argCount == 1 {
+			value = Pop()
+		}
+		return resumeFiber(fiber, value, vmvalue.ResumeValue)
+	}
+
+	if argCount != 0 {
+		return runtimeError("Expected 0 arguments but got %d.", argCount)
+	}
+	switch name {
+	case GlobalVM.IsDoneString:
+		SetStackAt(GlobalVM.StackTop-1, vmvalue.BoolAsValue(fiber.State == vmvalue.FiberDone))
+		return true
+	case GlobalVM.HasNextString:
+		if fiber.HasPeeked || fiber.State == vmvalue.FiberDone {
+			SetStackAt(GlobalVM.StackTop-1, vmvalue.BoolAsValue(fiber.HasPeeked))
+			return true
+		}
+		return resumeFiber(fiber, vmvalue.NilValue, vmvalue.ResumeHasNext)
+	case GlobalVM.NextString:
+		if fiber.HasPeeked {
+			SetStackAt(GlobalVM.StackTop-1, fiber.Peeked)
+			fiber.HasPeeked = false
+			fiber.Peeked = vmvalue.NilValue
+			return true
+		}
+		if fiber.State == vmvalue.FiberDone {
+			return runtimeError("Iterator has no more items.")
+		}
+		return resumeFiber(fiber, vmvalue.NilValue, vmvalue.ResumeNext)
+	case GlobalVM.IteratorString:
+		return true
+	default:
+		return runtimeError("Undefined property '%s'.", vmvalue.PropertyName(name))
+	}
+}
+
+// resumeFiber switches to the fiber on top of the stack, its slot receives the result once
+// the fiber yields or returns.
+func resumeFiber(fiber *vmvalue.ObjFiber, value vmvalue.Value, mode vmvalue.ResumeMode) (ok bool) {
+	switch fiber.State {
+	case vmvalue.FiberDone:
+		return runtimeError("Can't resume a finished fiber.")
+	case vmvalue.FiberRunning:
+		return runtimeError("Fiber is already running.")
+	}
+	if GlobalVM.FrameCount+max(len(fiber.Frames), 1) > MaxCallFrames {
+		return runtimeError("Stack overflow.")
+	}
+
+	base := GlobalVM.FrameCount
+	if fiber.State == vmvalue.FiberNew {
+		// the first resume value is the argument of the fiber function
+		Push(vmvalue.ObjAsValue(fiber.Closure))
+		argCount := byte(0)
+		if fiber.Closure.Fn.Arity > 0 {
+			Push(value)
+			argCount = 1
+		}
+		if ok = callFrame(fiber.Closure, argCount); !ok {
+			return ok
+		}
+	} else {
+		restoreFiberFrames(fiber)
+		if fiber.AwaitingValue {
+			Push(value)
+		}
+	}
+
+	GlobalVM.Frames[base].FiberBase = true
+	fiber.State = vmvalue.FiberRunning
+	fiber.Mode = mode
+	fiber.Parent = GlobalVM.Fiber
+	GlobalVM.Fiber = fiber
+	return true
+}
+
+// yieldFiber suspends the running fiber with all its frames, the yielded value on top of the stack
+// is passed to the resumer. The fiber started below the innermost run can't be suspended,
+// as the native or protocol call above it has to return first.
+func yieldFiber() (ok bool) {
+	fiber := GlobalVM.Fiber
+	if fiber == nil {
+		return runtimeError("Can't yield outside of a fiber.")
+	}
+	if fiber.Promise != nil {
+		return runtimeError("Can't yield from an async function.")
+	}
+	base := fiberBaseFrame()
+	if base <= GlobalVM.RunBaseFrame {
+		return runtimeError("Can't yield across a native call.")
+	}
+
+	value := Peek(0)
+	suspendFiber(fiber, base)
+	return leaveFiber(fiber, value, true)
+}
+
+// fiberBaseFrame returns the index of the bottom frame of the running fiber.
+func fiberBaseFrame() int {
+	base := GlobalVM.FrameCount - 1
+	for base > 0 && !GlobalVM.Frames[base].FiberBase {
+		base--
+	}
+	return base
+}
+
+// suspendFiber saves the fiber frames starting at base without the value on top of the stack
+// and pops them, the value the fiber is resumed with is pushed in its place.
+func suspendFiber(fiber *vmvalue.ObjFiber, base int) {
+	slotsTop := GlobalVM.Frames[base].SlotsTop
+	saveFiberFrames(fiber, base)
+	saveFiberStack(fiber, slotsTop, GlobalVM.StackTop-1)
+	fiber.AwaitingValue = true
+	fiber.State = vmvalue.FiberSuspended
+
+	GlobalVM.FrameCount = base
+	GlobalVM.StackTop = slotsTop
+}
+
+// finishFiber completes the fiber which has returned from its bottom frame,
+// the async function promise is resolved with the returned value.
+func finishFiber(value vmvalue.Value) (ok bool) {
+	fiber := GlobalVM.Fiber
+	fiber.State = vmvalue.FiberDone
+	fiber.Stack = fiber.Stack[:0]
+	if fiber.Promise != nil {
+		Push(value)
+		if ok = resolvePromise(fiber.Promise, value); !ok {
+			return ok
+		}
+		Pop()
+	}
+	return leaveFiber(fiber, value, false)
+}
+
+// leaveFiber switches back to the resumer and replaces the fiber on its stack with the result.
+func leaveFiber(fiber *vmvalue.ObjFiber, value vmvalue.Value, yielded bool) (ok bool) {
+	GlobalVM.Fiber = fiber.Parent
+	fiber.Parent = nil
+
+	result := value
+	if fiber.Promise != nil {
+		// the async function call evaluates to its promise
+		result = vmvalue.ObjAsValue(fiber.Promise)
+	}
+	switch fiber.Mode {
+	case vmvalue.ResumeHasNext:
+		if yielded {
+			fiber.Peeked = value
+			fiber.HasPeeked = true
+		}
+		result = vmvalue.BoolAsValue(yielded)
+	case vmvalue.ResumeNext:
+		if !yielded {
+			return runtimeError("Iterator has no more items.")
+		}
+	case vmvalue.ResumeValue:
+	}
+	SetStackAt(GlobalVM.StackTop-1, result)
+	return true
+}
+
+// saveFiberFrames copies the call frames starting at base into the fiber,
+// the frame slots are saved relative to the bottom frame.
+func saveFiberFrames(fiber *vmvalue.ObjFiber, base int) {
+	slotsTop := GlobalVM.Frames[base].SlotsTop
+	frames := reuseSlice(fiber.Frames[:0], GlobalVM.FrameCount-base)
+	for i := range frames {
+		frame := &GlobalVM.Frames[base+i]
+		frames[i] = vmvalue.FiberFrame{
+			Closure:        frame.Closure,
+			IP:             frame.IP,
+			SlotsTop:       frame.SlotsTop - slotsTop,
+			ArgCount:       frame.ArgCount,
+			InvokeResult:   frame.InvokeResult,
+			InvokeArgCount: frame.InvokeArgCount,
+			DiscardResult:  frame.DiscardResult,
+		}
+	}
+	fiber.Frames = frames
+}
+
+// saveFiberStack copies stack slots [from, to) into the fiber and moves the open upvalues
+// pointing to them, the upvalues keep the values until the fiber is resumed.
+func saveFiberStack(fiber *vmvalue.ObjFiber, from, to int) {
+	fiber.Stack = fiber.Stack[:0]
+	fiber.Stack = reuseSlice(fiber.Stack, to-from)
+	copy(fiber.Stack, GlobalVM.Stack[from:to])
+
+	fromPtr := vmvalue.UPtrFromValue(&GlobalVM.Stack[from])
+	count := 0
+	for upvalue := GlobalVM.OpenUpvalues; upvalue != nil && vmvalue.UPtrFromValue(upvalue.Location) >= fromPtr; upvalue = upvalue.Next {
+		count++
+	}
+	// the upvalues stay in the open list until both slices are allocated
+	fiber.Upvalues = fiber.Upvalues[:0]
+	upvalues := reuseSlice(fiber.Upvalues, count)
+	slots := reuseSlice(fiber.UpvalueSlots[:0], count)
+	for i := range count {
+		upvalue := GlobalVM.OpenUpvalues
+		upvalues[i] = upvalue
+		slots[i] = int(vmvalue.UPtrFromValue(upvalue.Location)-fromPtr) / int(unsafe.Sizeof(vmvalue.Value(0)))
+		upvalue.Closed = *upvalue.Location
+		upvalue.Location = &upvalue.Closed
+		GlobalVM.OpenUpvalues = upvalue.Next
+		upvalue.Next = nil
+	}
+	fiber.Upvalues = upvalues
+	fiber.UpvalueSlots = slots
+}
+
+// restoreFiberFrames pushes the suspended fiber frames back on top of the stack.
+func restoreFiberFrames(fiber *vmvalue.ObjFiber) {
+	base := GlobalVM.StackTop
+	copy(GlobalVM.Stack[base:], fiber.Stack)
+	GlobalVM.StackTop += len(fiber.Stack)
+	fiber.Stack = fiber.Stack[:0]
+
+	// the upvalues are ordered from the top of the stack
+	for i := len(fiber.Upvalues) - 1; i >= 0; i-- {
+		upvalue := fiber.Upvalues[i]
+		slot := &GlobalVM.Stack[base+fiber.UpvalueSlots[i]]
+		*slot = upvalue.Closed
+		upvalue.Location = slot
+		upvalue.Closed = vmvalue.NilValue
+		upvalue.Next = GlobalVM.OpenUpvalues
+		GlobalVM.OpenUpvalues = upvalue
+	}
+	fiber.Upvalues = fiber.Upvalues[:0]
+
+	for i := range fiber.Frames {
+		saved := &fiber.Frames[i]
+		frame := &GlobalVM.Frames[GlobalVM.FrameCount]
+		GlobalVM.FrameCount++
+		frame.Closure = saved.Closure
+		frame.IP = saved.IP
+		frame.SlotsTop = base + saved.SlotsTop
+		frame.ArgCount = saved.ArgCount
+		frame.InvokeResult = saved.InvokeResult
+		frame.InvokeArgCount = saved.InvokeArgCount
+		frame.DiscardResult = saved.DiscardResult
+		frame.FiberBase = false
+	}
+	fiber.Frames = fiber.Frames[:0]
+}
+
+// abandonFibers marks the fibers running when the stack is reset as finished.
+func abandonFibers() {
+	for fiber := GlobalVM.Fiber; fiber != nil; {
+		parent := fiber.Parent
+		fiber.State = vmvalue.FiberDone
+		fiber.Parent = nil
+		fiber = parent
+	}
+	GlobalVM.Fiber = nil
+}
+
+// reuseSlice returns the slice of length n reusing its capacity if possible.
+func reuseSlice[S ~[]E, E any](s S, n int) S {
+	if cap(s) < n {
+		return vmmem.GrowSlice(s[:0], n)
+	}
+	return s[:n]
+}
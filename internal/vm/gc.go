@@ -30,6 +30,26 @@ func markRoots() {
 	vmcompiler.MarkCompilerRoots()
 
 	vmvalue.MarkObject(GlobalVM.InitString)
+	vmvalue.MarkObject(GlobalVM.ToStringString)
+	vmvalue.MarkObject(GlobalVM.EqualsString)
+	vmvalue.MarkObject(GlobalVM.HashString)
+	vmvalue.MarkObject(GlobalVM.IteratorString)
+	vmvalue.MarkObject(GlobalVM.HasNextString)
+	vmvalue.MarkObject(GlobalVM.NextString)
+	vmvalue.MarkObject(GlobalVM.ResumeString)
+	vmvalue.MarkObject(GlobalVM.IsDoneString)
+	vmvalue.MarkObject(GlobalVM.ThenString)
+	vmvalue.MarkObject(GlobalVM.CatchString)
+	vmvalue.MarkObject(GlobalVM.ResolveString)
+	vmvalue.MarkObject(GlobalVM.RejectString)
+	vmvalue.MarkObject(GlobalVM.SendString)
+	vmvalue.MarkObject(GlobalVM.ReceiveString)
+	vmvalue.MarkObject(GlobalVM.CloseString)
+	vmvalue.MarkObject(GlobalVM.NameString)
+	vmvalue.MarkObject(GlobalVM.OrdinalString)
+	vmvalue.MarkObject(GlobalVM.Fiber)
+	markOperatorStrings()
+	markEventLoop()
 }
 
 func traceReferences() {
@@ -0,0 +1,56 @@
+package vm
+
+import (
+	"github.com/leonardinius/goloxvm/internal/vm/vmstd"
+	"github.com/leonardinius/goloxvm/internal/vm/vmvalue"
+)
+
+// getIterator replaces the iterable on top of the stack with its iterator.
+// Instances are handled by the caller invoking their `iterator()` method.
+func getIterator() (ok bool) {
+	iterable := Peek(0)
+
+	var iterator *vmvalue.ObjIterator
+	switch {
+	case vmvalue.IsIterator(iterable), vmvalue.IsFiber(iterable):
+		return true
+	case vmvalue.IsList(iterable), vmvalue.IsString(iterable), vmvalue.IsEnum(iterable):
+		iterator = vmvalue.NewSourceIterator(iterable)
+	case vmvalue.IsMap(iterable):
+		keys, _ := vmstd.StdKeys(iterable)
+		Push(keys)
+		iterator = vmvalue.NewSourceIterator(keys)
+		Pop()
+	default:
+		return runtimeError("Only lists, maps, strings, enums, ranges, fibers and iterables can be iterated.")
+	}
+
+	Pop()
+	Push(vmvalue.ObjAsValue(iterator))
+	return true
+}
+
+// invokeIterator calls `hasNext()`, `next()` or `iterator()` method of the built-in iterator.
+func invokeIterator(iterator *vmvalue.ObjIterator, name *vmvalue.ObjString, argCount byte) (ok bool) {
+	if argCount != 0 {
+		return runtimeError("Expected 0 arguments but got %d.", argCount)
+	}
+
+	var result vmvalue.Value
+	switch name {
+	case GlobalVM.HasNextString:
+		result = vmvalue.BoolAsValue(iterator.HasNext())
+	case GlobalVM.NextString:
+		if !iterator.HasNext() {
+			return runtimeError("Iterator has no more items.")
+		}
+		result = iterator.Advance()
+	case GlobalVM.IteratorString:
+		result = vmvalue.ObjAsValue(iterator)
+	default:
+		return runtimeError("Undefined property '%s'.", vmvalue.PropertyName(name))
+	}
+
+	SetStackAt(GlobalVM.StackTop-1, result)
+	return true
+}
@@ -0,0 +1,231 @@
+package vm
+
+import (
+	"fmt"
+	"math/big"
+	"slices"
+
+	"github.com/leonardinius/goloxvm/internal/vm/vmchunk"
+	"github.com/leonardinius/goloxvm/internal/vm/vmmem"
+	"github.com/leonardinius/goloxvm/internal/vm/vmvalue"
+)
+
+type MessageKind byte
+
+const (
+	MessageNil MessageKind = iota
+	MessageBool
+	MessageFloat
+	MessageInt
+	MessageBigInt
+	MessageDecimal
+	MessageString
+	MessageList
+	MessageMap
+	MessageChannel
+	MessageFunction
+)
+
+// Message is the deep copy of the value crossing the boundary between the isolated VMs,
+// it refers to nothing in the heap of either VM.
+type Message struct {
+	Kind   MessageKind
+	Bool   bool
+	Number float64
+	Int    int64 // integer, decimal scale or channel id
+	Bytes  []byte
+	// list items, map keys and values interleaved
+	Items    []Message
+	Function *FunctionMessage
+}
+
+// FunctionMessage is the copy of the compiled function, the spawned VM runs the same bytecode.
+type FunctionMessage struct {
+	Name         []byte
+	Arity        int
+	MinArity     int
+	Variadic     bool
+	Generator    bool
+	Async        bool
+	UpvalueCount int
+	Code         []byte
+	Lines        []int
+	Constants    []Message
+}
+
+type messageEncoder struct {
+	visiting []vmvalue.Value
+}
+
+// encodeMessage copies strings, numbers, booleans, nil, lists, maps and channels.
+func encodeMessage(value vmvalue.Value) (Message, error) {
+	encoder := messageEncoder{}
+	return encoder.encode(value)
+}
+
+func (e *messageEncoder) encode(value vmvalue.Value) (Message, error) {
+	switch {
+	case vmvalue.IsNil(value):
+		return Message{Kind: MessageNil}, nil
+	case vmvalue.IsBool(value):
+		return Message{Kind: MessageBool, Bool: vmvalue.ValueAsBool(value)}, nil
+	case vmvalue.IsInt(value):
+		return Message{Kind: MessageInt, Int: vmvalue.ValueAsInt(value)}, nil
+	case vmvalue.IsNumber(value):
+		return Message{Kind: MessageFloat, Number: vmvalue.ValueAsNumber(value)}, nil
+	case vmvalue.IsBigInt(value):
+		return Message{Kind: MessageBigInt, Bytes: vmvalue.ValueAsBigInt(value).Value.Append(nil, 10)}, nil
+	case vmvalue.IsDecimal(value):
+		d := vmvalue.ValueAsDecimal(value)
+		return Message{Kind: MessageDecimal, Int: int64(d.Scale), Bytes: d.Unscaled.Append(nil, 10)}, nil
+	case vmvalue.IsString(value):
+		return Message{Kind: MessageString, Bytes: slices.Clone(vmvalue.ValueAsStringChars(value))}, nil
+	case vmvalue.IsChannel(value):
+		return Message{Kind: MessageChannel, Int: vmvalue.ValueAsChannel(value).ID}, nil
+	case vmvalue.IsList(value), vmvalue.IsMap(value):
+		return e.encodeContainer(value)
+	default:
+		return Message{}, fmt.Errorf("can't copy %s to another VM", vmvalue.TypeName(value))
+	}
+}
+
+func (e *messageEncoder) encodeContainer(value vmvalue.Value) (Message, error) {
+	if slices.Contains(e.visiting, value) {
+		return Message{}, fmt.Errorf("can't copy cyclic %s to another VM", vmvalue.TypeName(value))
+	}
+	e.visiting = append(e.visiting, value)
+	defer func() { e.visiting = e.visiting[:len(e.visiting)-1] }()
+
+	var message Message
+	var items []vmvalue.Value
+	if vmvalue.IsList(value) {
+		message.Kind = MessageList
+		items = vmvalue.ValueAsList(value).Items
+	} else {
+		message.Kind = MessageMap
+		vmvalue.ValueAsMap(value).Table.Each(func(key, value vmvalue.Value) {
+			items = append(items, key, value)
+		})
+	}
+
+	message.Items = make([]Message, len(items))
+	for i, item := range items {
+		var err error
+		if message.Items[i], err = e.encode(item); err != nil {
+			return Message{}, err
+		}
+	}
+	return message, nil
+}
+
+// encodeFunction copies the bytecode of the function together with the functions it declares.
+func encodeFunction(fn *vmvalue.ObjFunction) (*FunctionMessage, error) {
+	chunk := vmchunk.FromPtr(fn.Chunk)
+	message := &FunctionMessage{
+		Arity:        fn.Arity,
+		MinArity:     fn.MinArity,
+		Variadic:     fn.Variadic,
+		Generator:    fn.Generator,
+		Async:        fn.Async,
+		UpvalueCount: fn.UpvalueCount,
+		Code:         slices.Clone(chunk.Code[:chunk.Count]),
+		Lines:        make([]int, chunk.Count),
+		Constants:    make([]Message, len(chunk.Constants)),
+	}
+	if fn.Name != nil {
+		message.Name = slices.Clone(fn.Name.Chars)
+	}
+	for offset := range message.Lines {
+		message.Lines[offset] = chunk.Lines.GetLineByOffset(offset)
+	}
+	for i, constant := range chunk.Constants {
+		if vmvalue.IsFunction(constant) {
+			nested, err := encodeFunction(vmvalue.ValueAsFunction(constant))
+			if err != nil {
+				return nil, err
+			}
+			message.Constants[i] = Message{Kind: MessageFunction, Function: nested}
+			continue
+		}
+		var err error
+		if message.Constants[i], err = encodeMessage(constant); err != nil {
+			return nil, err
+		}
+	}
+	return message, nil
+}
+
+// decodeMessage allocates the copy of the message in the heap of this VM.
+func decodeMessage(message *Message) vmvalue.Value {
+	switch message.Kind {
+	case MessageBool:
+		return vmvalue.BoolAsValue(message.Bool)
+	case MessageFloat:
+		return vmvalue.NumberAsValue(message.Number)
+	case MessageInt:
+		return vmvalue.IntAsValue(message.Int)
+	case MessageBigInt:
+		value, _ := new(big.Int).SetString(string(message.Bytes), 10)
+		return vmvalue.ObjAsValue(vmvalue.NewBigInt(value))
+	case MessageDecimal:
+		unscaled, _ := new(big.Int).SetString(string(message.Bytes), 10)
+		return vmvalue.ObjAsValue(vmvalue.NewDecimal(unscaled, int32(message.Int)))
+	case MessageString:
+		return vmvalue.ObjAsValue(vmvalue.StringInternCopy(message.Bytes))
+	case MessageChannel:
+		return vmvalue.ObjAsValue(vmvalue.NewChannel(message.Int))
+	case MessageList:
+		list := vmvalue.NewList(vmvalue.NewValueArray())
+		vmmem.PushRetainGC(vmvalue.ValueAsNanBoxed(vmvalue.ObjAsValue(list)))
+		defer vmmem.PopReleaseGC()
+		for i := range message.Items {
+			item := decodeMessage(&message.Items[i])
+			vmmem.PushRetainGC(vmvalue.ValueAsNanBoxed(item))
+			list.Items.Write(item)
+			vmmem.PopReleaseGC()
+		}
+		return vmvalue.ObjAsValue(list)
+	case MessageMap:
+		m := vmvalue.NewMap()
+		vmmem.PushRetainGC(vmvalue.ValueAsNanBoxed(vmvalue.ObjAsValue(m)))
+		defer vmmem.PopReleaseGC()
+		for i := 0; i+1 < len(message.Items); i += 2 {
+			key := decodeMessage(&message.Items[i])
+			vmmem.PushRetainGC(vmvalue.ValueAsNanBoxed(key))
+			value := decodeMessage(&message.Items[i+1])
+			vmmem.PushRetainGC(vmvalue.ValueAsNanBoxed(value))
+			m.Table.Set(key, value)
+			vmmem.PopReleaseGC()
+			vmmem.PopReleaseGC()
+		}
+		return vmvalue.ObjAsValue(m)
+	case MessageFunction:
+		return vmvalue.ObjAsValue(decodeFunction(message.Function))
+	default:
+		return vmvalue.NilValue
+	}
+}
+
+func decodeFunction(message *FunctionMessage) *vmvalue.ObjFunction {
+	chunk := vmchunk.NewChunk()
+	fn := vmvalue.NewFunction(chunk.AsPtr(), chunk.Free, chunk.Mark)
+	vmmem.PushRetainGC(vmvalue.ValueAsNanBoxed(vmvalue.ObjAsValue(fn)))
+	defer vmmem.PopReleaseGC()
+
+	fn.Arity = message.Arity
+	fn.MinArity = message.MinArity
+	fn.Variadic = message.Variadic
+	fn.Generator = message.Generator
+	fn.Async = message.Async
+	fn.UpvalueCount = message.UpvalueCount
+	if message.Name != nil {
+		fn.Name = vmvalue.StringInternCopy(message.Name)
+	}
+	for offset, code := range message.Code {
+		chunk.Write(code, message.Lines[offset])
+	}
+	for i := range message.Constants {
+		chunk.AddConstant(decodeMessage(&message.Constants[i]))
+	}
+	return fn
+}
@@ -0,0 +1,104 @@
+package vm
+
+import (
+	"github.com/leonardinius/goloxvm/internal/vm/vmvalue"
+)
+
+// Operator is the user defined operator method the VM dispatches to when the left operand is an instance.
+type Operator byte
+
+const (
+	OperatorAdd Operator = iota
+	OperatorSubtract
+	OperatorMultiply
+	OperatorDivide
+	OperatorModulo
+	OperatorLess
+	OperatorGreater
+	OperatorNegate
+	OperatorIndex
+	OperatorSetIndex
+	operatorCount
+)
+
+var operatorNames = [operatorCount]string{
+	OperatorAdd:      "__add",
+	OperatorSubtract: "__sub",
+	OperatorMultiply: "__mul",
+	OperatorDivide:   "__div",
+	OperatorModulo:   "__mod",
+	OperatorLess:     "__lt",
+	OperatorGreater:  "__gt",
+	OperatorNegate:   "__neg",
+	OperatorIndex:    "__index",
+	OperatorSetIndex: "__setindex",
+}
+
+func initOperatorStrings() {
+	for op, name := range operatorNames {
+		GlobalVM.OperatorStrings[op] = vmvalue.StringInternCopy([]byte(name))
+	}
+}
+
+func freeOperatorStrings() {
+	for op := range GlobalVM.OperatorStrings {
+		GlobalVM.OperatorStrings[op] = nil
+	}
+}
+
+func markOperatorStrings() {
+	for _, name := range GlobalVM.OperatorStrings {
+		vmvalue.MarkObject(name)
+	}
+}
+
+// operatorMethod looks up the operator method of the instance below argCount operands.
+func operatorMethod(op Operator, argCount byte) (*vmvalue.ObjClosure, bool) {
+	receiver := Peek(argCount)
+	if !vmvalue.IsInstance(receiver) {
+		return nil, false
+	}
+	method, found := vmvalue.ValueAsInstance(receiver).Klass.Methods.Get(GlobalVM.OperatorStrings[op])
+	if !found {
+		return nil, false
+	}
+	return vmvalue.ValueAsClosure(method), true
+}
+
+// callOperator calls the operator method with the operands already on the stack,
+// the left operand is the receiver. Falls back to the built-in operation if there is no method.
+func callOperator(op Operator, argCount byte, fallback func() bool) (ok bool) {
+	method, found := operatorMethod(op, argCount)
+	if !found {
+		return fallback()
+	}
+	return Call(method, argCount)
+}
+
+// callSetIndexOperator calls `__setindex(index, value)`, the assigned value is the result
+// of the expression whatever the method returns.
+func callSetIndexOperator() (ok bool) {
+	method, found := operatorMethod(OperatorSetIndex, 2)
+	if !found {
+		return setIndex()
+	}
+	if method.Fn.Async {
+		return runtimeError("Operator method '%s' can't be async.", operatorNames[OperatorSetIndex])
+	}
+
+	// target index value -> value target index value
+	top := GlobalVM.StackTop
+	value := Peek(0)
+	Push(value)
+	copy(GlobalVM.Stack[top-2:top+1], GlobalVM.Stack[top-3:top])
+	GlobalVM.Stack[top-3] = value
+	if ok = Call(method, 2); ok {
+		if method.Fn.Generator {
+			// the created fiber is discarded right away
+			Pop()
+		} else {
+			GlobalVM.Frames[GlobalVM.FrameCount-1].DiscardResult = true
+		}
+	}
+	return ok
+}
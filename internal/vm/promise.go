@@ -0,0 +1,217 @@
+package vm
+
+import (
+	"errors"
+
+	"github.com/leonardinius/goloxvm/internal/vm/vmmem"
+	"github.com/leonardinius/goloxvm/internal/vm/vmvalue"
+)
+
+var errPromiseAllArgument = errors.New("Promise.all: argument must be a list")
+
+// definePromiseClass defines `Promise` class with `new()`, `resolve(value)`, `reject(reason)`
+// and `all(list)` static natives.
+func definePromiseClass() {
+	klass := defineNativeClass("Promise")
+	defineStaticNative(klass, "new", 0, func(...vmvalue.Value) (vmvalue.Value, error) {
+		return vmvalue.ObjAsValue(vmvalue.NewPromise()), nil
+	})
+	defineStaticNative(klass, "resolve", 1, func(args ...vmvalue.Value) (vmvalue.Value, error) {
+		if vmvalue.IsPromise(args[0]) {
+			return args[0], nil
+		}
+		promise := vmvalue.NewPromise()
+		settlePromise(promise, vmvalue.PromiseFulfilled, args[0])
+		return vmvalue.ObjAsValue(promise), nil
+	})
+	defineStaticNative(klass, "reject", 1, func(args ...vmvalue.Value) (vmvalue.Value, error) {
+		promise := vmvalue.NewPromise()
+		settlePromise(promise, vmvalue.PromiseRejected, args[0])
+		return vmvalue.ObjAsValue(promise), nil
+	})
+	defineStaticNative(klass, "all", 1, func(args ...vmvalue.Value) (vmvalue.Value, error) {
+		return promiseAll(args[0])
+	})
+}
+
+// invokePromise calls `then(onFulfilled, onRejected)`, `catch(onRejected)`, `resolve(value)`
+// or `reject(reason)` method of the promise.
+func invokePromise(promise *vmvalue.ObjPromise, name *vmvalue.ObjString, argCount byte) (ok bool) {
+	var minArgs, maxArgs byte
+	switch name {
+	case GlobalVM.ThenString:
+		minArgs, maxArgs = 1, 2
+	case GlobalVM.CatchString:
+		minArgs, maxArgs = 1, 1
+	case GlobalVM.ResolveString, GlobalVM.RejectString:
+		minArgs, maxArgs = 0, 1
+	default:
+		return runtimeError("Undefined property '%s'.", vmvalue.PropertyName(name))
+	}
+	if argCount < minArgs || argCount > maxArgs {
+		if minArgs == maxArgs {
+			return runtimeError("Expected %d arguments but got %d.", minArgs, argCount)
+		}
+		return runtimeError("Expected %d to %d arguments but got %d.", minArgs, maxArgs, argCount)
+	}
+	for ; argCount < maxArgs; argCount++ {
+		Push(vmvalue.NilValue)
+	}
+
+	result := vmvalue.NilValue
+	switch name {
+	case GlobalVM.ThenString, GlobalVM.CatchString:
+		reaction := vmvalue.PromiseReaction{OnFulfilled: vmvalue.NilValue, OnRejected: Peek(0)}
+		if name == GlobalVM.ThenString {
+			reaction.OnFulfilled = Peek(1)
+		}
+		for _, handler := range [...]vmvalue.Value{reaction.OnFulfilled, reaction.OnRejected} {
+			if !vmvalue.IsNil(handler) && !isFunction(handler) {
+				return runtimeError("Promise handler must be a function.")
+			}
+		}
+		reaction.Result = vmvalue.NewPromise()
+		result = vmvalue.ObjAsValue(reaction.Result)
+		Push(result)
+		promiseThen(promise, reaction)
+		Pop()
+	case GlobalVM.ResolveString:
+		if !resolvePromise(promise, Peek(0)) {
+			return false
+		}
+	case GlobalVM.RejectString:
+		settlePromise(promise, vmvalue.PromiseRejected, Peek(0))
+	}
+
+	GlobalVM.StackTop -= int(argCount)
+	SetStackAt(GlobalVM.StackTop-1, result)
+	return true
+}
+
+// promiseThen runs the reaction once the promise settles, right away if it has settled already.
+func promiseThen(promise *vmvalue.ObjPromise, reaction vmvalue.PromiseReaction) {
+	promise.Handled = true
+	if promise.State == vmvalue.PromisePending {
+		promise.AddReaction(reaction)
+		return
+	}
+	enqueueMicrotask(reaction, promise.State, promise.Value)
+}
+
+// resolvePromise fulfills the promise with the value, or makes it follow the promise value.
+// Settled promises are not changed.
+func resolvePromise(promise *vmvalue.ObjPromise, value vmvalue.Value) (ok bool) {
+	if promise.State != vmvalue.PromisePending {
+		return true
+	}
+	if !vmvalue.IsPromise(value) {
+		settlePromise(promise, vmvalue.PromiseFulfilled, value)
+		return true
+	}
+	source := vmvalue.ValueAsPromise(value)
+	if source == promise {
+		return runtimeError("Promise can't be resolved with itself.")
+	}
+	promiseThen(source, vmvalue.PromiseReaction{OnFulfilled: vmvalue.NilValue, OnRejected: vmvalue.NilValue, Result: promise})
+	return true
+}
+
+// settlePromise fulfills or rejects the pending promise and queues its reactions.
+func settlePromise(promise *vmvalue.ObjPromise, state vmvalue.PromiseState, value vmvalue.Value) {
+	settlePromiseAt(promise, state, value, "")
+}
+
+// settlePromiseAt settles the promise, the site is the stack frame which has started the work
+// the promise stands for, the running frame is used unless given.
+func settlePromiseAt(promise *vmvalue.ObjPromise, state vmvalue.PromiseState, value vmvalue.Value, site string) {
+	if promise.State != vmvalue.PromisePending {
+		return
+	}
+	promise.State = state
+	promise.Value = value
+	if state == vmvalue.PromiseRejected && !promise.Handled {
+		if site == "" {
+			site = currentSite()
+		}
+		trackRejection(promise, site)
+	}
+	for _, reaction := range promise.Reactions {
+		enqueueMicrotask(reaction, state, value)
+	}
+	promise.Reactions = vmmem.FreeSlice(promise.Reactions)
+}
+
+// promiseAll returns the promise fulfilled with the list of values once all promises of the list
+// are fulfilled, or rejected once any of them is rejected.
+func promiseAll(value vmvalue.Value) (vmvalue.Value, error) {
+	if !vmvalue.IsList(value) {
+		return vmvalue.NilValue, errPromiseAllArgument
+	}
+	list := vmvalue.ValueAsList(value)
+
+	all := vmvalue.NewPromise()
+	Push(vmvalue.ObjAsValue(all))
+	items := vmmem.AllocateSlice[vmvalue.Value](len(list.Items))
+	for i := range items {
+		items[i] = vmvalue.NilValue
+	}
+	values := vmvalue.NewList(items)
+	Push(vmvalue.ObjAsValue(values))
+	for i, item := range list.Items {
+		if vmvalue.IsPromise(item) {
+			all.Waiting++
+			promiseThen(vmvalue.ValueAsPromise(item), vmvalue.PromiseReaction{
+				OnFulfilled: vmvalue.NilValue, OnRejected: vmvalue.NilValue, Result: all, Values: values, Index: i,
+			})
+		} else {
+			values.Items[i] = item
+		}
+	}
+	if all.Waiting == 0 {
+		settlePromise(all, vmvalue.PromiseFulfilled, vmvalue.ObjAsValue(values))
+	}
+	Pop()
+	Pop()
+	return vmvalue.ObjAsValue(all), nil
+}
+
+// settleAllItem stores the fulfilled value of one of the Promise.all promises.
+func settleAllItem(reaction vmvalue.PromiseReaction, state vmvalue.PromiseState, value vmvalue.Value) {
+	all := reaction.Result
+	if state == vmvalue.PromiseRejected {
+		settlePromise(all, state, value)
+		return
+	}
+	reaction.Values.Items[reaction.Index] = value
+	if all.Waiting--; all.Waiting == 0 {
+		settlePromise(all, vmvalue.PromiseFulfilled, vmvalue.ObjAsValue(reaction.Values))
+	}
+}
+
+// callAsync starts the fiber of the async function call just pushed by Call, it runs until
+// the first `await`. The promise of the call replaces the callee then.
+func callAsync(closure *vmvalue.ObjClosure) (ok bool) {
+	callGenerator(closure)
+	fiber := vmvalue.ValueAsFiber(Peek(0))
+	fiber.Promise = vmvalue.NewPromise()
+	return resumeFiber(fiber, vmvalue.NilValue, vmvalue.ResumeValue)
+}
+
+// awaitFiber suspends the async function until the awaited value on top of the stack settles,
+// values other than promises are awaited as fulfilled promises.
+func awaitFiber() (ok bool) {
+	fiber := GlobalVM.Fiber
+	if fiber == nil || fiber.Promise == nil || !GlobalVM.Frames[GlobalVM.FrameCount-1].FiberBase {
+		return runtimeError("Can't await outside of an async function.")
+	}
+
+	reaction := vmvalue.PromiseReaction{OnFulfilled: vmvalue.NilValue, OnRejected: vmvalue.NilValue, Fiber: fiber}
+	if awaited := Peek(0); vmvalue.IsPromise(awaited) {
+		promiseThen(vmvalue.ValueAsPromise(awaited), reaction)
+	} else {
+		enqueueMicrotask(reaction, vmvalue.PromiseFulfilled, awaited)
+	}
+
+	suspendFiber(fiber, GlobalVM.FrameCount-1)
+	return leaveFiber(fiber, vmvalue.NilValue, true)
+}
@@ -0,0 +1,111 @@
+package vm
+
+import (
+	"github.com/leonardinius/goloxvm/internal/vm/vmvalue"
+)
+
+// userProtocol runs `toString()`, `equals(other)` and `hash()` methods for vmvalue printing, equality and hashing.
+type userProtocol struct{}
+
+var _ vmvalue.Protocol = userProtocol{}
+
+func (userProtocol) ToString(instance *vmvalue.ObjInstance) (*vmvalue.ObjString, bool) {
+	defer enterProtocol()()
+	result, found := callProtocolMethod(instance, GlobalVM.ToStringString)
+	if !found {
+		return nil, false
+	}
+	if !vmvalue.IsString(result) {
+		protocolError("toString() must return a string.")
+		return nil, false
+	}
+	return vmvalue.ValueAsString(result), true
+}
+
+func (userProtocol) Equals(instance *vmvalue.ObjInstance, other vmvalue.Value) (equal, found bool) {
+	defer enterProtocol()()
+	result, found := callProtocolMethod(instance, GlobalVM.EqualsString, other)
+	return found && isTruey(result), found
+}
+
+func (userProtocol) Hash(instance *vmvalue.ObjInstance) (uint64, bool) {
+	defer enterProtocol()()
+	result, found := callProtocolMethod(instance, GlobalVM.HashString)
+	if !found {
+		return 0, false
+	}
+	if !vmvalue.IsNumber(result) && !vmvalue.IsString(result) {
+		protocolError("hash() must return a number or a string.")
+		return 0, false
+	}
+	return vmvalue.HashValue(result), true
+}
+
+// enterProtocol marks the protocol method call in progress, returns the function to leave it.
+func enterProtocol() func() {
+	GlobalVM.ProtocolDepth++
+	return func() { GlobalVM.ProtocolDepth-- }
+}
+
+// callProtocolMethod calls the method of the instance class and runs it to completion.
+// Once a protocol call has failed, no more user code is run until the error is reported.
+func callProtocolMethod(instance *vmvalue.ObjInstance, name *vmvalue.ObjString, args ...vmvalue.Value) (vmvalue.Value, bool) {
+	if GlobalVM.ProtocolError != nil {
+		return vmvalue.NilValue, false
+	}
+	method, found := instance.Klass.Methods.Get(name)
+	if !found {
+		return vmvalue.NilValue, false
+	}
+
+	baseFrame := GlobalVM.FrameCount
+	Push(vmvalue.ObjAsValue(instance))
+	for _, arg := range args {
+		Push(arg)
+	}
+	if !Call(vmvalue.ValueAsClosure(method), byte(len(args))) {
+		GlobalVM.ProtocolError = runError()
+		return vmvalue.NilValue, false
+	}
+	if GlobalVM.FrameCount == baseFrame {
+		// generator method has returned the fiber without running
+		return Pop(), true
+	}
+
+	result, err := run(baseFrame)
+	if err != nil {
+		GlobalVM.ProtocolError = err
+		return vmvalue.NilValue, false
+	}
+	return result, true
+}
+
+func protocolError(message string) {
+	runtimeError("%s", message)
+	GlobalVM.ProtocolError = InterpretRuntimeError
+}
+
+// protocolOK reports whether no protocol method has failed during the current instruction.
+func protocolOK() bool {
+	return GlobalVM.ProtocolError == nil
+}
+
+// userStringConcat concatenates a string with an instance converted by its `toString()` method.
+func userStringConcat() (ok bool) {
+	for distance := range 2 {
+		if value := Peek(byte(distance)); vmvalue.IsInstance(value) {
+			str, found := userProtocol{}.ToString(vmvalue.ValueAsInstance(value))
+			if !protocolOK() {
+				return false
+			}
+			if found {
+				SetStackAt(GlobalVM.StackTop-1-distance, vmvalue.ObjAsValue(str))
+			}
+		}
+	}
+
+	if !vmvalue.IsString(Peek(0)) || !vmvalue.IsString(Peek(1)) {
+		return runtimeError("Operands must be two numbers or two strings.")
+	}
+	return stringConcat()
+}
@@ -0,0 +1,79 @@
+package vm
+
+import (
+	"os"
+	"strings"
+
+	"github.com/leonardinius/goloxvm/internal/vm/vmstd"
+	"github.com/leonardinius/goloxvm/internal/vm/vmvalue"
+)
+
+// Sandbox restricts which host process facilities are exposed to scripts.
+// Zero value allows everything.
+type Sandbox struct {
+	NoExit bool // exit(code)
+	NoEnv  bool // getenv(name), setenv(name, value)
+	NoExec bool // exec(cmd, args)
+}
+
+// LoadSandboxConfigFromEnv reads GLOX_SANDBOX, comma separated list of facilities to disable:
+// "exit", "env", "exec" or "all".
+func LoadSandboxConfigFromEnv() Sandbox {
+	sandbox := Sandbox{}
+	for _, facility := range strings.Split(os.Getenv("GLOX_SANDBOX"), ",") {
+		switch strings.TrimSpace(facility) {
+		case "exit":
+			sandbox.NoExit = true
+		case "env":
+			sandbox.NoEnv = true
+		case "exec":
+			sandbox.NoExec = true
+		case "all":
+			sandbox = Sandbox{NoExit: true, NoEnv: true, NoExec: true}
+		}
+	}
+	return sandbox
+}
+
+func defineProcessNatives() {
+	defineNative1("exit", func(code vmvalue.Value) (vmvalue.Value, error) {
+		if GlobalVM.Sandbox.NoExit {
+			return vmvalue.NilValue, &vmstd.SandboxError{Name: "exit"}
+		}
+		return vmstd.StdExit(code)
+	})
+	defineNative1("getenv", func(name vmvalue.Value) (vmvalue.Value, error) {
+		if GlobalVM.Sandbox.NoEnv {
+			return vmvalue.NilValue, &vmstd.SandboxError{Name: "getenv"}
+		}
+		return vmstd.StdGetenv(name)
+	})
+	defineNative2("setenv", func(name, value vmvalue.Value) (vmvalue.Value, error) {
+		if GlobalVM.Sandbox.NoEnv {
+			return vmvalue.NilValue, &vmstd.SandboxError{Name: "setenv"}
+		}
+		return vmstd.StdSetenv(name, value)
+	})
+	defineNative2("exec", func(command, args vmvalue.Value) (vmvalue.Value, error) {
+		if GlobalVM.Sandbox.NoExec {
+			return vmvalue.NilValue, &vmstd.SandboxError{Name: "exec"}
+		}
+		return vmstd.StdExec(command, args)
+	})
+}
+
+// DefineArgs sets `args` global to the list of script arguments.
+func DefineArgs(args []string) {
+	list := vmvalue.NewList(vmvalue.NewValueArray())
+	Push(vmvalue.ObjAsValue(list))
+	for _, arg := range args {
+		Push(vmvalue.ObjAsValue(vmvalue.StringInternCopy([]byte(arg))))
+		list.Items.Write(Peek(0))
+		Pop()
+	}
+	nameObj := vmvalue.StringInternCopy([]byte("args"))
+	Push(vmvalue.ObjAsValue(nameObj))
+	SetGlobal(nameObj, Peek(1))
+	Pop()
+	Pop()
+}
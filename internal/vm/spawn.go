@@ -0,0 +1,517 @@
+package vm
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/leonardinius/goloxvm/internal/vm/vmvalue"
+)
+
+// spawnedVMEnv is set for the child process which runs the spawned VM.
+const spawnedVMEnv = "GLOX_SPAWNED_VM"
+
+// pprofEnvPrefix starts the profiler settings, which are not passed to the spawned VM,
+// otherwise it overwrites the profiles written by the parent.
+const pprofEnvPrefix = "GLOX_PPROF"
+
+var (
+	errSpawnFunction = errors.New("spawn: first argument must be a function")
+	errSpawnCapture  = errors.New("spawn: function can't capture local variables")
+	errParentExited  = errors.New("parent VM has exited")
+)
+
+type packetOp byte
+
+const (
+	_ packetOp = iota
+	packetStart
+	packetNewChannel
+	packetSend
+	packetReceive
+	packetClose
+	packetReply
+	packetResult
+)
+
+// packet is exchanged by the spawned VM and its parent over the pipes.
+// The parent starts the VM, the VM forwards the channel operations and finally sends its result.
+type packet struct {
+	ID       uint64
+	Op       packetOp
+	Channel  int64
+	Capacity int
+	Message  Message
+	OK       bool
+	Error    string
+
+	Function    *FunctionMessage
+	Args        []Message
+	GlobalNames [][]byte
+	Globals     []Message
+}
+
+// spawnedVM is the child process running the isolated VM. The VM heap, the intern table
+// and the GC are global to the process, so each VM gets a process of its own.
+type spawnedVM struct {
+	cmd    *exec.Cmd
+	stderr bytes.Buffer
+	site   string // the stack frame which has called spawn
+
+	mu      sync.Mutex // guards encoder, the relay goroutines reply concurrently
+	to      *os.File
+	encoder *gob.Encoder
+}
+
+// spawnResult is delivered to the event loop once the spawned VM has exited.
+type spawnResult struct {
+	vm      *spawnedVM
+	message Message
+	ok      bool
+	reason  string
+	// copyError is set when the result can't be copied back to this VM
+	copyError string
+}
+
+func defineSpawnNative() {
+	defineNativeVariadic("spawn", 1, spawn)
+}
+
+// spawn runs the function with the copies of the arguments in the new VM and returns the promise
+// of its result. The VM starts with the copies of the global functions and values.
+func spawn(args ...vmvalue.Value) (vmvalue.Value, error) {
+	if !vmvalue.IsClosure(args[0]) {
+		return vmvalue.NilValue, errSpawnFunction
+	}
+	closure := vmvalue.ValueAsClosure(args[0])
+	if closure.Fn.UpvalueCount > 0 {
+		return vmvalue.NilValue, errSpawnCapture
+	}
+
+	start := packet{Op: packetStart}
+	var err error
+	if start.Function, err = encodeFunction(closure.Fn); err != nil {
+		return vmvalue.NilValue, fmt.Errorf("spawn: %w", err)
+	}
+	for _, arg := range args[1:] {
+		message, err := encodeMessage(arg)
+		if err != nil {
+			return vmvalue.NilValue, fmt.Errorf("spawn: %w", err)
+		}
+		start.Args = append(start.Args, message)
+	}
+	start.GlobalNames, start.Globals = encodeGlobals()
+
+	spawned, from, err := startSpawnedVM(&start)
+	if err != nil {
+		return vmvalue.NilValue, fmt.Errorf("spawn: %w", err)
+	}
+
+	spawned.site = currentSite()
+	loop := &GlobalVM.Loop
+	if loop.spawned == nil {
+		loop.spawned = make(map[*spawnedVM]*vmvalue.ObjPromise)
+	}
+	promise := vmvalue.NewPromise()
+	loop.spawned[spawned] = promise
+	channels().trackSpawned(1)
+	go spawned.relay(from, channels(), loop.completionQueue())
+	return vmvalue.ObjAsValue(promise), nil
+}
+
+// encodeGlobals copies the globals which can cross the VM boundary: functions which capture
+// nothing, strings, numbers, lists, maps and channels. Natives are defined by every VM.
+func encodeGlobals() (names [][]byte, globals []Message) {
+	vmvalue.EachGlobal(func(name *vmvalue.ObjString, value vmvalue.Value) {
+		var message Message
+		if vmvalue.IsClosure(value) {
+			closure := vmvalue.ValueAsClosure(value)
+			if closure.Fn.UpvalueCount > 0 {
+				return
+			}
+			fn, err := encodeFunction(closure.Fn)
+			if err != nil {
+				return
+			}
+			message = Message{Kind: MessageFunction, Function: fn}
+		} else {
+			var err error
+			if message, err = encodeMessage(value); err != nil {
+				return
+			}
+		}
+		names = append(names, slices.Clone(name.Chars))
+		globals = append(globals, message)
+	})
+	return names, globals
+}
+
+// startSpawnedVM starts the child process and sends it the start packet, the child reads
+// the packets from fd 3 and writes its own to fd 4.
+func startSpawnedVM(start *packet) (*spawnedVM, *os.File, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, nil, err
+	}
+	toChild, toChildWriter, err := os.Pipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	fromChild, fromChildWriter, err := os.Pipe()
+	if err != nil {
+		closeFiles(toChild, toChildWriter)
+		return nil, nil, err
+	}
+
+	spawned := &spawnedVM{to: toChildWriter, encoder: gob.NewEncoder(toChildWriter)}
+	spawned.cmd = exec.Command(executable) //nolint:gosec // the same executable runs the spawned VM
+	spawned.cmd.Env = append(spawnedVMEnviron(), spawnedVMEnv+"=1")
+	spawned.cmd.Stdout = os.Stdout
+	spawned.cmd.Stderr = &spawned.stderr
+	spawned.cmd.ExtraFiles = []*os.File{toChild, fromChildWriter}
+	err = spawned.cmd.Start()
+	// the child has its own copies of its ends of the pipes
+	closeFiles(toChild, fromChildWriter)
+	if err != nil {
+		closeFiles(toChildWriter, fromChild)
+		return nil, nil, err
+	}
+
+	if err = spawned.write(start); err != nil {
+		_ = spawned.cmd.Process.Kill()
+		_ = spawned.cmd.Wait()
+		closeFiles(toChildWriter, fromChild)
+		return nil, nil, err
+	}
+	return spawned, fromChild, nil
+}
+
+// spawnedVMEnviron is the environment of the spawned VM without the profiler settings.
+func spawnedVMEnviron() []string {
+	return slices.DeleteFunc(os.Environ(), func(variable string) bool {
+		return strings.HasPrefix(variable, pprofEnvPrefix)
+	})
+}
+
+func closeFiles(files ...*os.File) {
+	for _, f := range files {
+		_ = f.Close()
+	}
+}
+
+func (s *spawnedVM) write(p *packet) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.encoder.Encode(p)
+}
+
+// relay serves the channel operations of the spawned VM until it exits, then delivers its result.
+// It runs on its own goroutine and never touches the heap of the VM.
+func (s *spawnedVM) relay(from *os.File, backend channelBackend, completions *completionQueue) {
+	defer closeFiles(from)
+
+	result := spawnResult{vm: s}
+	decoder := gob.NewDecoder(from)
+	for {
+		var request packet
+		if err := decoder.Decode(&request); err != nil {
+			break
+		}
+		if request.Op == packetResult {
+			result.message, result.ok, result.copyError = request.Message, true, request.Error
+			continue
+		}
+		// the operations start in the order the VM has sent them
+		serveChannelOp(backend, &request, func(reply packet) {
+			_ = s.write(&reply)
+		})
+	}
+
+	err := s.cmd.Wait()
+	s.mu.Lock()
+	closeFiles(s.to)
+	s.mu.Unlock()
+	if !result.ok {
+		result.reason = spawnFailure(s.stderr.Bytes(), err)
+	}
+	backend.trackSpawned(-1)
+	completions.deliver(result)
+}
+
+// spawnFailure is the first line the spawned VM has reported to stderr, which is the runtime error.
+func spawnFailure(stderr []byte, err error) string {
+	if line, _, _ := bytes.Cut(stderr, []byte("\n")); len(line) > 0 {
+		return string(line)
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return "spawned VM has exited without result"
+}
+
+// serveChannelOp starts the channel operation of the spawned VM, the reply is sent once it completes.
+func serveChannelOp(backend channelBackend, request *packet, reply func(packet)) {
+	response := packet{ID: request.ID, Op: packetReply}
+	fail := func(err error) {
+		if err != nil {
+			response.Error = err.Error()
+		}
+		reply(response)
+	}
+	switch request.Op {
+	case packetNewChannel:
+		var err error
+		response.Channel, err = backend.newChannel(request.Capacity)
+		fail(err)
+	case packetSend:
+		backend.send(request.Channel, request.Message, fail)
+	case packetReceive:
+		backend.receive(request.Channel, func(message Message, ok bool, err error) {
+			response.Message, response.OK = message, ok
+			fail(err)
+		})
+	case packetClose:
+		fail(backend.close(request.Channel))
+	default:
+		fail(fmt.Errorf("unexpected packet %d", request.Op))
+	}
+}
+
+// settle settles the promise of the spawned VM which has exited. The result which can't be
+// copied back is the runtime error of this VM, as the spawned VM has failed to return it.
+func (result spawnResult) settle() error {
+	loop := &GlobalVM.Loop
+	promise, found := loop.spawned[result.vm]
+	if !found {
+		// the VM was killed after the script has failed
+		return nil
+	}
+	switch {
+	case result.copyError != "":
+		loopError(result.vm.site, "spawn: %s", result.copyError)
+		return InterpretRuntimeError
+	case result.ok:
+		settlePromise(promise, vmvalue.PromiseFulfilled, decodeMessage(&result.message))
+	default:
+		reason := vmvalue.StringInternCopy([]byte(result.reason))
+		settlePromiseAt(promise, vmvalue.PromiseRejected, vmvalue.ObjAsValue(reason), result.vm.site)
+	}
+	delete(loop.spawned, result.vm)
+	return nil
+}
+
+// killSpawned stops the spawned VMs once the script has failed.
+func killSpawned() {
+	loop := &GlobalVM.Loop
+	for spawned := range loop.spawned {
+		_ = spawned.cmd.Process.Kill()
+	}
+	clear(loop.spawned)
+}
+
+// remoteChannels is the channel backend of the spawned VM, the operations are served by the parent.
+type remoteChannels struct {
+	mu      sync.Mutex // guards all fields, the relay goroutines of nested VMs call concurrently
+	encoder *gob.Encoder
+	pending map[uint64]chan packet
+	lastID  uint64
+	err     error
+}
+
+var _ channelBackend = (*remoteChannels)(nil)
+
+// start sends the request right away, so the operations reach the parent in order,
+// the reply is delivered to the returned channel.
+func (r *remoteChannels) start(request packet) (<-chan packet, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return nil, r.err
+	}
+	r.lastID++
+	request.ID = r.lastID
+	reply := make(chan packet, 1)
+	r.pending[request.ID] = reply
+	if err := r.encoder.Encode(&request); err != nil {
+		delete(r.pending, request.ID)
+		return nil, err
+	}
+	return reply, nil
+}
+
+func (r *remoteChannels) call(request packet) (packet, error) {
+	reply, err := r.start(request)
+	if err != nil {
+		return packet{}, err
+	}
+	return waitReply(reply)
+}
+
+// callAsync sends the request and calls done with the reply on another goroutine.
+func (r *remoteChannels) callAsync(request packet, done func(packet, error)) {
+	reply, err := r.start(request)
+	if err != nil {
+		done(packet{}, err)
+		return
+	}
+	go func() {
+		done(waitReply(reply))
+	}()
+}
+
+func waitReply(reply <-chan packet) (packet, error) {
+	response, ok := <-reply
+	if !ok {
+		return packet{}, errParentExited
+	}
+	if response.Error != "" {
+		return response, errors.New(response.Error)
+	}
+	return response, nil
+}
+
+// readReplies delivers the replies of the parent to the waiting calls.
+func (r *remoteChannels) readReplies(decoder *gob.Decoder) {
+	for {
+		var response packet
+		if err := decoder.Decode(&response); err != nil {
+			break
+		}
+		r.mu.Lock()
+		reply, found := r.pending[response.ID]
+		delete(r.pending, response.ID)
+		r.mu.Unlock()
+		if found {
+			reply <- response
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err = errParentExited
+	for id, reply := range r.pending {
+		close(reply)
+		delete(r.pending, id)
+	}
+}
+
+func (r *remoteChannels) newChannel(capacity int) (int64, error) {
+	response, err := r.call(packet{Op: packetNewChannel, Capacity: capacity})
+	return response.Channel, err
+}
+
+func (r *remoteChannels) send(id int64, message Message, done func(err error)) {
+	r.callAsync(packet{Op: packetSend, Channel: id, Message: message}, func(_ packet, err error) {
+		done(err)
+	})
+}
+
+func (r *remoteChannels) receive(id int64, done func(message Message, ok bool, err error)) {
+	r.callAsync(packet{Op: packetReceive, Channel: id}, func(response packet, err error) {
+		done(response.Message, response.OK, err)
+	})
+}
+
+func (r *remoteChannels) close(id int64) error {
+	_, err := r.call(packet{Op: packetClose, Channel: id})
+	return err
+}
+
+// trackSpawned is a no-op, the parent VM keeps waiting for this VM, which waits for its own spawned VMs.
+func (r *remoteChannels) trackSpawned(int) {}
+
+// idle is a no-op, the parent VM fails the waiting operations once nothing else can complete them.
+func (r *remoteChannels) idle() {}
+
+// IsSpawnedVM reports whether the process runs the VM started by `spawn`.
+func IsSpawnedVM() bool {
+	return os.Getenv(spawnedVMEnv) == "1"
+}
+
+// RunSpawned runs the function sent by the parent VM and sends back the copy of its result.
+// The runtime errors are reported to stderr, which the parent turns into the rejection reason.
+func RunSpawned() error {
+	// the scripts running `exec` start regular VMs
+	_ = os.Unsetenv(spawnedVMEnv)
+	from := os.NewFile(3, "spawn-in")
+	to := os.NewFile(4, "spawn-out")
+	defer closeFiles(from, to)
+
+	decoder := gob.NewDecoder(from)
+	var start packet
+	if err := decoder.Decode(&start); err != nil {
+		return fmt.Errorf("spawn: %w", err)
+	}
+	remote := &remoteChannels{encoder: gob.NewEncoder(to), pending: make(map[uint64]chan packet)}
+	GlobalVM.Channels = remote
+	go remote.readReplies(decoder)
+
+	value, err := runSpawnedFunction(&start)
+	if err != nil {
+		return err
+	}
+	// the parent VM reports the result which can't be copied as its own runtime error
+	result := packet{Op: packetResult}
+	if result.Message, err = encodeMessage(value); err != nil {
+		result.Error = err.Error()
+	}
+	remote.mu.Lock()
+	defer remote.mu.Unlock()
+	return remote.encoder.Encode(&result)
+}
+
+func runSpawnedFunction(start *packet) (vmvalue.Value, error) {
+	for i, name := range start.GlobalNames {
+		nameObj := vmvalue.StringInternCopy(name)
+		Push(vmvalue.ObjAsValue(nameObj))
+		Push(decodeMessage(&start.Globals[i]))
+		if vmvalue.IsFunction(Peek(0)) {
+			SetStackAt(GlobalVM.StackTop-1, vmvalue.ObjAsValue(vmvalue.NewClosure(vmvalue.ValueAsFunction(Peek(0)))))
+		}
+		SetGlobal(nameObj, Peek(0))
+		Pop()
+		Pop()
+	}
+
+	Push(vmvalue.ObjAsValue(decodeFunction(start.Function)))
+	SetStackAt(GlobalVM.StackTop-1, vmvalue.ObjAsValue(vmvalue.NewClosure(vmvalue.ValueAsFunction(Peek(0)))))
+	for i := range start.Args {
+		Push(decodeMessage(&start.Args[i]))
+	}
+	argCount := byte(len(start.Args))
+	if !CallValue(Peek(argCount), argCount) {
+		return vmvalue.NilValue, runError()
+	}
+	value := Peek(0)
+	if GlobalVM.FrameCount > 0 {
+		var err error
+		if value, err = run(0); err != nil {
+			return vmvalue.NilValue, err
+		}
+		Push(value)
+	}
+
+	// the result of the async function is known once its promise settles, its rejection is the result
+	if vmvalue.IsPromise(value) {
+		vmvalue.ValueAsPromise(value).Handled = true
+	}
+	if err := runEventLoop(); err != nil {
+		return vmvalue.NilValue, err
+	}
+	value = Pop()
+	if vmvalue.IsPromise(value) {
+		promise := vmvalue.ValueAsPromise(value)
+		if promise.State == vmvalue.PromiseRejected {
+			runtimeError("Promise rejected: %s", vmvalue.SprintValue(promise.Value))
+			return vmvalue.NilValue, InterpretRuntimeError
+		}
+		value = promise.Value
+	}
+	return value, nil
+}
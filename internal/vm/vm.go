@@ -1,10 +1,12 @@
 package vm
 
 import (
+	"errors"
 	"fmt"
 	"math"
 	"os"
 	"runtime"
+	"unicode/utf8"
 
 	"github.com/leonardinius/goloxvm/internal/vm/bytecode"
 	"github.com/leonardinius/goloxvm/internal/vm/vmchunk"
@@ -24,6 +26,19 @@ type CallFrame struct {
 	Closure  *vmvalue.ObjClosure
 	IP       int
 	SlotsTop int
+	ArgCount int
+
+	// InvokeResult is set for the getter invoked as method `obj.getter(args)`,
+	// the returned value is called with InvokeArgCount arguments left on the stack.
+	InvokeResult   bool
+	InvokeArgCount byte
+
+	// DiscardResult is set for the `__setindex` operator call,
+	// the assigned value left below the receiver is the result.
+	DiscardResult bool
+
+	// FiberBase is set for the bottom frame of the running fiber, returning from it finishes the fiber.
+	FiberBase bool
 }
 
 // VM is the virtual machine.
@@ -34,6 +49,45 @@ type VM struct {
 	StackTop     int
 	OpenUpvalues *vmvalue.ObjUpvalue
 	InitString   *vmvalue.ObjString
+	Sandbox      Sandbox
+	ExitError    *vmstd.ExitError
+
+	// user defined protocol method names and the error of the failed protocol call
+	ToStringString *vmvalue.ObjString
+	EqualsString   *vmvalue.ObjString
+	HashString     *vmvalue.ObjString
+	IteratorString *vmvalue.ObjString
+	HasNextString  *vmvalue.ObjString
+	NextString     *vmvalue.ObjString
+	ResumeString   *vmvalue.ObjString
+	IsDoneString   *vmvalue.ObjString
+	ThenString     *vmvalue.ObjString
+	CatchString    *vmvalue.ObjString
+	ResolveString  *vmvalue.ObjString
+	RejectString   *vmvalue.ObjString
+	SendString     *vmvalue.ObjString
+	ReceiveString  *vmvalue.ObjString
+	CloseString    *vmvalue.ObjString
+	NameString     *vmvalue.ObjString
+	OrdinalString  *vmvalue.ObjString
+	ProtocolError  error
+	ProtocolDepth  int
+
+	// user defined operator method names
+	OperatorStrings [operatorCount]*vmvalue.ObjString
+
+	// the running fiber, nil for the main script
+	Fiber *vmvalue.ObjFiber
+	// RunBaseFrame is the base frame of the innermost run, the fibers started below it can't yield.
+	// PendingYield is set by `Fiber.suspend(value)` to yield once the native has returned.
+	RunBaseFrame int
+	PendingYield bool
+
+	// timers and promise reactions run once the script has finished
+	Loop EventLoop
+
+	// Channels carries the messages between the isolated VMs
+	Channels channelBackend
 }
 
 var GlobalVM VM
@@ -68,8 +122,53 @@ func InitVM() {
 	vmvalue.InitGlobals()
 	vmvalue.InitObjects()
 	GlobalVM.InitString = vmvalue.StringInternCopy([]byte("init"))
+	GlobalVM.ToStringString = vmvalue.StringInternCopy([]byte("toString"))
+	GlobalVM.EqualsString = vmvalue.StringInternCopy([]byte("equals"))
+	GlobalVM.HashString = vmvalue.StringInternCopy([]byte("hash"))
+	GlobalVM.IteratorString = vmvalue.StringInternCopy([]byte("iterator"))
+	GlobalVM.HasNextString = vmvalue.StringInternCopy([]byte("hasNext"))
+	GlobalVM.NextString = vmvalue.StringInternCopy([]byte("next"))
+	GlobalVM.ResumeString = vmvalue.StringInternCopy([]byte("resume"))
+	GlobalVM.IsDoneString = vmvalue.StringInternCopy([]byte("isDone"))
+	GlobalVM.ThenString = vmvalue.StringInternCopy([]byte("then"))
+	GlobalVM.CatchString = vmvalue.StringInternCopy([]byte("catch"))
+	GlobalVM.ResolveString = vmvalue.StringInternCopy([]byte("resolve"))
+	GlobalVM.RejectString = vmvalue.StringInternCopy([]byte("reject"))
+	GlobalVM.SendString = vmvalue.StringInternCopy([]byte("send"))
+	GlobalVM.ReceiveString = vmvalue.StringInternCopy([]byte("receive"))
+	GlobalVM.CloseString = vmvalue.StringInternCopy([]byte("close"))
+	GlobalVM.NameString = vmvalue.StringInternCopy([]byte("name"))
+	GlobalVM.OrdinalString = vmvalue.StringInternCopy([]byte("ordinal"))
+	vmvalue.SetProtocol(userProtocol{})
+	initOperatorStrings()
 	defineNative0("clock", vmstd.StdClockNative)
 	defineNative1("formatNumber", vmstd.StdFormatNumber)
+	defineNative1("len", vmstd.StdLen)
+	defineNative2("push", vmstd.StdPush)
+	defineNative1("keys", vmstd.StdKeys)
+	defineNativeOptional3("range", 1, vmstd.StdRange)
+	defineNative1("jsonParse", vmstd.StdJSONParse)
+	defineNativeOptional2("jsonStringify", 1, vmstd.StdJSONStringify)
+	defineNative1("toBigInt", vmstd.StdToBigInt)
+	defineNative1("toDecimal", vmstd.StdToDecimal)
+	defineNative1("toNumber", vmstd.StdToNumber)
+	defineNative1("typeOf", vmstd.StdTypeOf)
+	defineNative2("instanceOf", vmstd.StdInstanceOf)
+	defineNative1("classOf", vmstd.StdClassOf)
+	defineNative1("className", vmstd.StdClassName)
+	defineNative1("superclassOf", vmstd.StdSuperclassOf)
+	defineNative1("fields", vmstd.StdFields)
+	defineNative1("methods", vmstd.StdMethods)
+	defineNative2("hasField", vmstd.StdHasField)
+	defineNative2("getField", vmstd.StdGetField)
+	defineNative3("setField", vmstd.StdSetField)
+	defineFiberClass()
+	definePromiseClass()
+	defineTimerNatives()
+	defineChannelClass()
+	defineSpawnNative()
+	defineProcessNatives()
+	DefineArgs(nil)
 	resetStack()
 }
 
@@ -77,16 +176,54 @@ func FreeVM() {
 	vmvalue.FreeGlobals()
 	vmvalue.FreeInternStrings()
 	GlobalVM.InitString = nil
+	GlobalVM.ToStringString = nil
+	GlobalVM.EqualsString = nil
+	GlobalVM.HashString = nil
+	GlobalVM.IteratorString = nil
+	GlobalVM.HasNextString = nil
+	GlobalVM.NextString = nil
+	GlobalVM.ResumeString = nil
+	GlobalVM.IsDoneString = nil
+	GlobalVM.ThenString = nil
+	GlobalVM.CatchString = nil
+	GlobalVM.ResolveString = nil
+	GlobalVM.RejectString = nil
+	GlobalVM.SendString = nil
+	GlobalVM.ReceiveString = nil
+	GlobalVM.CloseString = nil
+	GlobalVM.NameString = nil
+	GlobalVM.OrdinalString = nil
+	vmvalue.SetProtocol(nil)
+	freeOperatorStrings()
 	vmvalue.FreeObjects()
 	resetStack()
 }
 
 func resetStack() {
+	abandonFibers()
+	clearEventLoop()
 	GlobalVM.StackTop = 0
 	GlobalVM.FrameCount = 0
 	GlobalVM.OpenUpvalues = nil
 }
 
+// runError reports why Run has stopped: exit requested by the script or runtime error.
+func runError() error {
+	if err := GlobalVM.ProtocolError; err != nil {
+		if GlobalVM.ProtocolDepth == 0 {
+			// the failed protocol method has left its frames on the stack
+			GlobalVM.ProtocolError = nil
+			resetStack()
+		}
+		return err
+	}
+	if exitErr := GlobalVM.ExitError; exitErr != nil {
+		GlobalVM.ExitError = nil
+		return exitErr
+	}
+	return InterpretRuntimeError
+}
+
 func Interpret(code []byte) (vmvalue.Value, error) {
 	var fn *vmvalue.ObjFunction
 	var ok bool
@@ -101,7 +238,23 @@ func Interpret(code []byte) (vmvalue.Value, error) {
 	Push(vmvalue.ObjAsValue(closure))
 	Call(closure, 0)
 
-	return Run()
+	value, err := Run()
+	if err != nil {
+		return value, err
+	}
+	// the pending timers and promise reactions run before the script is done
+	if err = runEventLoop(); err != nil {
+		return vmvalue.NilValue, err
+	}
+	return value, nil
+}
+
+// Check compiles the code without running it, the type errors are reported as the compile errors.
+func Check(code []byte) error {
+	if !vmcompiler.Check(code) {
+		return InterpretCompileError
+	}
+	return nil
 }
 
 func traceInstruction(frame *CallFrame, chunk *vmchunk.Chunk) {
@@ -149,6 +302,12 @@ func CallValue(callee vmvalue.Value, argCount byte) (ok bool) {
 			return CallNative(native, argCount)
 		case vmvalue.ObjTypeClass:
 			klass := vmvalue.ValueAsClass(callee)
+			if klass.IsTrait {
+				return runtimeError("Can't instantiate trait '%s'.", klass.Name.Chars)
+			}
+			if klass.IsAbstract {
+				return runtimeError("Can't instantiate abstract class '%s'.", klass.Name.Chars)
+			}
 			instance := vmvalue.ObjAsValue(vmvalue.NewInstance(klass))
 			iArgs := int(argCount)
 			GlobalVM.Stack[GlobalVM.StackTop-iArgs-1] = instance
@@ -172,6 +331,21 @@ func CallValue(callee vmvalue.Value, argCount byte) (ok bool) {
 func Invoke(name *vmvalue.ObjString, argCount byte) (ok bool) {
 	receiver := Peek(argCount)
 
+	if vmvalue.IsClass(receiver) {
+		return InvokeStatic(vmvalue.ValueAsClass(receiver), name, argCount)
+	}
+	if vmvalue.IsIterator(receiver) {
+		return invokeIterator(vmvalue.ValueAsIterator(receiver), name, argCount)
+	}
+	if vmvalue.IsFiber(receiver) {
+		return invokeFiber(vmvalue.ValueAsFiber(receiver), name, argCount)
+	}
+	if vmvalue.IsPromise(receiver) {
+		return invokePromise(vmvalue.ValueAsPromise(receiver), name, argCount)
+	}
+	if vmvalue.IsChannel(receiver) {
+		return invokeChannel(vmvalue.ValueAsChannel(receiver), name, argCount)
+	}
 	if !vmvalue.IsInstance(receiver) {
 		return runtimeError("Only instances have methods.")
 	}
@@ -188,11 +362,52 @@ func Invoke(name *vmvalue.ObjString, argCount byte) (ok bool) {
 
 func InvokeFromClass(klass *vmvalue.ObjClass, name *vmvalue.ObjString, argCount byte) (ok bool) {
 	var method vmvalue.Value
-	if method, ok = klass.Methods.Get(name); !ok {
-		return runtimeError("Undefined property '%s'.", name.Chars)
+	if method, ok = klass.Methods.Get(name); ok {
+		return Call(vmvalue.ValueAsClosure(method), argCount)
+	}
+	if getter, found := klass.Getters.Get(name); found {
+		return invokeGetter(vmvalue.ValueAsClosure(getter), argCount)
+	}
+
+	return runtimeError("Undefined property '%s'.", vmvalue.PropertyName(name))
+}
+
+// InvokeStatic calls static method or class field of the class, the class is the receiver.
+func InvokeStatic(klass *vmvalue.ObjClass, name *vmvalue.ObjString, argCount byte) (ok bool) {
+	member, isField, found := findStatic(klass, name)
+	if !found {
+		return runtimeError("Undefined property '%s'.", vmvalue.PropertyName(name))
 	}
+	if isField {
+		GlobalVM.Stack[GlobalVM.StackTop-int(argCount)-1] = member
+	}
+	// native static methods like `Fiber.new` replace the class with their result
+	return CallValue(member, argCount)
+}
 
-	return Call(vmvalue.ValueAsClosure(method), argCount)
+// findStatic looks the class field or the static method up in the class and its superclasses.
+// The statics are not copied by inherit, so the subclass sees the later changes of the superclass.
+func findStatic(klass *vmvalue.ObjClass, name *vmvalue.ObjString) (member vmvalue.Value, isField, found bool) {
+	for ; klass != nil; klass = klass.Superclass {
+		if member, found = klass.Fields.Get(name); found {
+			return member, true, true
+		}
+		if member, found = klass.StaticMethods.Get(name); found {
+			return member, false, true
+		}
+	}
+	return vmvalue.NilValue, false, false
+}
+
+// invokeGetter calls the getter on the receiver, OpReturn calls the result with the arguments.
+func invokeGetter(getter *vmvalue.ObjClosure, argCount byte) (ok bool) {
+	Push(Peek(argCount))
+	if ok = Call(getter, 0); ok {
+		frame := &GlobalVM.Frames[GlobalVM.FrameCount-1]
+		frame.InvokeResult = true
+		frame.InvokeArgCount = argCount
+	}
+	return ok
 }
 
 func CaptureUpvalue(at int) *vmvalue.ObjUpvalue {
@@ -232,17 +447,176 @@ func CloseUpvalues(at int) {
 	}
 }
 
+func inherit(subclass, superclass *vmvalue.ObjClass) {
+	subclass.Superclass = superclass
+	subclass.Abstract.PutAll(&superclass.Abstract)
+	subclass.Methods.PutAll(&superclass.Methods)
+	subclass.Getters.PutAll(&superclass.Getters)
+	subclass.Setters.PutAll(&superclass.Setters)
+}
+
+// mixin copies the trait members into the class, they override the inherited members
+// and they are overridden by the class own members defined later.
+func mixin(class, trait *vmvalue.ObjClass) {
+	class.Methods.PutAll(&trait.Methods)
+	class.Getters.PutAll(&trait.Getters)
+	class.Setters.PutAll(&trait.Setters)
+	class.StaticMethods.PutAll(&trait.StaticMethods)
+	class.Fields.PutAll(&trait.Fields)
+	class.Traits.Write(vmvalue.ObjAsValue(trait))
+	// the trait implements the abstract methods, or requires the methods the class doesn't have yet
+	trait.Methods.Each(func(name *vmvalue.ObjString, _ vmvalue.Value) {
+		class.Abstract.Delete(name)
+	})
+	trait.Abstract.Each(func(name *vmvalue.ObjString, _ vmvalue.Value) {
+		if _, implemented := class.Methods.Get(name); !implemented {
+			class.Abstract.Set(name, vmvalue.TrueValue)
+		}
+	})
+}
+
+// checkAbstractMethods fails if the completed concrete class has not implemented the abstract methods.
+func checkAbstractMethods(class *vmvalue.ObjClass) (ok bool) {
+	if class.IsAbstract || class.IsTrait {
+		return true
+	}
+	var missing *vmvalue.ObjString
+	class.Abstract.Each(func(name *vmvalue.ObjString, _ vmvalue.Value) {
+		if missing == nil {
+			missing = name
+		}
+	})
+	if missing != nil {
+		return runtimeError("Class '%s' must implement abstract method '%s'.",
+			class.Name.Chars, vmvalue.PropertyName(missing))
+	}
+	return true
+}
+
+// checkTraitConflicts fails if two traits of the completed class have different members of the same name,
+// unless the class defines its own member, which overrides both.
+func checkTraitConflicts(class *vmvalue.ObjClass) (ok bool) {
+	traits := class.Traits
+	for j := 1; j < len(traits); j++ {
+		later := vmvalue.ValueAsClass(traits[j])
+		for i := range j {
+			earlier := vmvalue.ValueAsClass(traits[i])
+			for _, members := range [...]struct{ class, earlier, later *vmvalue.Table }{
+				{&class.Methods, &earlier.Methods, &later.Methods},
+				{&class.Getters, &earlier.Getters, &later.Getters},
+				{&class.Setters, &earlier.Setters, &later.Setters},
+				{&class.StaticMethods, &earlier.StaticMethods, &later.StaticMethods},
+			} {
+				if name := conflictingMember(members.class, members.earlier, members.later); name != nil {
+					kind := "Class"
+					if class.IsTrait {
+						kind = "Trait"
+					}
+					return runtimeError("%s '%s' inherits conflicting member '%s' from traits '%s' and '%s'.",
+						kind, class.Name.Chars, vmvalue.PropertyName(name), earlier.Name.Chars, later.Name.Chars)
+				}
+			}
+		}
+	}
+	return true
+}
+
+// conflictingMember returns the name of the member defined differently by both traits,
+// which the class has taken from the later trait.
+func conflictingMember(class, earlier, later *vmvalue.Table) (conflict *vmvalue.ObjString) {
+	later.Each(func(name *vmvalue.ObjString, member vmvalue.Value) {
+		if conflict != nil {
+			return
+		}
+		if other, found := earlier.Get(name); !found || other == member {
+			return
+		}
+		if own, _ := class.Get(name); own == member {
+			conflict = name
+		}
+	})
+	return conflict
+}
+
+// setStaticField assigns the value on top of the stack to declared class field. The inherited field
+// assigned through the subclass becomes the own field of the subclass, the superclass keeps its value.
+func setStaticField(klass *vmvalue.ObjClass, name *vmvalue.ObjString) (ok bool) {
+	if _, isField, found := findStatic(klass, name); !found || !isField {
+		return runtimeError("Only instances have fields.")
+	}
+	klass.Fields.Set(name, Peek(0))
+	value := Pop()
+	Pop()
+	Push(value)
+	return true
+}
+
 func DefineMethod(name *vmvalue.ObjString) {
 	method := Peek(0)
 	klass := vmvalue.ValueAsClass(Peek(1))
 	klass.Methods.Set(name, method)
+	klass.Abstract.Delete(name)
+	Pop()
+}
+
+// defineEnumMember adds the next member to the enum on top of the stack.
+func defineEnumMember(name *vmvalue.ObjString) {
+	enum := vmvalue.ValueAsEnum(Peek(0))
+	member := vmvalue.ObjAsValue(vmvalue.NewEnumMember(enum, name, len(enum.Members)))
+	Push(member)
+	enum.Members.Write(member)
+	enum.ByName.Set(name, member)
+	Pop()
+}
+
+// getEnumProperty replaces the enum on top of the stack with its member,
+// or the enum member with its `name` or `ordinal`.
+func getEnumProperty(name *vmvalue.ObjString) (ok bool) {
+	var value vmvalue.Value
+	var found bool
+	if receiver := Peek(0); vmvalue.IsEnum(receiver) {
+		value, found = vmvalue.ValueAsEnum(receiver).ByName.Get(name)
+	} else {
+		member := vmvalue.ValueAsEnumMember(receiver)
+		switch name {
+		case GlobalVM.NameString:
+			value, found = vmvalue.ObjAsValue(member.Name), true
+		case GlobalVM.OrdinalString:
+			value, found = vmvalue.IntAsValue(int64(member.Ordinal)), true
+		}
+	}
+	if !found {
+		return runtimeError("Undefined property '%s'.", vmvalue.PropertyName(name))
+	}
+	SetStackAt(GlobalVM.StackTop-1, value)
+	return true
+}
+
+// DefineClassMember moves the value on top of the stack into the class table.
+func DefineClassMember(table *vmvalue.Table, name *vmvalue.ObjString) {
+	table.Set(name, Peek(0))
 	Pop()
 }
 
 func BindMethod(klass *vmvalue.ObjClass, name *vmvalue.ObjString) (ok bool) {
+	return bindMethod(&klass.Methods, name)
+}
+
+func bindMethod(methods *vmvalue.Table, name *vmvalue.ObjString) (ok bool) {
 	var method vmvalue.Value
-	if method, ok = klass.Methods.Get(name); !ok {
-		return runtimeError("Undefined property '%s'.", name.Chars)
+	if method, ok = methods.Get(name); !ok {
+		return runtimeError("Undefined property '%s'.", vmvalue.PropertyName(name))
+	}
+	return bindMethodValue(method)
+}
+
+// bindMethodValue replaces the receiver on top of the stack with the method bound to it.
+func bindMethodValue(method vmvalue.Value) (ok bool) {
+	if !vmvalue.IsClosure(method) {
+		// native static method does not need the receiver
+		Pop()
+		Push(method)
+		return true
 	}
 
 	bound := vmvalue.NewBoundMethod(Peek(0), vmvalue.ValueAsClosure(method))
@@ -251,43 +625,147 @@ func BindMethod(klass *vmvalue.ObjClass, name *vmvalue.ObjString) (ok bool) {
 	return true
 }
 
+// GetProperty binds the method or calls the getter on the receiver on top of the stack.
+func GetProperty(klass *vmvalue.ObjClass, name *vmvalue.ObjString) (ok bool) {
+	if getter, found := klass.Getters.Get(name); found {
+		return Call(vmvalue.ValueAsClosure(getter), 0)
+	}
+	return BindMethod(klass, name)
+}
+
+// GetStaticProperty reads class field or binds static method to the receiver on top of the stack.
+func GetStaticProperty(klass *vmvalue.ObjClass, name *vmvalue.ObjString) (ok bool) {
+	member, isField, found := findStatic(klass, name)
+	switch {
+	case !found:
+		return runtimeError("Only instances have properties.")
+	case isField:
+		Pop() // Receiver.
+		Push(member)
+		return true
+	default:
+		return bindMethodValue(member)
+	}
+}
+
 func Call(closure *vmvalue.ObjClosure, argCount byte) (ok bool) {
+	if ok = callFrame(closure, argCount); ok {
+		if closure.Fn.Generator {
+			return callGenerator(closure)
+		}
+		if closure.Fn.Async {
+			return callAsync(closure)
+		}
+	}
+	return ok
+}
+
+// callFrame pushes the call frame of the closure, the callee and arguments are on the stack.
+func callFrame(closure *vmvalue.ObjClosure, argCount byte) (ok bool) {
+	fn := closure.Fn
 	iArgs := int(argCount)
-	if iArgs != closure.Fn.Arity {
-		return runtimeError("Expected %d arguments but got %d.", closure.Fn.Arity, argCount)
+	if iArgs < fn.MinArity || (iArgs > fn.Arity && !fn.Variadic) {
+		return arityError(fn, iArgs)
 	}
 
 	if GlobalVM.FrameCount == MaxCallFrames {
 		return runtimeError("Stack overflow.")
 	}
 
+	slotsTop := GlobalVM.StackTop - iArgs - 1
+	// missing optional arguments, defaults are evaluated by the callee
+	for i := iArgs; i < fn.Arity; i++ {
+		Push(vmvalue.NilValue)
+	}
+	if fn.Variadic {
+		collectRestArgs(slotsTop + 1 + fn.Arity)
+	}
+
 	frame := &GlobalVM.Frames[GlobalVM.FrameCount]
 	GlobalVM.FrameCount++
 	frame.Closure = closure
 	frame.IP = 0
-	frame.SlotsTop = GlobalVM.StackTop - iArgs - 1
+	frame.SlotsTop = slotsTop
+	frame.ArgCount = iArgs
+	frame.InvokeResult = false
+	frame.DiscardResult = false
+	frame.FiberBase = false
 	return true
 }
 
+// collectRestArgs replaces arguments on the stack starting at `from` with the list of them.
+func collectRestArgs(from int) {
+	restCount := GlobalVM.StackTop - from
+	items := vmmem.AllocateSlice[vmvalue.Value](restCount)
+	copy(items, GlobalVM.Stack[from:GlobalVM.StackTop])
+	rest := vmvalue.NewList(items)
+	GlobalVM.StackTop = from
+	Push(vmvalue.ObjAsValue(rest))
+}
+
+func arityError(fn *vmvalue.ObjFunction, argCount int) (ok bool) {
+	switch {
+	case fn.Variadic:
+		return runtimeError("Expected at least %d arguments but got %d.", fn.MinArity, argCount)
+	case fn.MinArity != fn.Arity:
+		return runtimeError("Expected %d to %d arguments but got %d.", fn.MinArity, fn.Arity, argCount)
+	default:
+		return runtimeError("Expected %d arguments but got %d.", fn.Arity, argCount)
+	}
+}
+
 func CallNative(native *vmvalue.ObjNative, argCount byte) (ok bool) {
-	if argCount != native.Arity {
+	if native.Variadic {
+		if argCount < native.Arity {
+			return runtimeError("Expected at least %d arguments but got %d.", native.Arity, argCount)
+		}
+	} else if argCount < native.MinArity || argCount > native.Arity {
+		if native.MinArity != native.Arity {
+			return runtimeError("Expected %d to %d arguments but got %d.", native.MinArity, native.Arity, argCount)
+		}
 		return runtimeError("Expected %d arguments but got %d.", native.Arity, argCount)
 	}
+	for ; argCount < native.Arity; argCount++ {
+		Push(vmvalue.NilValue)
+	}
 	iArgs := int(argCount)
 	args := GlobalVM.Stack[GlobalVM.StackTop-iArgs : GlobalVM.StackTop]
+	// the code called back by the native can't yield the fiber running the native
+	runBaseFrame := GlobalVM.RunBaseFrame
+	GlobalVM.RunBaseFrame = MaxCallFrames
 	value, err := native.Fn(args...)
+	GlobalVM.RunBaseFrame = runBaseFrame
 	if err != nil {
-		return runtimeError(fmt.Sprintf("native: %#v", err))
+		GlobalVM.PendingYield = false
+		var exitErr *vmstd.ExitError
+		if errors.As(err, &exitErr) {
+			GlobalVM.ExitError = exitErr
+			resetStackOnError()
+			return false
+		}
+		return runtimeError("%s", err)
 	}
 	GlobalVM.StackTop -= iArgs + 1
 	Push(value)
-	return true
+	if GlobalVM.PendingYield {
+		GlobalVM.PendingYield = false
+		return yieldFiber()
+	}
+	return protocolOK()
 }
 
 func SetGlobal(name *vmvalue.ObjString, value vmvalue.Value) bool {
 	return vmvalue.SetGlobal(name, value)
 }
 
+func DefineConstGlobal(name *vmvalue.ObjString, value vmvalue.Value) {
+	vmvalue.DefineConstGlobal(name, value)
+}
+
+func IsConstGlobal(name *vmvalue.ObjString) bool {
+	return vmvalue.IsConstGlobal(name)
+}
+
 func GetGlobal(name *vmvalue.ObjString) (vmvalue.Value, bool) {
 	return vmvalue.GetGlobal(name)
 }
@@ -296,17 +774,24 @@ func DeleteGlobal(name *vmvalue.ObjString) bool {
 	return vmvalue.DeleteGlobal(name)
 }
 
-func Run() (vmvalue.Value, error) { //nolint:gocyclo,gocognit,maintidx
+func Run() (vmvalue.Value, error) {
 	if vmdebug.DebugDisassembler {
 		fmt.Println("== trace execution ==")
 		defer fmt.Println()
 	}
 
+	return run(0)
+}
+
+// run executes until the frame above baseFrame returns, it is re-entered to call user code synchronously.
+func run(baseFrame int) (vmvalue.Value, error) { //nolint:gocyclo,gocognit,maintidx
+	defer func(runBaseFrame int) { GlobalVM.RunBaseFrame = runBaseFrame }(GlobalVM.RunBaseFrame)
+	GlobalVM.RunBaseFrame = baseFrame
 	ok := true
 	frame, chunk := frameChunk()
 	for {
 		if !ok {
-			return vmvalue.NilValue, InterpretRuntimeError
+			return vmvalue.NilValue, runError()
 		}
 
 		// Debug tracing.
@@ -329,32 +814,126 @@ func Run() (vmvalue.Value, error) { //nolint:gocyclo,gocognit,maintidx
 			Push(vmvalue.FalseValue)
 		case bytecode.OpEqual:
 			Push(vmvalue.BoolAsValue(vmvalue.IsValuesEqual(Pop(), Pop())))
+			ok = protocolOK()
 		case bytecode.OpGreater:
-			ok = binaryNumCompareOp(binOpGreater)
+			if a, b := Peek(1), Peek(0); vmvalue.IsSmallInt(a) && vmvalue.IsSmallInt(b) {
+				GlobalVM.StackTop--
+				SetStackAt(GlobalVM.StackTop-1, vmvalue.BoolAsValue(vmvalue.ValueAsInt(a) > vmvalue.ValueAsInt(b)))
+			} else if vmvalue.IsInstance(a) {
+				if ok = callOperator(OperatorGreater, 1, opGreater); ok {
+					frame, chunk = frameChunk()
+				}
+			} else {
+				ok = opGreater()
+			}
 		case bytecode.OpLess:
-			ok = binaryNumCompareOp(binOpLess)
+			if a, b := Peek(1), Peek(0); vmvalue.IsSmallInt(a) && vmvalue.IsSmallInt(b) {
+				GlobalVM.StackTop--
+				SetStackAt(GlobalVM.StackTop-1, vmvalue.BoolAsValue(vmvalue.ValueAsInt(a) < vmvalue.ValueAsInt(b)))
+			} else if vmvalue.IsInstance(a) {
+				if ok = callOperator(OperatorLess, 1, opLess); ok {
+					frame, chunk = frameChunk()
+				}
+			} else {
+				ok = opLess()
+			}
 		case bytecode.OpAdd:
-			if vmvalue.IsString(Peek(0)) && vmvalue.IsString(Peek(1)) {
+			if a, b := Peek(1), Peek(0); vmvalue.IsSmallInt(a) && vmvalue.IsSmallInt(b) {
+				// small integers can't overflow int64
+				value := vmvalue.IntAsValue(vmvalue.ValueAsInt(a) + vmvalue.ValueAsInt(b))
+				GlobalVM.StackTop--
+				SetStackAt(GlobalVM.StackTop-1, value)
+			} else if vmvalue.IsString(Peek(0)) && vmvalue.IsString(Peek(1)) {
 				ok = stringConcat()
-			} else if vmvalue.IsNumber(Peek(0)) && vmvalue.IsNumber(Peek(1)) {
-				ok = binaryNumMathOp(binOpAdd)
+			} else if vmvalue.IsInstance(Peek(0)) || vmvalue.IsInstance(Peek(1)) {
+				if ok = callOperator(OperatorAdd, 1, userStringConcat); ok {
+					frame, chunk = frameChunk()
+				}
+			} else if isArithmetic(Peek(0)) && isArithmetic(Peek(1)) {
+				ok = binaryNumMathOp(binOpAdd, intOpAdd, vmvalue.BigAdd)
 			} else {
 				ok = runtimeError("Operands must be two numbers or two strings.")
 			}
 		case bytecode.OpSubtract:
-			ok = binaryNumMathOp(binOpSubtract)
+			if a, b := Peek(1), Peek(0); vmvalue.IsSmallInt(a) && vmvalue.IsSmallInt(b) {
+				value := vmvalue.IntAsValue(vmvalue.ValueAsInt(a) - vmvalue.ValueAsInt(b))
+				GlobalVM.StackTop--
+				SetStackAt(GlobalVM.StackTop-1, value)
+			} else if vmvalue.IsInstance(a) {
+				if ok = callOperator(OperatorSubtract, 1, opSubtract); ok {
+					frame, chunk = frameChunk()
+				}
+			} else {
+				ok = opSubtract()
+			}
 		case bytecode.OpMultiply:
-			ok = binaryNumMathOp(binOpMultiply)
+			if vmvalue.IsInstance(Peek(1)) {
+				if ok = callOperator(OperatorMultiply, 1, opMultiply); ok {
+					frame, chunk = frameChunk()
+				}
+			} else {
+				ok = opMultiply()
+			}
 		case bytecode.OpDivide:
-			ok = binaryNumMathOp(binOpDivide)
+			if vmvalue.IsInstance(Peek(1)) {
+				if ok = callOperator(OperatorDivide, 1, opDivide); ok {
+					frame, chunk = frameChunk()
+				}
+			} else {
+				ok = opDivide()
+			}
+		case bytecode.OpModulo:
+			if vmvalue.IsInstance(Peek(1)) {
+				if ok = callOperator(OperatorModulo, 1, opModulo); ok {
+					frame, chunk = frameChunk()
+				}
+			} else {
+				ok = opModulo()
+			}
+		case bytecode.OpIncrement:
+			ok = unaryNumMathOp(unaryOpIncrement, intOpIncrement, bigOpIncrement)
+		case bytecode.OpDecrement:
+			ok = unaryNumMathOp(unaryOpDecrement, intOpDecrement, bigOpDecrement)
+		case bytecode.OpBitAnd:
+			ok = binaryIntOp(binOpBitAnd)
+		case bytecode.OpBitOr:
+			ok = binaryIntOp(binOpBitOr)
+		case bytecode.OpBitXor:
+			ok = binaryIntOp(binOpBitXor)
+		case bytecode.OpShiftLeft:
+			ok = binaryShiftOp(binOpShiftLeft)
+		case bytecode.OpShiftRight:
+			ok = binaryShiftOp(binOpShiftRight)
+		case bytecode.OpBitNot:
+			ok = opBitNot()
 		case bytecode.OpNegate:
-			ok = opNegate()
+			if vmvalue.IsInstance(Peek(0)) {
+				if ok = callOperator(OperatorNegate, 0, opNegate); ok {
+					frame, chunk = frameChunk()
+				}
+			} else {
+				ok = opNegate()
+			}
 		case bytecode.OpNot:
 			Push(vmvalue.BoolAsValue(!isTruey(Pop())))
 		case bytecode.OpPop:
 			Pop()
+		case bytecode.OpDup:
+			Push(Peek(0))
+		case bytecode.OpDupUnder:
+			// a b -> b a b
+			b := Pop()
+			a := Pop()
+			Push(b)
+			Push(a)
+			Push(b)
 		case bytecode.OpPrint:
-			PrintlnValue(Pop())
+			// formatted first, so nothing is printed if user toString() fails
+			text := vmvalue.SprintValue(Peek(0))
+			if ok = protocolOK(); ok {
+				fmt.Println(text)
+				Pop()
+			}
 		case bytecode.OpGetLocal:
 			slot := readByte(frame, chunk)
 			local := StackAt(frame.SlotsTop + int(slot))
@@ -371,15 +950,35 @@ func Run() (vmvalue.Value, error) { //nolint:gocyclo,gocognit,maintidx
 			}
 		case bytecode.OpSetGlobal:
 			name := readString(frame, chunk)
+			if IsConstGlobal(name) {
+				ok = runtimeError("Can't assign to constant '%s'.", string(name.Chars))
+				break
+			}
 			if isNewKey := SetGlobal(name, Peek(0)); isNewKey {
 				DeleteGlobal(name)
 				ok = runtimeError("Undefined variable '%s'.", string(name.Chars))
 			}
-		case bytecode.OpDefineGlobal:
+		case bytecode.OpDefineGlobal, bytecode.OpDefineConst:
 			name := readString(frame, chunk)
-			SetGlobal(name, Peek(0))
+			if IsConstGlobal(name) {
+				ok = runtimeError("Can't redefine constant '%s'.", string(name.Chars))
+				break
+			}
+			if instruction == bytecode.OpDefineConst {
+				DefineConstGlobal(name, Peek(0))
+			} else {
+				SetGlobal(name, Peek(0))
+			}
 			Pop()
 		case bytecode.OpGetProperty:
+			if vmvalue.IsClass(Peek(0)) {
+				ok = GetStaticProperty(vmvalue.ValueAsClass(Peek(0)), readString(frame, chunk))
+				break
+			}
+			if vmvalue.IsEnum(Peek(0)) || vmvalue.IsEnumMember(Peek(0)) {
+				ok = getEnumProperty(readString(frame, chunk))
+				break
+			}
 			if !vmvalue.IsInstance(Peek(0)) {
 				ok = runtimeError("Only instances have properties.")
 				break
@@ -393,15 +992,31 @@ func Run() (vmvalue.Value, error) { //nolint:gocyclo,gocognit,maintidx
 				break
 			}
 
-			// if not a field, treat as method name
-			ok = BindMethod(instance.Klass, name)
+			// if not a field, treat as getter or method name
+			if ok = GetProperty(instance.Klass, name); ok {
+				frame, chunk = frameChunk()
+			}
 		case bytecode.OpSetProperty:
+			if vmvalue.IsClass(Peek(1)) {
+				ok = setStaticField(vmvalue.ValueAsClass(Peek(1)), readString(frame, chunk))
+				break
+			}
 			if !vmvalue.IsInstance(Peek(1)) {
 				ok = runtimeError("Only instances have fields.")
 				break
 			}
 			instance := vmvalue.ValueAsInstance(Peek(1))
 			name := readString(frame, chunk)
+			if setter, found := instance.Klass.Setters.Get(name); found {
+				if ok = Call(vmvalue.ValueAsClosure(setter), 1); ok {
+					frame, chunk = frameChunk()
+				}
+				break
+			}
+			if _, found := instance.Klass.Getters.Get(name); found {
+				ok = runtimeError("Property '%s' has no setter.", vmvalue.PropertyName(name))
+				break
+			}
 			instance.Fields.Set(name, Peek(0))
 			value := Pop()
 			Pop()
@@ -410,17 +1025,71 @@ func Run() (vmvalue.Value, error) { //nolint:gocyclo,gocognit,maintidx
 			name := readString(frame, chunk)
 			class := vmvalue.NewClass(name)
 			Push(vmvalue.ObjAsValue(class))
+		case bytecode.OpTrait:
+			trait := vmvalue.NewClass(readString(frame, chunk))
+			trait.IsTrait = true
+			Push(vmvalue.ObjAsValue(trait))
+		case bytecode.OpAbstractClass:
+			class := vmvalue.NewClass(readString(frame, chunk))
+			class.IsAbstract = true
+			Push(vmvalue.ObjAsValue(class))
+		case bytecode.OpMixin:
+			trait := Peek(1)
+			if !vmvalue.IsClass(trait) || !vmvalue.ValueAsClass(trait).IsTrait {
+				ok = runtimeError("Can only mix in traits.")
+				break
+			}
+			mixin(vmvalue.ValueAsClass(Peek(0)), vmvalue.ValueAsClass(trait))
+			Pop() // Class.
+			Pop() // Trait.
+		case bytecode.OpEndClass:
+			class := vmvalue.ValueAsClass(Peek(0))
+			if ok = checkTraitConflicts(class) && checkAbstractMethods(class); ok {
+				Pop() // Class.
+			}
 		case bytecode.OpInherit:
 			superclass := Peek(1)
-			if !vmvalue.IsClass(superclass) {
+			if !vmvalue.IsClass(superclass) || vmvalue.ValueAsClass(superclass).IsTrait {
 				ok = runtimeError("Superclass must be a class.")
 				break
 			}
 			subclass := vmvalue.ValueAsClass(Peek(0))
-			subclass.Methods.PutAll(&vmvalue.ValueAsClass(superclass).Methods)
+			inherit(subclass, vmvalue.ValueAsClass(superclass))
 			Pop() // Subclass.
+		case bytecode.OpIs:
+			if vmvalue.IsEnum(Peek(0)) {
+				enum := vmvalue.ValueAsEnum(Pop())
+				value := Pop()
+				Push(vmvalue.BoolAsValue(vmvalue.IsEnumMember(value) && vmvalue.ValueAsEnumMember(value).Enum == enum))
+				break
+			}
+			if !vmvalue.IsClass(Peek(0)) {
+				ok = runtimeError("Right operand of 'is' must be a class or an enum.")
+				break
+			}
+			class := vmvalue.ValueAsClass(Pop())
+			value := Pop()
+			Push(vmvalue.BoolAsValue(vmvalue.IsInstanceOf(value, class)))
+		case bytecode.OpEnum:
+			Push(vmvalue.ObjAsValue(vmvalue.NewEnum(readString(frame, chunk))))
+		case bytecode.OpEnumMember:
+			defineEnumMember(readString(frame, chunk))
 		case bytecode.OpMethod:
 			DefineMethod(readString(frame, chunk))
+		case bytecode.OpAbstractMethod:
+			class := vmvalue.ValueAsClass(Peek(0))
+			name := readString(frame, chunk)
+			if _, implemented := class.Methods.Get(name); !implemented {
+				class.Abstract.Set(name, vmvalue.TrueValue)
+			}
+		case bytecode.OpStaticMethod:
+			DefineClassMember(&vmvalue.ValueAsClass(Peek(1)).StaticMethods, readString(frame, chunk))
+		case bytecode.OpStaticField:
+			DefineClassMember(&vmvalue.ValueAsClass(Peek(1)).Fields, readString(frame, chunk))
+		case bytecode.OpGetter:
+			DefineClassMember(&vmvalue.ValueAsClass(Peek(1)).Getters, readString(frame, chunk))
+		case bytecode.OpSetter:
+			DefineClassMember(&vmvalue.ValueAsClass(Peek(1)).Setters, readString(frame, chunk))
 		case bytecode.OpJump:
 			offset := readShort(frame, chunk)
 			frame.IP += int(offset)
@@ -429,6 +1098,22 @@ func Run() (vmvalue.Value, error) { //nolint:gocyclo,gocognit,maintidx
 			if isFalsey(Peek(0)) {
 				frame.IP += int(offset)
 			}
+		case bytecode.OpJumpIfNil:
+			offset := readShort(frame, chunk)
+			if vmvalue.IsNil(Peek(0)) {
+				frame.IP += int(offset)
+			}
+		case bytecode.OpJumpIfNotNil:
+			offset := readShort(frame, chunk)
+			if !vmvalue.IsNil(Peek(0)) {
+				frame.IP += int(offset)
+			}
+		case bytecode.OpJumpIfArgPassed:
+			slot := readByte(frame, chunk)
+			offset := readShort(frame, chunk)
+			if int(slot) <= frame.ArgCount {
+				frame.IP += int(offset)
+			}
 		case bytecode.OpLoop:
 			offset := readShort(frame, chunk)
 			frame.IP -= int(offset)
@@ -447,7 +1132,13 @@ func Run() (vmvalue.Value, error) { //nolint:gocyclo,gocognit,maintidx
 			method := readString(frame, chunk)
 			argCount := readByte(frame, chunk)
 			superclass := vmvalue.ValueAsClass(Pop())
-			if ok = InvokeFromClass(superclass, method, argCount); ok {
+			if vmvalue.IsClass(Peek(argCount)) {
+				// `super.method()` in a static method
+				ok = InvokeStatic(superclass, method, argCount)
+			} else {
+				ok = InvokeFromClass(superclass, method, argCount)
+			}
+			if ok {
 				frame, chunk = frameChunk()
 			}
 		case bytecode.OpClosure:
@@ -467,7 +1158,11 @@ func Run() (vmvalue.Value, error) { //nolint:gocyclo,gocognit,maintidx
 		case bytecode.OpGetSuper:
 			method := readString(frame, chunk)
 			superclass := vmvalue.ValueAsClass(Pop())
-			ok = BindMethod(superclass, method)
+			if vmvalue.IsClass(Peek(0)) {
+				ok = GetStaticProperty(superclass, method)
+			} else if ok = GetProperty(superclass, method); ok {
+				frame, chunk = frameChunk()
+			}
 		case bytecode.OpGetUpvalue:
 			slot := readByte(frame, chunk)
 			Push(*frame.Closure.Upvalues[slot].Location)
@@ -477,17 +1172,128 @@ func Run() (vmvalue.Value, error) { //nolint:gocyclo,gocognit,maintidx
 		case bytecode.OpCloseUpvalue:
 			CloseUpvalues(GlobalVM.StackTop - 1)
 			Pop()
+		case bytecode.OpList:
+			itemCount := int(readByte(frame, chunk))
+			items := vmmem.AllocateSlice[vmvalue.Value](itemCount)
+			copy(items, GlobalVM.Stack[GlobalVM.StackTop-itemCount:GlobalVM.StackTop])
+			list := vmvalue.NewList(items)
+			GlobalVM.StackTop -= itemCount
+			Push(vmvalue.ObjAsValue(list))
+		case bytecode.OpMap:
+			entryCount := int(readByte(frame, chunk))
+			m := vmvalue.NewMap()
+			Push(vmvalue.ObjAsValue(m))
+			entries := GlobalVM.StackTop - 1 - 2*entryCount
+			for i := range entryCount {
+				m.Table.Set(StackAt(entries+2*i), StackAt(entries+2*i+1))
+			}
+			if ok = protocolOK(); ok {
+				GlobalVM.StackTop = entries
+				Push(vmvalue.ObjAsValue(m))
+			}
+		case bytecode.OpGetIndex:
+			if vmvalue.IsInstance(Peek(1)) {
+				if ok = callOperator(OperatorIndex, 1, getIndex); ok {
+					frame, chunk = frameChunk()
+				}
+			} else {
+				ok = getIndex() && protocolOK()
+			}
+		case bytecode.OpSetIndex:
+			if vmvalue.IsInstance(Peek(2)) {
+				if ok = callSetIndexOperator(); ok {
+					frame, chunk = frameChunk()
+				}
+			} else {
+				ok = setIndex() && protocolOK()
+			}
+		case bytecode.OpUnpackList:
+			count := int(readByte(frame, chunk))
+			rest := readByte(frame, chunk) == 1
+			ok = unpackList(count, rest)
+		case bytecode.OpMatchList:
+			count := int(readByte(frame, chunk))
+			rest := readByte(frame, chunk) == 1
+			matched := false
+			if vmvalue.IsList(Peek(0)) {
+				length := len(vmvalue.ValueAsList(Peek(0)).Items)
+				matched = length == count || rest && length > count
+			}
+			SetStackAt(GlobalVM.StackTop-1, vmvalue.BoolAsValue(matched))
+		case bytecode.OpListRest:
+			// the list shape is tested by OpMatchList first
+			start := int(readByte(frame, chunk))
+			list := vmvalue.ValueAsList(Peek(0))
+			items := vmmem.AllocateSlice[vmvalue.Value](len(list.Items) - start)
+			copy(items, list.Items[start:])
+			SetStackAt(GlobalVM.StackTop-1, vmvalue.ObjAsValue(vmvalue.NewList(items)))
+		case bytecode.OpUnpackField:
+			name := readString(frame, chunk)
+			switch {
+			case vmvalue.IsMap(Peek(0)):
+				value, found := vmvalue.ValueAsMap(Peek(0)).Table.Get(vmvalue.ObjAsValue(name))
+				if !found {
+					ok = runtimeError("Undefined key '%s'.", vmvalue.PropertyName(name))
+					break
+				}
+				Pop() // Map.
+				Push(value)
+			case vmvalue.IsInstance(Peek(0)):
+				instance := vmvalue.ValueAsInstance(Peek(0))
+				if value, found := instance.Fields.Get(name); found {
+					Pop() // Instance.
+					Push(value)
+					break
+				}
+				if ok = GetProperty(instance.Klass, name); ok {
+					frame, chunk = frameChunk()
+				}
+			default:
+				ok = runtimeError("Expected an instance or a map to destructure but got %s.", vmvalue.TypeName(Peek(0)))
+			}
+		case bytecode.OpIterator:
+			if vmvalue.IsInstance(Peek(0)) {
+				if ok = Invoke(GlobalVM.IteratorString, 0); ok {
+					frame, chunk = frameChunk()
+				}
+			} else {
+				ok = getIterator()
+			}
+		case bytecode.OpYield:
+			if ok = yieldFiber(); ok {
+				frame, chunk = frameChunk()
+			}
+		case bytecode.OpAwait:
+			if ok = awaitFiber(); ok {
+				if GlobalVM.FrameCount == baseFrame {
+					// the async function started by the caller of run has suspended
+					return Pop(), nil
+				}
+				frame, chunk = frameChunk()
+			}
 		case bytecode.OpReturn:
 			callReturnValue := Pop()
 			CloseUpvalues(frame.SlotsTop)
 			GlobalVM.FrameCount--
-			if GlobalVM.FrameCount == 0 {
-				Pop()
+			GlobalVM.StackTop = frame.SlotsTop
+			if frame.FiberBase {
+				// the fiber slot below the frame receives the result
+				if ok = finishFiber(callReturnValue); ok && GlobalVM.FrameCount == baseFrame {
+					return Pop(), nil
+				}
+			} else if GlobalVM.FrameCount == baseFrame {
 				return callReturnValue, nil
+			} else if frame.InvokeResult {
+				// getter invoked as method, the result replaces the receiver below arguments
+				argCount := frame.InvokeArgCount
+				GlobalVM.Stack[GlobalVM.StackTop-int(argCount)-1] = callReturnValue
+				ok = CallValue(callReturnValue, argCount)
+			} else if !frame.DiscardResult {
+				Push(callReturnValue)
+			}
+			if ok {
+				frame, chunk = frameChunk()
 			}
-			GlobalVM.StackTop = frame.SlotsTop
-			Push(callReturnValue)
-			frame, chunk = frameChunk()
 		default:
 			ok = runtimeError("Unexpected instruction")
 		}
@@ -511,34 +1317,207 @@ func binaryNumOp(op func(vmvalue.Value, vmvalue.Value) vmvalue.Value) (ok bool)
 		return ok
 	}
 
-	b := Pop()
-	a := Pop()
-	Push(op(a, b))
+	// operands stay on the stack while the result (boxed integer) is allocated
+	result := op(Peek(1), Peek(0))
+	Pop()
+	Pop()
+	Push(result)
 	return ok
 }
 
-func binaryNumMathOp(op func(float64, float64) float64) (ok bool) {
+// binaryNumMathOp applies intOp if both operands are integers, the result stays integer
+// unless intOp reports it can't be represented exactly (overflow, fraction), then the
+// operation is done with floats. Mixed integer and float operands produce float.
+func binaryNumMathOp(
+	op func(float64, float64) float64,
+	intOp func(int64, int64) (int64, bool),
+	bigOp vmvalue.BigOp,
+) (ok bool) {
+	if vmvalue.IsBigNumber(Peek(0)) || vmvalue.IsBigNumber(Peek(1)) {
+		return binaryBigOp(bigOp)
+	}
+
 	return binaryNumOp(func(a vmvalue.Value, b vmvalue.Value) vmvalue.Value {
+		if vmvalue.IsInt(a) && vmvalue.IsInt(b) {
+			if result, exact := intOp(vmvalue.ValueAsInt(a), vmvalue.ValueAsInt(b)); exact {
+				return vmvalue.IntAsValue(result)
+			}
+		}
 		av := vmvalue.ValueAsNumber(a)
 		bv := vmvalue.ValueAsNumber(b)
 		return vmvalue.NumberAsValue(op(av, bv))
 	})
 }
 
-func binaryNumCompareOp(op func(float64, float64) bool) (ok bool) {
+// isArithmetic reports whether the value supports arithmetic operators.
+func isArithmetic(v vmvalue.Value) bool {
+	return vmvalue.IsNumber(v) || vmvalue.IsBigNumber(v)
+}
+
+func binaryBigOp(op vmvalue.BigOp) (ok bool) {
+	result, err := vmvalue.BigArith(op, Peek(1), Peek(0))
+	if err != nil {
+		return runtimeError("%s", err)
+	}
+	Pop()
+	Pop()
+	Push(result)
+	return true
+}
+
+// numberAsInt converts integral number to int64, ok is false if the number
+// has fractional part or does not fit in int64.
+func numberAsInt(v vmvalue.Value) (n int64, ok bool) {
+	if vmvalue.IsInt(v) {
+		return vmvalue.ValueAsInt(v), true
+	}
+	num := vmvalue.ValueAsNumber(v)
+	if num != math.Trunc(num) || num < math.MinInt64 || num >= math.MaxInt64 {
+		return 0, false
+	}
+	return int64(num), true
+}
+
+func binaryIntOp(op func(int64, int64) int64) (ok bool) {
+	return binaryIntOpChecked(func(a, b int64) (int64, bool) {
+		return op(a, b), true
+	})
+}
+
+func binaryShiftOp(op func(int64, uint) int64) (ok bool) {
+	return binaryIntOpChecked(func(a, b int64) (int64, bool) {
+		if b < 0 || b > 63 {
+			runtimeError("Shift count must be between 0 and 63.")
+			return 0, false
+		}
+		return op(a, uint(b)), true
+	})
+}
+
+func binaryIntOpChecked(op func(int64, int64) (int64, bool)) (ok bool) {
+	if ok = (vmvalue.IsNumber(Peek(0)) && vmvalue.IsNumber(Peek(1))); !ok {
+		runtimeError("Operands must be numbers.")
+		return ok
+	}
+
+	a, aok := numberAsInt(Peek(1))
+	b, bok := numberAsInt(Peek(0))
+	if ok = aok && bok; !ok {
+		runtimeError("Operands must be integers in 64-bit range.")
+		return ok
+	}
+
+	result, ok := op(a, b)
+	if !ok {
+		return ok
+	}
+	value := vmvalue.IntAsValue(result)
+	Pop()
+	Pop()
+	Push(value)
+	return ok
+}
+
+func opBitNot() (ok bool) {
+	if ok = vmvalue.IsNumber(Peek(0)); !ok {
+		runtimeError("Operand must be a number.")
+		return ok
+	}
+
+	a, ok := numberAsInt(Peek(0))
+	if !ok {
+		runtimeError("Operand must be an integer in 64-bit range.")
+		return ok
+	}
+	value := vmvalue.IntAsValue(^a)
+	Pop()
+	Push(value)
+	return ok
+}
+
+func binaryNumCompareOp(op func(float64, float64) bool, intOp func(int64, int64) bool) (ok bool) {
+	if vmvalue.IsBigNumber(Peek(0)) || vmvalue.IsBigNumber(Peek(1)) {
+		if !isArithmetic(Peek(0)) || !isArithmetic(Peek(1)) {
+			return runtimeError("Operands must be numbers.")
+		}
+		// NaN is neither less nor greater
+		cmp, cok := vmvalue.BigCompare(Peek(1), Peek(0))
+		Pop()
+		Pop()
+		Push(vmvalue.BoolAsValue(cok && intOp(int64(cmp), 0)))
+		return true
+	}
+
 	return binaryNumOp(func(a vmvalue.Value, b vmvalue.Value) vmvalue.Value {
+		if vmvalue.IsInt(a) && vmvalue.IsInt(b) {
+			return vmvalue.BoolAsValue(intOp(vmvalue.ValueAsInt(a), vmvalue.ValueAsInt(b)))
+		}
 		av := vmvalue.ValueAsNumber(a)
 		bv := vmvalue.ValueAsNumber(b)
 		return vmvalue.BoolAsValue(op(av, bv))
 	})
 }
 
+func opSubtract() (ok bool) {
+	return binaryNumMathOp(binOpSubtract, intOpSubtract, vmvalue.BigSubtract)
+}
+
+func opMultiply() (ok bool) {
+	return binaryNumMathOp(binOpMultiply, intOpMultiply, vmvalue.BigMultiply)
+}
+
+func opDivide() (ok bool) {
+	return binaryNumMathOp(binOpDivide, intOpDivide, vmvalue.BigDivide)
+}
+
+func opModulo() (ok bool) {
+	return binaryNumMathOp(math.Mod, intOpModulo, vmvalue.BigModulo)
+}
+
+func opLess() (ok bool) {
+	return binaryNumCompareOp(binOpLess[float64], binOpLess[int64])
+}
+
+func opGreater() (ok bool) {
+	return binaryNumCompareOp(binOpGreater[float64], binOpGreater[int64])
+}
+
 func opNegate() (ok bool) {
+	return unaryNumMathOp(unaryOpNegate, intOpNegate, bigOpNegate)
+}
+
+func unaryNumMathOp(
+	op func(float64) float64,
+	intOp func(int64) (int64, bool),
+	bigOp func(vmvalue.Value) (vmvalue.Value, error),
+) (ok bool) {
+	if vmvalue.IsBigNumber(Peek(0)) {
+		value, err := bigOp(Peek(0))
+		if err != nil {
+			return runtimeError("%s", err)
+		}
+		Pop()
+		Push(value)
+		return true
+	}
+
 	if ok = vmvalue.IsNumber(Peek(0)); !ok {
 		runtimeError("Operand must be a number.")
 		return ok
 	}
-	Push(vmvalue.NumberAsValue(-vmvalue.ValueAsNumber(Pop())))
+
+	var value vmvalue.Value
+	if a := Peek(0); vmvalue.IsInt(a) {
+		if result, exact := intOp(vmvalue.ValueAsInt(a)); exact {
+			value = vmvalue.IntAsValue(result)
+		} else {
+			value = vmvalue.NumberAsValue(op(vmvalue.ValueAsNumber(a)))
+		}
+	} else {
+		value = vmvalue.NumberAsValue(op(vmvalue.ValueAsNumber(a)))
+	}
+	Pop()
+	Push(value)
 	return ok
 }
 
@@ -556,6 +1535,120 @@ func stringConcat() (ok bool) {
 	return true
 }
 
+func getIndex() (ok bool) {
+	target, index := Peek(1), Peek(0)
+
+	var value vmvalue.Value
+	switch {
+	case vmvalue.IsList(target):
+		items := vmvalue.ValueAsList(target).Items
+		var at int
+		if at, ok = listIndex(index, len(items)); !ok {
+			return ok
+		}
+		value = items[at]
+	case vmvalue.IsMap(target):
+		value, _ = vmvalue.ValueAsMap(target).Table.Get(index)
+	case vmvalue.IsString(target):
+		chars := vmvalue.ValueAsStringChars(target)
+		var at int
+		if at, ok = listIndex(index, utf8.RuneCount(chars)); !ok {
+			return ok
+		}
+		value = vmvalue.ObjAsValue(vmvalue.StringInternCopy(vmvalue.StringCharAt(chars, at)))
+	default:
+		return runtimeError("Only lists, maps and strings can be indexed.")
+	}
+
+	Pop()
+	Pop()
+	Push(value)
+	return true
+}
+
+func setIndex() (ok bool) {
+	target, index, value := Peek(2), Peek(1), Peek(0)
+
+	switch {
+	case vmvalue.IsList(target):
+		items := vmvalue.ValueAsList(target).Items
+		var at int
+		if at, ok = listIndex(index, len(items)); !ok {
+			return ok
+		}
+		items[at] = value
+	case vmvalue.IsMap(target):
+		vmvalue.ValueAsMap(target).Table.Set(index, value)
+	default:
+		return runtimeError("Only lists and maps support index assignment.")
+	}
+
+	GlobalVM.StackTop -= 3
+	Push(value)
+	return true
+}
+
+// unpackList replaces the list on top of the stack with its first count items,
+// followed by the list of the remaining items if rest is set.
+func unpackList(count int, rest bool) (ok bool) {
+	if !vmvalue.IsList(Peek(0)) {
+		return runtimeError("Expected a list to destructure but got %s.", vmvalue.TypeName(Peek(0)))
+	}
+	list := vmvalue.ValueAsList(Peek(0))
+	length := len(list.Items)
+	switch {
+	case rest && length < count:
+		return runtimeError("Expected at least %d items to destructure but got %d.", count, length)
+	case !rest && length != count:
+		return runtimeError("Expected %d items to destructure but got %d.", count, length)
+	}
+
+	restList := vmvalue.NilValue
+	if rest {
+		// the source list stays on the stack while the rest list is allocated
+		items := vmmem.AllocateSlice[vmvalue.Value](length - count)
+		copy(items, list.Items[count:])
+		restList = vmvalue.ObjAsValue(vmvalue.NewList(items))
+	}
+
+	Pop() // List.
+	for _, item := range list.Items[:count] {
+		Push(item)
+	}
+	if rest {
+		Push(restList)
+	}
+	return true
+}
+
+func listIndex(index vmvalue.Value, length int) (at int, ok bool) {
+	if !vmvalue.IsNumber(index) {
+		return 0, runtimeError("Index must be a number.")
+	}
+
+	num := vmvalue.ValueAsNumber(index)
+	if num != math.Trunc(num) {
+		return 0, runtimeError("Index must be an integer.")
+	}
+	if num < 0 || num >= float64(length) {
+		return 0, runtimeError("Index out of bounds.")
+	}
+
+	return int(num), true
+}
+
+func unaryOpNegate(a float64) float64 {
+	return -a
+}
+
+func unaryOpIncrement(a float64) float64 {
+	return a + 1
+}
+
+func unaryOpDecrement(a float64) float64 {
+	return a - 1
+}
+
 func binOpAdd(a, b float64) float64 {
 	return a + b
 }
@@ -572,14 +1665,97 @@ func binOpDivide(a, b float64) float64 {
 	return a / b
 }
 
-func binOpGreater(a, b float64) bool {
+func binOpBitAnd(a, b int64) int64 {
+	return a & b
+}
+
+func binOpBitOr(a, b int64) int64 {
+	return a | b
+}
+
+func binOpBitXor(a, b int64) int64 {
+	return a ^ b
+}
+
+func binOpShiftLeft(a int64, b uint) int64 {
+	return a << b
+}
+
+func binOpShiftRight(a int64, b uint) int64 {
+	return a >> b
+}
+
+func binOpGreater[T int64 | float64](a, b T) bool {
 	return a > b
 }
 
-func binOpLess(a, b float64) bool {
+func binOpLess[T int64 | float64](a, b T) bool {
 	return a < b
 }
 
+func bigOpNegate(a vmvalue.Value) (vmvalue.Value, error) {
+	return vmvalue.BigArith(vmvalue.BigSubtract, vmvalue.IntAsValue(0), a)
+}
+
+func bigOpIncrement(a vmvalue.Value) (vmvalue.Value, error) {
+	return vmvalue.BigArith(vmvalue.BigAdd, a, vmvalue.IntAsValue(1))
+}
+
+func bigOpDecrement(a vmvalue.Value) (vmvalue.Value, error) {
+	return vmvalue.BigArith(vmvalue.BigSubtract, a, vmvalue.IntAsValue(1))
+}
+
+// Integer operations report false if the result does not fit in int64
+// or is not an integer, the caller falls back to float operation then.
+
+func intOpAdd(a, b int64) (int64, bool) {
+	c := a + b
+	return c, (c > a) == (b > 0)
+}
+
+func intOpSubtract(a, b int64) (int64, bool) {
+	c := a - b
+	return c, (c < a) == (b > 0)
+}
+
+func intOpMultiply(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	if (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return 0, false
+	}
+	c := a * b
+	return c, c/b == a
+}
+
+func intOpDivide(a, b int64) (int64, bool) {
+	if b == 0 || a%b != 0 || (a == math.MinInt64 && b == -1) {
+		return 0, false
+	}
+	return a / b, true
+}
+
+func intOpModulo(a, b int64) (int64, bool) {
+	if b == 0 {
+		return 0, false
+	}
+	return a % b, true
+}
+
+func intOpNegate(a int64) (int64, bool) {
+	// there is no integer -0, keep it float
+	return -a, a != 0 && a != math.MinInt64
+}
+
+func intOpIncrement(a int64) (int64, bool) {
+	return a + 1, a != math.MaxInt64
+}
+
+func intOpDecrement(a int64) (int64, bool) {
+	return a - 1, a != math.MinInt64
+}
+
 func frameChunk() (*CallFrame, *vmchunk.Chunk) {
 	frame := &GlobalVM.Frames[GlobalVM.FrameCount-1]
 	ch := vmchunk.FromPtr(frame.Closure.Fn.Chunk)
@@ -611,23 +1787,32 @@ func runtimeError(format string, messageAndArgs ...any) (ok bool) {
 	fmt.Fprintln(os.Stderr)
 
 	for i := range GlobalVM.FrameCount {
-		frame := &GlobalVM.Frames[GlobalVM.FrameCount-1-i]
-		fn := frame.Closure.Fn
-		chunk := vmchunk.FromPtr(fn.Chunk)
-		offset := frame.IP - 1
-		line := chunk.Lines.GetLineByOffset(offset)
-		fmt.Fprintf(os.Stderr, "[line %d] in ", line)
-		if fn.Name == nil {
-			fmt.Fprintln(os.Stderr, "script")
-		} else {
-			fmt.Fprintf(os.Stderr, "%s()\n", string(fn.Name.Chars))
-		}
+		fmt.Fprintln(os.Stderr, frameLocation(&GlobalVM.Frames[GlobalVM.FrameCount-1-i]))
 	}
 
-	resetStack()
+	resetStackOnError()
 	return false
 }
 
+// frameLocation is the stack trace line of the frame.
+func frameLocation(frame *CallFrame) string {
+	fn := frame.Closure.Fn
+	chunk := vmchunk.FromPtr(fn.Chunk)
+	line := chunk.Lines.GetLineByOffset(frame.IP - 1)
+	if fn.Name == nil {
+		return fmt.Sprintf("[line %d] in script", line)
+	}
+	return fmt.Sprintf("[line %d] in %s()", line, string(fn.Name.Chars))
+}
+
+// resetStackOnError resets the stack unless a protocol method has failed,
+// the outer instruction still uses its objects then, runError resets the stack later.
+func resetStackOnError() {
+	if GlobalVM.ProtocolDepth == 0 {
+		resetStack()
+	}
+}
+
 func PrintlnValue(v vmvalue.Value) {
 	vmvalue.PrintlnValue(v)
 }
@@ -644,7 +1829,62 @@ func defineNative1(name string, fn func(vmvalue.Value) (vmvalue.Value, error)) {
 	})
 }
 
-func defineNative(name string, arity byte, fn vmvalue.NativeFn) {
+func defineNative2(name string, fn func(vmvalue.Value, vmvalue.Value) (vmvalue.Value, error)) {
+	defineNative(name, 2, func(args ...vmvalue.Value) (vmvalue.Value, error) {
+		return fn(args[0], args[1])
+	})
+}
+
+func defineNative3(name string, fn func(vmvalue.Value, vmvalue.Value, vmvalue.Value) (vmvalue.Value, error)) {
+	defineNative(name, 3, func(args ...vmvalue.Value) (vmvalue.Value, error) {
+		return fn(args[0], args[1], args[2])
+	})
+}
+
+// defineNativeOptional2 defines the native with optional trailing arguments, which are nil if not passed.
+func defineNativeOptional2(name string, minArity byte, fn func(vmvalue.Value, vmvalue.Value) (vmvalue.Value, error)) {
+	defineNative(name, 2, func(args ...vmvalue.Value) (vmvalue.Value, error) {
+		return fn(args[0], args[1])
+	}).MinArity = minArity
+}
+
+// defineNativeOptional3 defines the native with optional trailing arguments, which are nil if not passed.
+func defineNativeOptional3(name string, minArity byte, fn func(vmvalue.Value, vmvalue.Value, vmvalue.Value) (vmvalue.Value, error)) {
+	defineNative(name, 3, func(args ...vmvalue.Value) (vmvalue.Value, error) {
+		return fn(args[0], args[1], args[2])
+	}).MinArity = minArity
+}
+
+// defineNativeVariadic defines the native which takes the arity arguments followed by any number of extra ones.
+func defineNativeVariadic(name string, arity byte, fn vmvalue.NativeFn) {
+	defineNative(name, arity, fn).Variadic = true
+}
+
+// defineNativeClass defines the global class for static natives, the globals keep it reachable.
+func defineNativeClass(name string) *vmvalue.ObjClass {
+	nameObj := vmvalue.StringInternCopy([]byte(name))
+	Push(vmvalue.ObjAsValue(nameObj))
+	klass := vmvalue.NewClass(nameObj)
+	Push(vmvalue.ObjAsValue(klass))
+	SetGlobal(nameObj, vmvalue.ObjAsValue(klass))
+	Pop()
+	Pop()
+	return klass
+}
+
+// defineStaticNative defines the native static method of the class, the result replaces the class.
+func defineStaticNative(klass *vmvalue.ObjClass, name string, arity byte, fn vmvalue.NativeFn) *vmvalue.ObjNative {
+	nameObj := vmvalue.StringInternCopy([]byte(name))
+	Push(vmvalue.ObjAsValue(nameObj))
+	fnObj := vmvalue.NewNativeFunction(fn, arity)
+	Push(vmvalue.ObjAsValue(fnObj))
+	klass.StaticMethods.Set(nameObj, vmvalue.ObjAsValue(fnObj))
+	Pop()
+	Pop()
+	return fnObj
+}
+
+func defineNative(name string, arity byte, fn vmvalue.NativeFn) *vmvalue.ObjNative {
 	nameObj := vmvalue.StringInternCopy([]byte(name))
 	nameValue := vmvalue.ObjAsValue(nameObj)
 	Push(nameValue)
@@ -654,4 +1894,5 @@ func defineNative(name string, arity byte, fn vmvalue.NativeFn) {
 	SetGlobal(nameObj, vmvalue.ObjAsValue(fnObj))
 	Pop()
 	Pop()
+	return fnObj
 }
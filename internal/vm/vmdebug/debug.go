@@ -45,28 +45,49 @@ func DisassembleInstruction(chunk *vmchunk.Chunk, offset int) int {
 		bytecode.OpGetGlobal,
 		bytecode.OpSetGlobal,
 		bytecode.OpDefineGlobal,
+		bytecode.OpDefineConst,
 		bytecode.OpClass,
+		bytecode.OpTrait,
+		bytecode.OpAbstractClass,
+		bytecode.OpAbstractMethod,
 		bytecode.OpGetProperty,
 		bytecode.OpSetProperty,
 		bytecode.OpMethod,
+		bytecode.OpStaticMethod,
+		bytecode.OpStaticField,
+		bytecode.OpGetter,
+		bytecode.OpSetter,
+		bytecode.OpEnum,
+		bytecode.OpEnumMember,
+		bytecode.OpUnpackField,
 		bytecode.OpGetSuper:
 		return constantInstruction(instruction, chunk, offset)
 	case bytecode.OpInvoke,
 		bytecode.OpSuperInvoke:
 		return invokeInstruction(instruction, chunk, offset)
+	case bytecode.OpUnpackList,
+		bytecode.OpMatchList:
+		return unpackInstruction(instruction, chunk, offset)
 	case bytecode.OpClosure:
 		return closureInstruction(instruction, chunk, offset)
 	case bytecode.OpGetLocal,
 		bytecode.OpSetLocal,
 		bytecode.OpGetUpvalue,
 		bytecode.OpSetUpvalue,
-		bytecode.OpCall:
+		bytecode.OpCall,
+		bytecode.OpList,
+		bytecode.OpListRest,
+		bytecode.OpMap:
 		return byteInstruction(instruction, chunk, offset)
 	case bytecode.OpJump,
-		bytecode.OpJumpIfFalse:
+		bytecode.OpJumpIfFalse,
+		bytecode.OpJumpIfNil,
+		bytecode.OpJumpIfNotNil:
 		return jumpInstruction(instruction, 1, chunk, offset)
 	case bytecode.OpLoop:
 		return jumpInstruction(instruction, -1, chunk, offset)
+	case bytecode.OpJumpIfArgPassed:
+		return argJumpInstruction(instruction, chunk, offset)
 	case bytecode.OpNil,
 		bytecode.OpTrue,
 		bytecode.OpFalse,
@@ -77,12 +98,31 @@ func DisassembleInstruction(chunk *vmchunk.Chunk, offset int) int {
 		bytecode.OpSubtract,
 		bytecode.OpMultiply,
 		bytecode.OpDivide,
+		bytecode.OpModulo,
+		bytecode.OpIncrement,
+		bytecode.OpDecrement,
+		bytecode.OpBitAnd,
+		bytecode.OpBitOr,
+		bytecode.OpBitXor,
+		bytecode.OpBitNot,
+		bytecode.OpShiftLeft,
+		bytecode.OpShiftRight,
 		bytecode.OpNot,
 		bytecode.OpNegate,
 		bytecode.OpPop,
+		bytecode.OpDup,
+		bytecode.OpDupUnder,
 		bytecode.OpPrint,
 		bytecode.OpCloseUpvalue,
 		bytecode.OpInherit,
+		bytecode.OpMixin,
+		bytecode.OpEndClass,
+		bytecode.OpIs,
+		bytecode.OpGetIndex,
+		bytecode.OpSetIndex,
+		bytecode.OpIterator,
+		bytecode.OpYield,
+		bytecode.OpAwait,
 		bytecode.OpReturn:
 		return simpleInstruction(instruction, offset)
 	default:
@@ -139,12 +179,26 @@ func byteInstruction(op bytecode.OpCode, chunk *vmchunk.Chunk, offset int) int {
 	return offset + 2
 }
 
+func unpackInstruction(op bytecode.OpCode, chunk *vmchunk.Chunk, offset int) int {
+	count := chunk.Code[offset+1]
+	rest := chunk.Code[offset+2]
+	fmt.Printf("%-16s %4d (rest %d)\n", op, count, rest)
+	return offset + 3
+}
+
 func jumpInstruction(op bytecode.OpCode, sign int, chunk *vmchunk.Chunk, offset int) int {
 	jump := int((uint16(chunk.Code[offset+1]) << 8) | uint16(chunk.Code[offset+2]))
 	fmt.Printf("%-16s %4d -> %d\n", op, offset, offset+3+sign*jump)
 	return offset + 3
 }
 
+func argJumpInstruction(op bytecode.OpCode, chunk *vmchunk.Chunk, offset int) int {
+	slot := chunk.Code[offset+1]
+	jump := int((uint16(chunk.Code[offset+2]) << 8) | uint16(chunk.Code[offset+3]))
+	fmt.Printf("%-16s %4d %4d -> %d\n", op, slot, offset, offset+4+jump)
+	return offset + 4
+}
+
 func simpleInstruction(op bytecode.OpCode, offset int) int {
 	fmt.Println(op.String())
 	return offset + 1
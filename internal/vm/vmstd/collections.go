@@ -0,0 +1,75 @@
+package vmstd
+
+import (
+	"errors"
+	"unicode/utf8"
+
+	"github.com/leonardinius/goloxvm/internal/vm/vmmem"
+	"github.com/leonardinius/goloxvm/internal/vm/vmvalue"
+)
+
+var (
+	errLenArgument   = errors.New("len: argument must be a string, list or map")
+	errPushArgument  = errors.New("push: first argument must be a list")
+	errKeysArgument  = errors.New("keys: argument must be a map")
+	errRangeArgument = errors.New("range: arguments must be integers")
+	errRangeStep     = errors.New("range: step must not be zero")
+)
+
+func StdLen(value vmvalue.Value) (vmvalue.Value, error) {
+	var length int
+	switch {
+	case vmvalue.IsString(value):
+		length = utf8.RuneCount(vmvalue.ValueAsStringChars(value))
+	case vmvalue.IsList(value):
+		length = len(vmvalue.ValueAsList(value).Items)
+	case vmvalue.IsMap(value):
+		length = vmvalue.ValueAsMap(value).Table.Len()
+	default:
+		return vmvalue.NilValue, errLenArgument
+	}
+
+	return vmvalue.IntAsValue(int64(length)), nil
+}
+
+func StdPush(list, value vmvalue.Value) (vmvalue.Value, error) {
+	if !vmvalue.IsList(list) {
+		return vmvalue.NilValue, errPushArgument
+	}
+
+	vmvalue.ValueAsList(list).Items.Write(value)
+	return list, nil
+}
+
+func StdKeys(value vmvalue.Value) (vmvalue.Value, error) {
+	if !vmvalue.IsMap(value) {
+		return vmvalue.NilValue, errKeysArgument
+	}
+
+	table := &vmvalue.ValueAsMap(value).Table
+	keys := vmmem.AllocateSlice[vmvalue.Value](table.Len())[:0]
+	table.Each(func(key, _ vmvalue.Value) {
+		keys = append(keys, key)
+	})
+	return vmvalue.ObjAsValue(vmvalue.NewList(keys)), nil
+}
+
+// StdRange returns the iterator over integers `range(end)`, `range(start, end)` or `range(start, end, step)`,
+// the end is exclusive. Missing arguments are nil.
+func StdRange(start, end, step vmvalue.Value) (vmvalue.Value, error) {
+	if vmvalue.IsNil(end) {
+		start, end = vmvalue.IntAsValue(0), start
+	}
+	if vmvalue.IsNil(step) {
+		step = vmvalue.IntAsValue(1)
+	}
+	if !vmvalue.IsInt(start) || !vmvalue.IsInt(end) || !vmvalue.IsInt(step) {
+		return vmvalue.NilValue, errRangeArgument
+	}
+	if vmvalue.ValueAsInt(step) == 0 {
+		return vmvalue.NilValue, errRangeStep
+	}
+
+	iterator := vmvalue.NewRangeIterator(vmvalue.ValueAsInt(start), vmvalue.ValueAsInt(end), vmvalue.ValueAsInt(step))
+	return vmvalue.ObjAsValue(iterator), nil
+}
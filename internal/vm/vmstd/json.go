@@ -0,0 +1,337 @@
+package vmstd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/leonardinius/goloxvm/internal/vm/vmmem"
+	"github.com/leonardinius/goloxvm/internal/vm/vmvalue"
+)
+
+// MaxJSONDepth limits nesting of JSON documents,
+// nested values are kept on the VM stack while being decoded/encoded.
+const MaxJSONDepth = 512
+
+var (
+	errJSONParseArgument  = errors.New("jsonParse: argument must be a string")
+	errJSONParseDepth     = errors.New("jsonParse: nesting too deep")
+	errJSONIndentArgument = errors.New("jsonStringify: indent must be nil, a number or a string")
+	errJSONCycle          = errors.New("jsonStringify: cycle detected")
+	errJSONDepth          = errors.New("jsonStringify: nesting too deep")
+	errJSONMapKey         = errors.New("jsonStringify: map keys must be strings")
+	errJSONNumber         = errors.New("jsonStringify: NaN and Infinity are not valid JSON")
+)
+
+func StdJSONParse(value vmvalue.Value) (vmvalue.Value, error) {
+	if !vmvalue.IsString(value) {
+		return vmvalue.NilValue, errJSONParseArgument
+	}
+
+	// validate upfront, so the token stream below is known to be well-formed
+	// and syntax errors carry the offset of the problem
+	data := vmvalue.ValueAsStringChars(value)
+	if err := json.Unmarshal(data, new(json.RawMessage)); err != nil {
+		return vmvalue.NilValue, jsonParseError(err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return jsonDecode(decoder, 0)
+}
+
+// jsonNumber decodes numbers without fraction and exponent as integers, if they fit.
+func jsonNumber(num json.Number) (vmvalue.Value, error) {
+	if !strings.ContainsAny(num.String(), ".eE") {
+		if n, err := num.Int64(); err == nil {
+			return vmvalue.IntAsValue(n), nil
+		}
+	}
+	f, err := num.Float64()
+	if err != nil {
+		return vmvalue.NilValue, jsonParseError(err)
+	}
+	return vmvalue.NumberAsValue(f), nil
+}
+
+func jsonDecode(decoder *json.Decoder, depth int) (vmvalue.Value, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return vmvalue.NilValue, jsonParseError(err)
+	}
+
+	switch t := token.(type) {
+	case nil:
+		return vmvalue.NilValue, nil
+	case bool:
+		return vmvalue.BoolAsValue(t), nil
+	case json.Number:
+		return jsonNumber(t)
+	case string:
+		return vmvalue.ObjAsValue(vmvalue.StringInternCopy([]byte(t))), nil
+	case json.Delim:
+		if depth >= MaxJSONDepth {
+			return vmvalue.NilValue, errJSONParseDepth
+		}
+		if t == '[' {
+			return jsonDecodeList(decoder, depth+1)
+		}
+		return jsonDecodeMap(decoder, depth+1)
+	default:
+		return vmvalue.NilValue, fmt.Errorf("jsonParse: unexpected token %v", token)
+	}
+}
+
+func jsonDecodeList(decoder *json.Decoder, depth int) (vmvalue.Value, error) {
+	list := vmvalue.NewList(vmvalue.NewValueArray())
+	listValue := vmvalue.ObjAsValue(list)
+	vmmem.PushRetainGC(vmvalue.ValueAsNanBoxed(listValue))
+	defer vmmem.PopReleaseGC()
+
+	for decoder.More() {
+		item, err := jsonDecode(decoder, depth)
+		if err != nil {
+			return vmvalue.NilValue, err
+		}
+		vmmem.PushRetainGC(vmvalue.ValueAsNanBoxed(item))
+		list.Items.Write(item)
+		vmmem.PopReleaseGC()
+	}
+
+	// closing ']'
+	if _, err := decoder.Token(); err != nil {
+		return vmvalue.NilValue, jsonParseError(err)
+	}
+	return listValue, nil
+}
+
+func jsonDecodeMap(decoder *json.Decoder, depth int) (vmvalue.Value, error) {
+	m := vmvalue.NewMap()
+	mapValue := vmvalue.ObjAsValue(m)
+	vmmem.PushRetainGC(vmvalue.ValueAsNanBoxed(mapValue))
+	defer vmmem.PopReleaseGC()
+
+	for decoder.More() {
+		// object keys are always strings, decoder validates it
+		key, err := jsonDecode(decoder, depth)
+		if err != nil {
+			return vmvalue.NilValue, err
+		}
+		vmmem.PushRetainGC(vmvalue.ValueAsNanBoxed(key))
+		value, err := jsonDecode(decoder, depth)
+		if err != nil {
+			vmmem.PopReleaseGC()
+			return vmvalue.NilValue, err
+		}
+		vmmem.PushRetainGC(vmvalue.ValueAsNanBoxed(value))
+		m.Table.Set(key, value)
+		vmmem.PopReleaseGC()
+		vmmem.PopReleaseGC()
+	}
+
+	// closing '}'
+	if _, err := decoder.Token(); err != nil {
+		return vmvalue.NilValue, jsonParseError(err)
+	}
+	return mapValue, nil
+}
+
+func jsonParseError(err error) error {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) && syntaxErr.Offset > 0 {
+		return fmt.Errorf("jsonParse: %w (at offset %d)", err, syntaxErr.Offset)
+	}
+	return fmt.Errorf("jsonParse: %w", err)
+}
+
+type jsonEncoder struct {
+	buf      []byte
+	indent   string
+	visiting []vmvalue.Value
+}
+
+func StdJSONStringify(value, indent vmvalue.Value) (vmvalue.Value, error) {
+	encoder := jsonEncoder{}
+	switch {
+	case vmvalue.IsNil(indent):
+	case vmvalue.IsNumber(indent):
+		encoder.indent = strings.Repeat(" ", max(0, min(10, int(vmvalue.ValueAsNumber(indent)))))
+	case vmvalue.IsString(indent):
+		encoder.indent = string(vmvalue.ValueAsStringChars(indent))
+	default:
+		return vmvalue.NilValue, errJSONIndentArgument
+	}
+
+	if err := encoder.encode(value); err != nil {
+		return vmvalue.NilValue, err
+	}
+
+	chars := vmmem.AllocateSlice[byte](len(encoder.buf))
+	copy(chars, encoder.buf)
+	return vmvalue.ObjAsValue(vmvalue.StringInternTake(chars)), nil
+}
+
+func (e *jsonEncoder) encode(value vmvalue.Value) error {
+	switch {
+	case vmvalue.IsNil(value):
+		e.buf = append(e.buf, "null"...)
+	case vmvalue.IsBool(value):
+		e.buf = strconv.AppendBool(e.buf, vmvalue.ValueAsBool(value))
+	case vmvalue.IsInt(value):
+		e.buf = strconv.AppendInt(e.buf, vmvalue.ValueAsInt(value), 10)
+	case vmvalue.IsNumber(value):
+		return e.encodeNumber(vmvalue.ValueAsNumber(value))
+	case vmvalue.IsBigInt(value):
+		e.buf = vmvalue.ValueAsBigInt(value).Value.Append(e.buf, 10)
+	case vmvalue.IsDecimal(value):
+		e.buf = append(e.buf, vmvalue.DecimalString(vmvalue.ValueAsDecimal(value))...)
+	case vmvalue.IsString(value):
+		e.encodeString(vmvalue.ValueAsStringChars(value))
+	case vmvalue.IsList(value), vmvalue.IsMap(value), vmvalue.IsInstance(value):
+		return e.encodeContainer(value)
+	default:
+		return fmt.Errorf("jsonStringify: unable to encode %s", vmvalue.TypeName(value))
+	}
+	return nil
+}
+
+func (e *jsonEncoder) encodeNumber(num float64) error {
+	if math.IsNaN(num) || math.IsInf(num, 0) {
+		return errJSONNumber
+	}
+	if num == math.Trunc(num) && math.Abs(num) < 1e21 {
+		e.buf = strconv.AppendFloat(e.buf, num, 'f', -1, 64)
+	} else {
+		e.buf = strconv.AppendFloat(e.buf, num, 'g', -1, 64)
+	}
+	return nil
+}
+
+func (e *jsonEncoder) encodeContainer(value vmvalue.Value) error {
+	if slices.Contains(e.visiting, value) {
+		return errJSONCycle
+	}
+	if len(e.visiting) >= MaxJSONDepth {
+		return errJSONDepth
+	}
+	e.visiting = append(e.visiting, value)
+	defer func() { e.visiting = e.visiting[:len(e.visiting)-1] }()
+
+	switch {
+	case vmvalue.IsList(value):
+		items := vmvalue.ValueAsList(value).Items
+		e.buf = append(e.buf, '[')
+		for i, item := range items {
+			e.separator(i)
+			if err := e.encode(item); err != nil {
+				return err
+			}
+		}
+		e.closing(len(items), ']')
+	case vmvalue.IsMap(value):
+		var err error
+		count := 0
+		e.buf = append(e.buf, '{')
+		vmvalue.ValueAsMap(value).Table.Each(func(key, item vmvalue.Value) {
+			if err != nil {
+				return
+			}
+			if !vmvalue.IsString(key) {
+				err = errJSONMapKey
+				return
+			}
+			err = e.field(count, vmvalue.ValueAsStringChars(key), item)
+			count++
+		})
+		if err != nil {
+			return err
+		}
+		e.closing(count, '}')
+	default:
+		fields := &vmvalue.ValueAsInstance(value).Fields
+		names := []*vmvalue.ObjString{}
+		fields.Each(func(key *vmvalue.ObjString, _ vmvalue.Value) {
+			// private fields are not accessible outside of the class
+			if !vmvalue.IsPrivateName(key) {
+				names = append(names, key)
+			}
+		})
+		// fields table has no stable order, sort to make output deterministic
+		slices.SortFunc(names, func(a, b *vmvalue.ObjString) int {
+			return bytes.Compare(a.Chars, b.Chars)
+		})
+		e.buf = append(e.buf, '{')
+		for i, name := range names {
+			item, _ := fields.Get(name)
+			if err := e.field(i, name.Chars, item); err != nil {
+				return err
+			}
+		}
+		e.closing(len(names), '}')
+	}
+	return nil
+}
+
+func (e *jsonEncoder) field(i int, name []byte, value vmvalue.Value) error {
+	e.separator(i)
+	e.encodeString(name)
+	e.buf = append(e.buf, ':')
+	if e.indent != "" {
+		e.buf = append(e.buf, ' ')
+	}
+	return e.encode(value)
+}
+
+func (e *jsonEncoder) separator(i int) {
+	if i > 0 {
+		e.buf = append(e.buf, ',')
+	}
+	e.newline(len(e.visiting))
+}
+
+func (e *jsonEncoder) closing(count int, c byte) {
+	if count > 0 {
+		e.newline(len(e.visiting) - 1)
+	}
+	e.buf = append(e.buf, c)
+}
+
+func (e *jsonEncoder) newline(depth int) {
+	if e.indent == "" {
+		return
+	}
+	e.buf = append(e.buf, '\n')
+	for range depth {
+		e.buf = append(e.buf, e.indent...)
+	}
+}
+
+func (e *jsonEncoder) encodeString(chars []byte) {
+	const hex = "0123456789abcdef"
+
+	e.buf = append(e.buf, '"')
+	for _, c := range chars {
+		switch c {
+		case '"', '\\':
+			e.buf = append(e.buf, '\\', c)
+		case '\n':
+			e.buf = append(e.buf, '\\', 'n')
+		case '\r':
+			e.buf = append(e.buf, '\\', 'r')
+		case '\t':
+			e.buf = append(e.buf, '\\', 't')
+		default:
+			if c < 0x20 {
+				e.buf = append(e.buf, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+			} else {
+				e.buf = append(e.buf, c)
+			}
+		}
+	}
+	e.buf = append(e.buf, '"')
+}
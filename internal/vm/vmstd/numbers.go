@@ -0,0 +1,101 @@
+package vmstd
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"strconv"
+
+	"github.com/leonardinius/goloxvm/internal/vm/vmvalue"
+)
+
+var (
+	errToBigIntArgument  = errors.New("toBigInt: argument must be a number or a string")
+	errToBigIntFraction  = errors.New("toBigInt: number must be an integer")
+	errToBigIntString    = errors.New("toBigInt: invalid integer string")
+	errToDecimalArgument = errors.New("toDecimal: argument must be a number or a string")
+	errToDecimalFloat    = errors.New("toDecimal: NaN and Infinity can't be converted")
+	errToDecimalString   = errors.New("toDecimal: invalid decimal string")
+	errToNumberArgument  = errors.New("toNumber: argument must be a number or a string")
+	errToNumberString    = errors.New("toNumber: invalid number string")
+)
+
+// StdToBigInt converts numbers and strings to big integer, decimals are truncated.
+func StdToBigInt(value vmvalue.Value) (vmvalue.Value, error) {
+	var result *big.Int
+	switch {
+	case vmvalue.IsBigInt(value):
+		return value, nil
+	case vmvalue.IsInt(value):
+		result = big.NewInt(vmvalue.ValueAsInt(value))
+	case vmvalue.IsNumber(value):
+		num := vmvalue.ValueAsNumber(value)
+		if math.IsInf(num, 0) || num != math.Trunc(num) {
+			return vmvalue.NilValue, errToBigIntFraction
+		}
+		result, _ = big.NewFloat(num).Int(nil)
+	case vmvalue.IsDecimal(value):
+		d := vmvalue.ValueAsDecimal(value)
+		scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(d.Scale)), nil)
+		result = new(big.Int).Quo(d.Unscaled, scale)
+	case vmvalue.IsString(value):
+		var ok bool
+		if result, ok = new(big.Int).SetString(string(vmvalue.ValueAsStringChars(value)), 10); !ok {
+			return vmvalue.NilValue, errToBigIntString
+		}
+	default:
+		return vmvalue.NilValue, errToBigIntArgument
+	}
+
+	return vmvalue.ObjAsValue(vmvalue.NewBigInt(result)), nil
+}
+
+// StdToDecimal converts numbers and strings to decimal, floats use their shortest representation.
+func StdToDecimal(value vmvalue.Value) (vmvalue.Value, error) {
+	var str string
+	switch {
+	case vmvalue.IsDecimal(value):
+		return value, nil
+	case vmvalue.IsBigInt(value):
+		return vmvalue.ObjAsValue(vmvalue.NewDecimal(vmvalue.ValueAsBigInt(value).Value, 0)), nil
+	case vmvalue.IsInt(value):
+		return vmvalue.ObjAsValue(vmvalue.NewDecimal(big.NewInt(vmvalue.ValueAsInt(value)), 0)), nil
+	case vmvalue.IsNumber(value):
+		num := vmvalue.ValueAsNumber(value)
+		if math.IsNaN(num) || math.IsInf(num, 0) {
+			return vmvalue.NilValue, errToDecimalFloat
+		}
+		str = strconv.FormatFloat(num, 'f', -1, 64)
+	case vmvalue.IsString(value):
+		str = string(vmvalue.ValueAsStringChars(value))
+	default:
+		return vmvalue.NilValue, errToDecimalArgument
+	}
+
+	unscaled, scale, ok := vmvalue.ParseDecimal(str)
+	if !ok {
+		return vmvalue.NilValue, errToDecimalString
+	}
+	return vmvalue.ObjAsValue(vmvalue.NewDecimal(unscaled, scale)), nil
+}
+
+// StdToNumber converts big numbers and strings to an integer or a float.
+func StdToNumber(value vmvalue.Value) (vmvalue.Value, error) {
+	switch {
+	case vmvalue.IsNumber(value):
+		return value, nil
+	case vmvalue.IsBigNumber(value):
+		return vmvalue.BigToNumber(value), nil
+	case vmvalue.IsString(value):
+		str := string(vmvalue.ValueAsStringChars(value))
+		if n, err := strconv.ParseInt(str, 10, 64); err == nil {
+			return vmvalue.IntAsValue(n), nil
+		}
+		if f, err := strconv.ParseFloat(str, 64); err == nil {
+			return vmvalue.NumberAsValue(f), nil
+		}
+		return vmvalue.NilValue, errToNumberString
+	default:
+		return vmvalue.NilValue, errToNumberArgument
+	}
+}
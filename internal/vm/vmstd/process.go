@@ -0,0 +1,134 @@
+package vmstd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+
+	"github.com/leonardinius/goloxvm/internal/vm/vmmem"
+	"github.com/leonardinius/goloxvm/internal/vm/vmvalue"
+)
+
+var (
+	errExitArgument   = errors.New("exit: argument must be an integer")
+	errGetenvArgument = errors.New("getenv: argument must be a string")
+	errSetenvArgument = errors.New("setenv: arguments must be a string and a string or nil")
+	errExecArgument   = errors.New("exec: arguments must be a string and a list of strings")
+)
+
+// ExitError is returned by exit native to stop the interpreter with given exit code.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// SandboxError is reported when the native is disabled by the sandbox configuration.
+type SandboxError struct {
+	Name string
+}
+
+func (e *SandboxError) Error() string {
+	return e.Name + ": disabled by sandbox"
+}
+
+func StdExit(code vmvalue.Value) (vmvalue.Value, error) {
+	if !vmvalue.IsNumber(code) {
+		return vmvalue.NilValue, errExitArgument
+	}
+
+	num := vmvalue.ValueAsNumber(code)
+	if num != math.Trunc(num) || num < 0 || num > 255 {
+		return vmvalue.NilValue, errExitArgument
+	}
+	return vmvalue.NilValue, &ExitError{Code: int(num)}
+}
+
+func StdGetenv(name vmvalue.Value) (vmvalue.Value, error) {
+	if !vmvalue.IsString(name) {
+		return vmvalue.NilValue, errGetenvArgument
+	}
+
+	value, found := os.LookupEnv(string(vmvalue.ValueAsStringChars(name)))
+	if !found {
+		return vmvalue.NilValue, nil
+	}
+	return vmvalue.ObjAsValue(vmvalue.StringInternCopy([]byte(value))), nil
+}
+
+func StdSetenv(name, value vmvalue.Value) (vmvalue.Value, error) {
+	if !vmvalue.IsString(name) || !(vmvalue.IsString(value) || vmvalue.IsNil(value)) {
+		return vmvalue.NilValue, errSetenvArgument
+	}
+
+	key := string(vmvalue.ValueAsStringChars(name))
+	var err error
+	if vmvalue.IsNil(value) {
+		err = os.Unsetenv(key)
+	} else {
+		err = os.Setenv(key, string(vmvalue.ValueAsStringChars(value)))
+	}
+	if err != nil {
+		return vmvalue.NilValue, fmt.Errorf("setenv: %w", err)
+	}
+	return vmvalue.NilValue, nil
+}
+
+// StdExec runs the command and returns map with "stdout", "stderr" and "code" entries.
+func StdExec(command, args vmvalue.Value) (vmvalue.Value, error) {
+	if !vmvalue.IsString(command) || !vmvalue.IsList(args) {
+		return vmvalue.NilValue, errExecArgument
+	}
+
+	items := vmvalue.ValueAsList(args).Items
+	cmdArgs := make([]string, len(items))
+	for i, item := range items {
+		if !vmvalue.IsString(item) {
+			return vmvalue.NilValue, errExecArgument
+		}
+		cmdArgs[i] = string(vmvalue.ValueAsStringChars(item))
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(string(vmvalue.ValueAsStringChars(command)), cmdArgs...) //nolint:gosec // it is the point
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		var execErr *exec.Error
+		switch {
+		case errors.As(err, &exitErr):
+			// non-zero exit code is reported in the result
+		case errors.As(err, &execErr):
+			// already prefixed with "exec: "
+			return vmvalue.NilValue, err
+		default:
+			return vmvalue.NilValue, fmt.Errorf("exec: %w", err)
+		}
+	}
+
+	result := vmvalue.NewMap()
+	resultValue := vmvalue.ObjAsValue(result)
+	vmmem.PushRetainGC(vmvalue.ValueAsNanBoxed(resultValue))
+	defer vmmem.PopReleaseGC()
+
+	setMapEntry(result, "stdout", vmvalue.ObjAsValue(vmvalue.StringInternCopy(stdout.Bytes())))
+	setMapEntry(result, "stderr", vmvalue.ObjAsValue(vmvalue.StringInternCopy(stderr.Bytes())))
+	setMapEntry(result, "code", vmvalue.IntAsValue(int64(cmd.ProcessState.ExitCode())))
+	return resultValue, nil
+}
+
+// setMapEntry sets string keyed entry, keeping both key and value reachable for GC.
+func setMapEntry(m *vmvalue.ObjMap, key string, value vmvalue.Value) {
+	vmmem.PushRetainGC(vmvalue.ValueAsNanBoxed(value))
+	defer vmmem.PopReleaseGC()
+	keyValue := vmvalue.ObjAsValue(vmvalue.StringInternCopy([]byte(key)))
+	vmmem.PushRetainGC(vmvalue.ValueAsNanBoxed(keyValue))
+	defer vmmem.PopReleaseGC()
+	m.Table.Set(keyValue, value)
+}
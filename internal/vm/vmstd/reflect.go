@@ -0,0 +1,148 @@
+package vmstd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/leonardinius/goloxvm/internal/vm/vmmem"
+	"github.com/leonardinius/goloxvm/internal/vm/vmvalue"
+)
+
+var (
+	errInstanceOfArgument   = errors.New("instanceOf: second argument must be a class")
+	errClassNameArgument    = errors.New("className: argument must be a class or an instance")
+	errSuperclassOfArgument = errors.New("superclassOf: argument must be a class")
+	errFieldsArgument       = errors.New("fields: argument must be an instance")
+	errMethodsArgument      = errors.New("methods: argument must be a class or an instance")
+	errFieldArgument        = errors.New("arguments must be an instance and a field name")
+	errPrivateField         = errors.New("private members can't be accessed by name")
+)
+
+// StdTypeOf returns type name of the value: "number", "string", "instance", etc.
+func StdTypeOf(value vmvalue.Value) (vmvalue.Value, error) {
+	return vmvalue.ObjAsValue(vmvalue.StringInternCopy([]byte(vmvalue.TypeName(value)))), nil
+}
+
+func StdInstanceOf(value, class vmvalue.Value) (vmvalue.Value, error) {
+	if !vmvalue.IsClass(class) {
+		return vmvalue.NilValue, errInstanceOfArgument
+	}
+	return vmvalue.BoolAsValue(vmvalue.IsInstanceOf(value, vmvalue.ValueAsClass(class))), nil
+}
+
+// StdClassOf returns the class of the instance, nil for other values.
+func StdClassOf(value vmvalue.Value) (vmvalue.Value, error) {
+	if !vmvalue.IsInstance(value) {
+		return vmvalue.NilValue, nil
+	}
+	return vmvalue.ObjAsValue(vmvalue.ValueAsInstance(value).Klass), nil
+}
+
+func StdClassName(value vmvalue.Value) (vmvalue.Value, error) {
+	class, ok := classOrInstanceClass(value)
+	if !ok {
+		return vmvalue.NilValue, errClassNameArgument
+	}
+	return vmvalue.ObjAsValue(class.Name), nil
+}
+
+// StdSuperclassOf returns the superclass, nil if the class does not inherit.
+func StdSuperclassOf(value vmvalue.Value) (vmvalue.Value, error) {
+	if !vmvalue.IsClass(value) {
+		return vmvalue.NilValue, errSuperclassOfArgument
+	}
+	superclass := vmvalue.ValueAsClass(value).Superclass
+	if superclass == nil {
+		return vmvalue.NilValue, nil
+	}
+	return vmvalue.ObjAsValue(superclass), nil
+}
+
+// StdFields returns sorted list of public field names of the instance.
+func StdFields(value vmvalue.Value) (vmvalue.Value, error) {
+	if !vmvalue.IsInstance(value) {
+		return vmvalue.NilValue, errFieldsArgument
+	}
+	return publicNames(&vmvalue.ValueAsInstance(value).Fields), nil
+}
+
+// StdMethods returns sorted list of public method names of the class, including inherited ones.
+func StdMethods(value vmvalue.Value) (vmvalue.Value, error) {
+	class, ok := classOrInstanceClass(value)
+	if !ok {
+		return vmvalue.NilValue, errMethodsArgument
+	}
+	return publicNames(&class.Methods), nil
+}
+
+func StdHasField(instance, name vmvalue.Value) (vmvalue.Value, error) {
+	fields, key, err := instanceField("hasField", instance, name)
+	if err != nil {
+		return vmvalue.NilValue, err
+	}
+	_, found := fields.Get(key)
+	return vmvalue.BoolAsValue(found), nil
+}
+
+// StdGetField returns the field value by dynamic name, nil if the field is not set.
+func StdGetField(instance, name vmvalue.Value) (vmvalue.Value, error) {
+	fields, key, err := instanceField("getField", instance, name)
+	if err != nil {
+		return vmvalue.NilValue, err
+	}
+	value, _ := fields.Get(key)
+	return value, nil
+}
+
+func StdSetField(instance, name, value vmvalue.Value) (vmvalue.Value, error) {
+	fields, key, err := instanceField("setField", instance, name)
+	if err != nil {
+		return vmvalue.NilValue, err
+	}
+	fields.Set(key, value)
+	return value, nil
+}
+
+func classOrInstanceClass(value vmvalue.Value) (*vmvalue.ObjClass, bool) {
+	switch {
+	case vmvalue.IsClass(value):
+		return vmvalue.ValueAsClass(value), true
+	case vmvalue.IsInstance(value):
+		return vmvalue.ValueAsInstance(value).Klass, true
+	default:
+		return nil, false
+	}
+}
+
+func instanceField(fnName string, instance, name vmvalue.Value) (*vmvalue.Table, *vmvalue.ObjString, error) {
+	if !vmvalue.IsInstance(instance) || !vmvalue.IsString(name) {
+		return nil, nil, fmt.Errorf("%s: %w", fnName, errFieldArgument)
+	}
+	key := vmvalue.ValueAsString(name)
+	if vmvalue.IsPrivateName(key) {
+		return nil, nil, fmt.Errorf("%s: %w", fnName, errPrivateField)
+	}
+	return &vmvalue.ValueAsInstance(instance).Fields, key, nil
+}
+
+func publicNames(table *vmvalue.Table) vmvalue.Value {
+	count := 0
+	table.Each(func(key *vmvalue.ObjString, _ vmvalue.Value) {
+		if !vmvalue.IsPrivateName(key) {
+			count++
+		}
+	})
+
+	names := vmmem.AllocateSlice[vmvalue.Value](count)[:0]
+	table.Each(func(key *vmvalue.ObjString, _ vmvalue.Value) {
+		if !vmvalue.IsPrivateName(key) {
+			names = append(names, vmvalue.ObjAsValue(key))
+		}
+	})
+	slices.SortFunc(names, func(a, b vmvalue.Value) int {
+		return bytes.Compare(vmvalue.ValueAsStringChars(a), vmvalue.ValueAsStringChars(b))
+	})
+	return vmvalue.ObjAsValue(vmvalue.NewList(names))
+}
@@ -3,6 +3,7 @@ package vmstd
 import (
 	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/leonardinius/goloxvm/internal/vm/vmvalue"
@@ -20,8 +21,22 @@ func StdFormatNumber(value vmvalue.Value) (vmvalue.Value, error) {
 		return vmvalue.NilValue, errArgumentNotNumber
 	}
 
-	number := vmvalue.ValueAsNumber(value)
-	str := fmt.Sprintf("%#v", number)
+	var str string
+	if vmvalue.IsInt(value) {
+		str = strconv.FormatInt(vmvalue.ValueAsInt(value), 10)
+	} else {
+		str = fmt.Sprintf("%#v", vmvalue.ValueAsNumber(value))
+	}
 	obj := vmvalue.StringInternCopy([]byte(str))
 	return vmvalue.ObjAsValue(obj), nil
 }
+
+var errFiberNewArgument = errors.New("Fiber.new: argument must be a function")
+
+// StdFiberNew creates the fiber which runs the function once resumed.
+func StdFiberNew(fn vmvalue.Value) (vmvalue.Value, error) {
+	if !vmvalue.IsClosure(fn) {
+		return vmvalue.NilValue, errFiberNewArgument
+	}
+	return vmvalue.ObjAsValue(vmvalue.NewFiber(vmvalue.ValueAsClosure(fn))), nil
+}
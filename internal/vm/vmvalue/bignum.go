@@ -0,0 +1,342 @@
+package vmvalue
+
+import (
+	"errors"
+	"hash/maphash"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// DecimalDivisionScale is the minimal number of fractional digits of decimal division result.
+const DecimalDivisionScale = 16
+
+var (
+	ErrBigMixFloat      = errors.New("Can't mix big numbers and floats, convert explicitly.") //nolint:stylecheck,revive // user facing message
+	ErrBigDivideByZero  = errors.New("Division by zero.")                                     //nolint:stylecheck,revive // user facing message
+	ErrBigNotArithmetic = errors.New("Operands must be numbers.")                             //nolint:stylecheck,revive // user facing message
+)
+
+// BigOp is arithmetic operation on big numbers.
+type BigOp byte
+
+const (
+	_ BigOp = iota
+	BigAdd
+	BigSubtract
+	BigMultiply
+	BigDivide
+	BigModulo
+)
+
+// ObjBigInt is arbitrary precision integer, `123n`.
+type ObjBigInt struct {
+	Obj
+	Value *big.Int
+}
+
+// ObjDecimal is arbitrary precision decimal number, `1.10d`.
+// The value is Unscaled * 10^-Scale, the scale is kept so `1.10d` prints as `1.10`.
+type ObjDecimal struct {
+	Obj
+	Unscaled *big.Int
+	Scale    int32
+}
+
+func NewBigInt(value *big.Int) *ObjBigInt {
+	obj := allocateObject[ObjBigInt](ObjTypeBigInt, gObjBigIntSize)
+	obj.Value = value
+	return obj
+}
+
+func NewDecimal(unscaled *big.Int, scale int32) *ObjDecimal {
+	obj := allocateObject[ObjDecimal](ObjTypeDecimal, gObjDecimalSize)
+	obj.Unscaled = unscaled
+	obj.Scale = scale
+	return obj
+}
+
+func IsBigInt(v Value) bool {
+	return isObjType(v, ObjTypeBigInt)
+}
+
+func IsDecimal(v Value) bool {
+	return isObjType(v, ObjTypeDecimal)
+}
+
+// IsBigNumber reports whether the value is either big integer or decimal.
+func IsBigNumber(v Value) bool {
+	return IsBigInt(v) || IsDecimal(v)
+}
+
+func ValueAsBigInt(v Value) *ObjBigInt {
+	return valueAsObj[ObjBigInt](v)
+}
+
+func ValueAsDecimal(v Value) *ObjDecimal {
+	return valueAsObj[ObjDecimal](v)
+}
+
+// ParseDecimal parses `[+-]digits[.digits]` string.
+func ParseDecimal(s string) (unscaled *big.Int, scale int32, ok bool) {
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	digits := strings.TrimLeft(intPart, "+-")
+	if len(intPart)-len(digits) > 1 || digits == "" || len(fracPart) > math.MaxInt16 ||
+		strings.ContainsAny(fracPart, "+-") {
+		return nil, 0, false
+	}
+
+	unscaled, ok = new(big.Int).SetString(intPart+fracPart, 10)
+	return unscaled, int32(len(fracPart)), ok
+}
+
+// exactNum is common representation of integers, big integers and decimals.
+type exactNum struct {
+	unscaled *big.Int
+	scale    int32
+	decimal  bool
+}
+
+func toExactNum(v Value) (exactNum, bool) {
+	switch {
+	case IsInt(v):
+		return exactNum{unscaled: big.NewInt(ValueAsInt(v))}, true
+	case IsBigInt(v):
+		return exactNum{unscaled: ValueAsBigInt(v).Value}, true
+	case IsDecimal(v):
+		d := ValueAsDecimal(v)
+		return exactNum{unscaled: d.Unscaled, scale: d.Scale, decimal: true}, true
+	default:
+		return exactNum{}, false
+	}
+}
+
+// rescale returns unscaled value for the larger scale.
+func (n exactNum) rescale(scale int32) *big.Int {
+	if scale == n.scale {
+		return n.unscaled
+	}
+	return new(big.Int).Mul(n.unscaled, pow10(scale-n.scale))
+}
+
+func (n exactNum) rat() *big.Rat {
+	r := new(big.Rat).SetInt(n.unscaled)
+	if n.scale > 0 {
+		r.Quo(r, new(big.Rat).SetInt(pow10(n.scale)))
+	}
+	return r
+}
+
+func pow10(n int32) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// BigArith applies the arithmetic operation, at least one of the operands is expected to be a big number.
+// Integers are promoted to big integers, big integers to decimals. Floats are rejected.
+func BigArith(op BigOp, a, b Value) (Value, error) {
+	x, xok := toExactNum(a)
+	y, yok := toExactNum(b)
+	if !xok || !yok {
+		if IsFloat(a) || IsFloat(b) {
+			return NilValue, ErrBigMixFloat
+		}
+		return NilValue, ErrBigNotArithmetic
+	}
+
+	if !x.decimal && !y.decimal {
+		return bigIntArith(op, x.unscaled, y.unscaled)
+	}
+	return decimalArith(op, x, y)
+}
+
+func bigIntArith(op BigOp, x, y *big.Int) (Value, error) {
+	result := new(big.Int)
+	switch op {
+	case BigAdd:
+		result.Add(x, y)
+	case BigSubtract:
+		result.Sub(x, y)
+	case BigMultiply:
+		result.Mul(x, y)
+	case BigDivide, BigModulo:
+		if y.Sign() == 0 {
+			return NilValue, ErrBigDivideByZero
+		}
+		if op == BigDivide {
+			result.Quo(x, y)
+		} else {
+			result.Rem(x, y)
+		}
+	}
+	return ObjAsValue(NewBigInt(result)), nil
+}
+
+func decimalArith(op BigOp, x, y exactNum) (Value, error) {
+	scale := max(x.scale, y.scale)
+	result := new(big.Int)
+	switch op {
+	case BigAdd:
+		result.Add(x.rescale(scale), y.rescale(scale))
+	case BigSubtract:
+		result.Sub(x.rescale(scale), y.rescale(scale))
+	case BigMultiply:
+		result.Mul(x.unscaled, y.unscaled)
+		scale = x.scale + y.scale
+	case BigModulo:
+		if y.unscaled.Sign() == 0 {
+			return NilValue, ErrBigDivideByZero
+		}
+		result.Rem(x.rescale(scale), y.rescale(scale))
+	case BigDivide:
+		if y.unscaled.Sign() == 0 {
+			return NilValue, ErrBigDivideByZero
+		}
+		minScale := scale
+		scale = max(scale, DecimalDivisionScale)
+		// x/y * 10^scale = ux * 10^(sy+scale) / (uy * 10^sx)
+		num := new(big.Int).Mul(x.unscaled, pow10(y.scale+scale))
+		den := new(big.Int).Mul(y.unscaled, pow10(x.scale))
+		divRoundHalfEven(result, num, den)
+		result, scale = stripTrailingZeros(result, scale, minScale)
+	}
+	return ObjAsValue(NewDecimal(result, scale)), nil
+}
+
+// divRoundHalfEven sets z = num/den rounded half to even.
+func divRoundHalfEven(z, num, den *big.Int) {
+	rem := new(big.Int)
+	z.QuoRem(num, den, rem)
+	if rem.Sign() == 0 {
+		return
+	}
+
+	// compare 2*|rem| with |den|
+	cmp := new(big.Int).Abs(rem)
+	cmp.Lsh(cmp, 1)
+	c := cmp.CmpAbs(den)
+	if c > 0 || (c == 0 && z.Bit(0) == 1) {
+		if num.Sign()*den.Sign() < 0 {
+			z.Sub(z, big.NewInt(1))
+		} else {
+			z.Add(z, big.NewInt(1))
+		}
+	}
+}
+
+func stripTrailingZeros(unscaled *big.Int, scale, minScale int32) (*big.Int, int32) {
+	ten := big.NewInt(10)
+	q, r := new(big.Int), new(big.Int)
+	for scale > minScale {
+		q.QuoRem(unscaled, ten, r)
+		if r.Sign() != 0 {
+			break
+		}
+		unscaled, q = q, unscaled
+		scale--
+	}
+	return unscaled, scale
+}
+
+// toRat converts any number to exact rational, ok is false for non-numbers, NaN and infinities.
+func toRat(v Value) (*big.Rat, bool) {
+	if n, ok := toExactNum(v); ok {
+		return n.rat(), true
+	}
+	if IsFloat(v) {
+		f := ValueAsNumber(v)
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, false
+		}
+		return new(big.Rat).SetFloat64(f), true
+	}
+	return nil, false
+}
+
+// BigCompare compares two numbers where at least one is a big number.
+// ok is false if either is not a number or is NaN.
+func BigCompare(a, b Value) (result int, ok bool) {
+	x, xok := toRat(a)
+	y, yok := toRat(b)
+	if xok && yok {
+		return x.Cmp(y), true
+	}
+
+	// infinities compare greater or less than any finite number
+	fa, fb := infSign(a), infSign(b)
+	if (fa != 0 || xok) && (fb != 0 || yok) {
+		return cmpInt(fa, fb), true
+	}
+	return 0, false
+}
+
+func infSign(v Value) int {
+	if IsFloat(v) {
+		if f := ValueAsNumber(v); math.IsInf(f, 0) {
+			if f > 0 {
+				return 1
+			}
+			return -1
+		}
+	}
+	return 0
+}
+
+func cmpInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func isBigEqual(a, b Value) bool {
+	result, ok := BigCompare(a, b)
+	return ok && result == 0
+}
+
+// hashBigNumber is consistent with equality to integers and floats.
+func hashBigNumber(v Value) uint64 {
+	r, _ := toRat(v)
+	if r.IsInt() && r.Num().IsInt64() {
+		return mixHash(uint64(r.Num().Int64())) //nolint:gosec // two's complement
+	}
+	if f, exact := r.Float64(); exact {
+		return mixHash(math.Float64bits(f))
+	}
+	return maphash.String(gSeed, r.String())
+}
+
+// BigToNumber converts big number to an integer if it fits, or to a float.
+func BigToNumber(v Value) Value {
+	if IsBigInt(v) && ValueAsBigInt(v).Value.IsInt64() {
+		return IntAsValue(ValueAsBigInt(v).Value.Int64())
+	}
+	r, _ := toRat(v)
+	f, _ := r.Float64()
+	return NumberAsValue(f)
+}
+
+// DecimalString formats the decimal keeping its scale, `1.10`.
+func DecimalString(d *ObjDecimal) string {
+	digits := new(big.Int).Abs(d.Unscaled).String()
+	var sb strings.Builder
+	if d.Unscaled.Sign() < 0 {
+		sb.WriteByte('-')
+	}
+	if d.Scale <= 0 {
+		sb.WriteString(digits)
+		return sb.String()
+	}
+
+	scale := int(d.Scale)
+	if len(digits) <= scale {
+		digits = strings.Repeat("0", scale-len(digits)+1) + digits
+	}
+	sb.WriteString(digits[:len(digits)-scale])
+	sb.WriteByte('.')
+	sb.WriteString(digits[len(digits)-scale:])
+	return sb.String()
+}
@@ -0,0 +1,78 @@
+package vmvalue_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/leonardinius/goloxvm/internal/vm/vmvalue"
+)
+
+func TestParseDecimal(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		input    string
+		expected string
+		ok       bool
+	}{
+		{"1.10", "1.10", true},
+		{"-0.05", "-0.05", true},
+		{"+3", "3", true},
+		{"10.", "10", true},
+		{"0.000", "0.000", true},
+		{".5", "", false},
+		{"1.2.3", "", false},
+		{"--1", "", false},
+		{"1.-2", "", false},
+		{"abc", "", false},
+		{"", "", false},
+	} {
+		unscaled, scale, ok := vmvalue.ParseDecimal(tc.input)
+		assert.Equal(t, tc.ok, ok, tc.input)
+		if ok {
+			d := vmvalue.NewDecimal(unscaled, scale)
+			assert.Equal(t, tc.expected, vmvalue.DecimalString(d), tc.input)
+		}
+	}
+}
+
+func TestDecimalDivision(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		a, b     string
+		expected string
+	}{
+		{"1", "3", "0.3333333333333333"},
+		{"2", "3", "0.6666666666666667"},
+		{"-2", "3", "-0.6666666666666667"},
+		// exact results keep the larger operand scale
+		{"1.00", "4", "0.25"},
+		{"10.00", "4", "2.50"},
+		{"1", "0.02", "50.00"},
+		{"0.00000000000000005", "1", "0.00000000000000005"},
+		// half to even at 16th fractional digit
+		{"0.0000000000000005", "10", "0.0000000000000000"},
+		{"0.0000000000000015", "10", "0.0000000000000002"},
+		{"0.0000000000000025", "10", "0.0000000000000002"},
+		{"-0.0000000000000025", "10", "-0.0000000000000002"},
+		{"0.0000000000000026", "10", "0.0000000000000003"},
+	} {
+		a := decimalValue(t, tc.a)
+		b := decimalValue(t, tc.b)
+		result, err := vmvalue.BigArith(vmvalue.BigDivide, a, b)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expected, vmvalue.DecimalString(vmvalue.ValueAsDecimal(result)), "%s / %s", tc.a, tc.b)
+	}
+
+	_, err := vmvalue.BigArith(vmvalue.BigDivide, decimalValue(t, "1"), decimalValue(t, "0.00"))
+	assert.ErrorIs(t, err, vmvalue.ErrBigDivideByZero)
+}
+
+func decimalValue(t *testing.T, s string) vmvalue.Value {
+	t.Helper()
+	unscaled, scale, ok := vmvalue.ParseDecimal(s)
+	assert.True(t, ok, s)
+	return vmvalue.ObjAsValue(vmvalue.NewDecimal(unscaled, scale))
+}
@@ -0,0 +1,48 @@
+package vmvalue_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/leonardinius/goloxvm/internal/vm/vmvalue"
+)
+
+func TestIntNanBoxing(t *testing.T) {
+	t.Parallel()
+
+	for _, n := range []int64{
+		0, 1, -1, 42, -42,
+		vmvalue.MinSmallInt, vmvalue.MaxSmallInt,
+		vmvalue.MinSmallInt - 1, vmvalue.MaxSmallInt + 1,
+		math.MinInt64, math.MaxInt64,
+	} {
+		value := vmvalue.IntAsValue(n)
+		small := vmvalue.MinSmallInt <= n && n <= vmvalue.MaxSmallInt
+		gc()
+		assert.True(t, vmvalue.IsInt(value), "%d", n)
+		assert.True(t, vmvalue.IsNumber(value), "%d", n)
+		assert.False(t, vmvalue.IsFloat(value), "%d", n)
+		assert.Equal(t, small, vmvalue.IsSmallInt(value), "%d", n)
+		assert.Equal(t, !small, vmvalue.IsObj(value), "%d", n)
+		assert.False(t, vmvalue.IsNil(value), "%d", n)
+		assert.False(t, vmvalue.IsBool(value), "%d", n)
+		assert.Equal(t, n, vmvalue.ValueAsInt(value))
+		assert.InDelta(t, float64(n), vmvalue.ValueAsNumber(value), 0)
+	}
+}
+
+func TestIntEquality(t *testing.T) {
+	t.Parallel()
+
+	big := int64(math.MaxInt64)
+	assert.True(t, vmvalue.IsValuesEqual(vmvalue.IntAsValue(1), vmvalue.NumberAsValue(1)))
+	assert.True(t, vmvalue.IsValuesEqual(vmvalue.IntAsValue(0), vmvalue.NumberAsValue(math.Copysign(0, -1))))
+	assert.True(t, vmvalue.IsValuesEqual(vmvalue.IntAsValue(big), vmvalue.IntAsValue(big)))
+	assert.False(t, vmvalue.IsValuesEqual(vmvalue.IntAsValue(big), vmvalue.IntAsValue(big-1)))
+	assert.False(t, vmvalue.IsValuesEqual(vmvalue.IntAsValue(1), vmvalue.NilValue))
+	assert.False(t, vmvalue.IsValuesEqual(vmvalue.IntAsValue(1), vmvalue.TrueValue))
+	assert.Equal(t, vmvalue.HashValue(vmvalue.IntAsValue(3)), vmvalue.HashValue(vmvalue.NumberAsValue(3)))
+	assert.Equal(t, vmvalue.HashValue(vmvalue.IntAsValue(big)), vmvalue.HashValue(vmvalue.IntAsValue(big)))
+}
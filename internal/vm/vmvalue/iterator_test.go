@@ -0,0 +1,66 @@
+package vmvalue_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/leonardinius/goloxvm/internal/vm/vmvalue"
+)
+
+func TestRangeIterator(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name             string
+		start, end, step int64
+		expected         []int64
+	}{
+		{"ascending", 0, 5, 2, []int64{0, 2, 4}},
+		{"descending", 3, 0, -1, []int64{3, 2, 1}},
+		{"empty", 2, 2, 1, nil},
+		{"wrong direction", 0, 3, -1, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			it := vmvalue.NewRangeIterator(tt.start, tt.end, tt.step)
+			var actual []int64
+			for it.HasNext() {
+				actual = append(actual, vmvalue.ValueAsInt(it.Advance()))
+			}
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestListIterator(t *testing.T) {
+	t.Parallel()
+
+	items := vmvalue.ValueArray{vmvalue.IntAsValue(1), vmvalue.NilValue, vmvalue.TrueValue}
+	it := vmvalue.NewSourceIterator(vmvalue.ObjAsValue(vmvalue.NewList(items)))
+
+	var actual []vmvalue.Value
+	for it.HasNext() {
+		actual = append(actual, it.Advance())
+	}
+	assert.Equal(t, []vmvalue.Value(items), actual)
+	assert.False(t, it.HasNext())
+}
+
+func TestStringIterator(t *testing.T) {
+	vmvalue.InitInternStrings()
+	t.Cleanup(vmvalue.FreeInternStrings)
+
+	// the invalid UTF-8 byte is returned on its own
+	source := vmvalue.ObjAsValue(vmvalue.StringInternCopy([]byte("hé\xff€")))
+	it := vmvalue.NewSourceIterator(source)
+
+	var actual []string
+	for it.HasNext() {
+		actual = append(actual, string(vmvalue.ValueAsStringChars(it.Advance())))
+	}
+	assert.Equal(t, []string{"h", "é", "\xff", "€"}, actual)
+}
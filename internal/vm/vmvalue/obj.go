@@ -1,9 +1,11 @@
 package vmvalue
 
 import (
+	"bytes"
 	"fmt"
 	"hash/maphash"
 	"slices"
+	"unicode/utf8"
 	"unsafe"
 
 	"github.com/leonardinius/goloxvm/internal/vm/vmmem"
@@ -26,6 +28,17 @@ const (
 	ObjTypeClass
 	ObjTypeInstance
 	ObjTypeBoundMethod
+	ObjTypeList
+	ObjTypeMap
+	ObjTypeInt
+	ObjTypeBigInt
+	ObjTypeDecimal
+	ObjTypeIterator
+	ObjTypeFiber
+	ObjTypePromise
+	ObjTypeChannel
+	ObjTypeEnum
+	ObjTypeEnumMember
 )
 
 var gObjTypeStrings = map[ObjType]string{
@@ -37,6 +50,17 @@ var gObjTypeStrings = map[ObjType]string{
 	ObjTypeClass:       "OBJ_CLASS",
 	ObjTypeInstance:    "OBJ_INSTANCE",
 	ObjTypeBoundMethod: "OBJ_METHOD",
+	ObjTypeList:        "OBJ_LIST",
+	ObjTypeMap:         "OBJ_MAP",
+	ObjTypeInt:         "OBJ_INT",
+	ObjTypeBigInt:      "OBJ_BIGINT",
+	ObjTypeDecimal:     "OBJ_DECIMAL",
+	ObjTypeIterator:    "OBJ_ITERATOR",
+	ObjTypeFiber:       "OBJ_FIBER",
+	ObjTypePromise:     "OBJ_PROMISE",
+	ObjTypeChannel:     "OBJ_CHANNEL",
+	ObjTypeEnum:        "OBJ_ENUM",
+	ObjTypeEnumMember:  "OBJ_ENUM_MEMBER",
 }
 
 // String implements fmt.Stringer.
@@ -57,7 +81,18 @@ type VMObjectable interface {
 		ObjUpvalue |
 		ObjClass |
 		ObjInstance |
-		ObjBoundMethod
+		ObjBoundMethod |
+		ObjList |
+		ObjMap |
+		ObjInt |
+		ObjBigInt |
+		ObjDecimal |
+		ObjIterator |
+		ObjFiber |
+		ObjPromise |
+		ObjChannel |
+		ObjEnum |
+		ObjEnumMember
 }
 
 var (
@@ -70,6 +105,17 @@ var (
 	gObjClassSize       = int(unsafe.Sizeof(ObjClass{}))
 	gObjInstanceSize    = int(unsafe.Sizeof(ObjInstance{}))
 	gObjBoundMethodSize = int(unsafe.Sizeof(ObjBoundMethod{}))
+	gObjListSize        = int(unsafe.Sizeof(ObjList{}))
+	gObjMapSize         = int(unsafe.Sizeof(ObjMap{}))
+	gObjIntSize         = int(unsafe.Sizeof(ObjInt{}))
+	gObjBigIntSize      = int(unsafe.Sizeof(ObjBigInt{}))
+	gObjDecimalSize     = int(unsafe.Sizeof(ObjDecimal{}))
+	gObjIteratorSize    = int(unsafe.Sizeof(ObjIterator{}))
+	gObjFiberSize       = int(unsafe.Sizeof(ObjFiber{}))
+	gObjPromiseSize     = int(unsafe.Sizeof(ObjPromise{}))
+	gObjChannelSize     = int(unsafe.Sizeof(ObjChannel{}))
+	gObjEnumSize        = int(unsafe.Sizeof(ObjEnum{}))
+	gObjEnumMemberSize  = int(unsafe.Sizeof(ObjEnumMember{}))
 )
 
 type Obj struct {
@@ -101,14 +147,50 @@ func HashString(chars []byte) uint64 {
 	return maphash.Bytes(gSeed, chars)
 }
 
+// StringCharAt returns the UTF-8 character at the character index of the string,
+// strings are indexed, measured and iterated by characters.
+func StringCharAt(chars []byte, at int) []byte {
+	for ; at > 0; at-- {
+		_, width := utf8.DecodeRune(chars)
+		chars = chars[width:]
+	}
+	_, width := utf8.DecodeRune(chars)
+	return chars[:width]
+}
+
+// PrivateNameSeparator separates private member name from the declaring class id, `#name@1`.
+const PrivateNameSeparator = '@'
+
+// IsPrivateName reports whether the property name is private `#name` member.
+func IsPrivateName(name *ObjString) bool {
+	return len(name.Chars) > 0 && name.Chars[0] == '#'
+}
+
+// PropertyName returns the property name as written in the source, without the class id of private member.
+func PropertyName(name *ObjString) []byte {
+	if IsPrivateName(name) {
+		if i := bytes.IndexByte(name.Chars, PrivateNameSeparator); i >= 0 {
+			return name.Chars[:i]
+		}
+	}
+	return name.Chars
+}
+
 type ObjFunction struct {
 	Obj
-	Arity                int
+	Arity    int // number of declared parameters, not counting the rest parameter
+	MinArity int // number of parameters without default values
+	Variadic bool
+
 	Chunk                any
 	ChunkFreeFn          func()
 	ChunkMarkConstantsFn func()
 	UpvalueCount         int
 	Name                 *ObjString
+	// Generator is set for the function with `yield`, calling it creates the suspended fiber.
+	Generator bool
+	// Async is set for `async fun`, calling it runs the fiber until the first `await` and returns the promise.
+	Async bool
 }
 
 func NewFunction(chunk any, chunkFreeFn, chunkMarkFn func()) *ObjFunction {
@@ -117,8 +199,12 @@ func NewFunction(chunk any, chunkFreeFn, chunkMarkFn func()) *ObjFunction {
 	obj.ChunkFreeFn = chunkFreeFn
 	obj.ChunkMarkConstantsFn = chunkMarkFn
 	obj.Arity = 0
+	obj.MinArity = 0
+	obj.Variadic = false
 	obj.UpvalueCount = 0
 	obj.Name = nil
+	obj.Generator = false
+	obj.Async = false
 	return obj
 }
 
@@ -128,12 +214,18 @@ type ObjNative struct {
 	Obj
 	Fn    NativeFn
 	Arity byte
+	// MinArity is less than Arity for natives with optional arguments, missing ones are nil.
+	MinArity byte
+	// Variadic natives take any number of arguments after the Arity ones.
+	Variadic bool
 }
 
 func NewNativeFunction(fn NativeFn, arity byte) *ObjNative {
 	obj := allocateObject[ObjNative](ObjTypeNative, gObjNativeSize)
 	obj.Fn = fn
 	obj.Arity = arity
+	obj.MinArity = arity
+	obj.Variadic = false
 	return obj
 }
 
@@ -144,9 +236,11 @@ type ObjClosure struct {
 }
 
 func NewClosure(fn *ObjFunction) *ObjClosure {
+	// the upvalues are allocated first, the GC they trigger would sweep the unreachable closure
+	upvalues := vmmem.AllocateSlice[*ObjUpvalue](fn.UpvalueCount)
 	obj := allocateObject[ObjClosure](ObjTypeClosure, gObjClosureSize)
 	obj.Fn = fn
-	obj.Upvalues = vmmem.AllocateSlice[*ObjUpvalue](fn.UpvalueCount)
+	obj.Upvalues = upvalues
 	return obj
 }
 
@@ -167,23 +261,62 @@ func NewUpvalue(slot *Value) *ObjUpvalue {
 
 type ObjClass struct {
 	Obj
-	Name    *ObjString
-	Methods Table
+	Name          *ObjString
+	Superclass    *ObjClass
+	Methods       Table
+	Getters       Table
+	Setters       Table
+	StaticMethods Table
+	Fields        Table // class-level (static) fields
+	IsTrait       bool
+	Traits        ValueArray // mixed in traits, in declaration order
+	IsAbstract    bool
+	Abstract      Table // names of the abstract methods without implementation
 }
 
 func NewClass(name *ObjString) *ObjClass {
 	obj := allocateObject[ObjClass](ObjTypeClass, gObjClassSize)
 	obj.Name = name
 	obj.Methods = NewHashtable()
+	obj.Getters = NewHashtable()
+	obj.Setters = NewHashtable()
+	obj.StaticMethods = NewHashtable()
+	obj.Fields = NewHashtable()
+	obj.Traits = NewValueArray()
+	obj.Abstract = NewHashtable()
 	return obj
 }
 
+// HasTrait reports whether the trait is mixed into the class or into its traits.
+func (c *ObjClass) HasTrait(trait *ObjClass) bool {
+	for _, mixed := range c.Traits {
+		if mixed := ValueAsClass(mixed); mixed == trait || mixed.HasTrait(trait) {
+			return true
+		}
+	}
+	return false
+}
+
 type ObjInstance struct {
 	Obj
 	Klass  *ObjClass
 	Fields Table
 }
 
+// IsInstanceOf reports whether the value is an instance of the class or its subclass,
+// or an instance of the class with the trait.
+func IsInstanceOf(v Value, klass *ObjClass) bool {
+	if !IsInstance(v) {
+		return false
+	}
+	for k := ValueAsInstance(v).Klass; k != nil; k = k.Superclass {
+		if k == klass || klass.IsTrait && k.HasTrait(klass) {
+			return true
+		}
+	}
+	return false
+}
+
 func NewInstance(class *ObjClass) *ObjInstance {
 	obj := allocateObject[ObjInstance](ObjTypeInstance, gObjInstanceSize)
 	obj.Klass = class
@@ -204,6 +337,272 @@ func NewBoundMethod(receiver Value, method *ObjClosure) *ObjBoundMethod {
 	return obj
 }
 
+// ObjEnum is `enum Name { Member, ... }`, the members are its singletons in declaration order.
+type ObjEnum struct {
+	Obj
+	Name    *ObjString
+	Members ValueArray
+	ByName  Table
+}
+
+func NewEnum(name *ObjString) *ObjEnum {
+	obj := allocateObject[ObjEnum](ObjTypeEnum, gObjEnumSize)
+	obj.Name = name
+	obj.Members = NewValueArray()
+	obj.ByName = NewHashtable()
+	return obj
+}
+
+type ObjEnumMember struct {
+	Obj
+	Enum    *ObjEnum
+	Name    *ObjString
+	Ordinal int
+}
+
+func NewEnumMember(enum *ObjEnum, name *ObjString, ordinal int) *ObjEnumMember {
+	obj := allocateObject[ObjEnumMember](ObjTypeEnumMember, gObjEnumMemberSize)
+	obj.Enum = enum
+	obj.Name = name
+	obj.Ordinal = ordinal
+	return obj
+}
+
+type ObjList struct {
+	Obj
+	Items ValueArray
+}
+
+func NewList(items ValueArray) *ObjList {
+	obj := allocateObject[ObjList](ObjTypeList, gObjListSize)
+	obj.Items = items
+	return obj
+}
+
+type ObjMap struct {
+	Obj
+	Table ValueTable
+}
+
+func NewMap() *ObjMap {
+	obj := allocateObject[ObjMap](ObjTypeMap, gObjMapSize)
+	obj.Table = NewValueTable()
+	return obj
+}
+
+// ObjInt is boxed integer, which does not fit into NaN tagged small integer.
+type ObjInt struct {
+	Obj
+	Value int64
+}
+
+func NewInt(value int64) *ObjInt {
+	obj := allocateObject[ObjInt](ObjTypeInt, gObjIntSize)
+	obj.Value = value
+	return obj
+}
+
+// ObjIterator iterates over list items, string characters or integer range.
+// Maps are iterated over the snapshot list of their keys.
+type ObjIterator struct {
+	Obj
+	Source Value // list, string or enum, nil for ranges
+	Index  int
+
+	// range bounds, the end is exclusive
+	Next, End, Step int64
+}
+
+func NewSourceIterator(source Value) *ObjIterator {
+	obj := allocateObject[ObjIterator](ObjTypeIterator, gObjIteratorSize)
+	obj.Source = source
+	return obj
+}
+
+func NewRangeIterator(start, end, step int64) *ObjIterator {
+	obj := allocateObject[ObjIterator](ObjTypeIterator, gObjIteratorSize)
+	obj.Source = NilValue
+	obj.Next = start
+	obj.End = end
+	obj.Step = step
+	return obj
+}
+
+// HasNext reports whether the iterator has more items.
+func (it *ObjIterator) HasNext() bool {
+	switch {
+	case IsList(it.Source):
+		return it.Index < len(ValueAsList(it.Source).Items)
+	case IsEnum(it.Source):
+		return it.Index < len(ValueAsEnum(it.Source).Members)
+	case IsString(it.Source):
+		return it.Index < len(ValueAsStringChars(it.Source))
+	case it.Step > 0:
+		return it.Next < it.End
+	default:
+		return it.Next > it.End
+	}
+}
+
+// Advance returns the next item, the caller checks HasNext first.
+func (it *ObjIterator) Advance() Value {
+	switch {
+	case IsList(it.Source):
+		it.Index++
+		return ValueAsList(it.Source).Items[it.Index-1]
+	case IsEnum(it.Source):
+		it.Index++
+		return ValueAsEnum(it.Source).Members[it.Index-1]
+	case IsString(it.Source):
+		// the characters are UTF-8 encoded runes, the invalid bytes are returned one by one
+		chars := ValueAsStringChars(it.Source)
+		_, width := utf8.DecodeRune(chars[it.Index:])
+		it.Index += width
+		return ObjAsValue(StringInternCopy(chars[it.Index-width : it.Index]))
+	default:
+		value := IntAsValue(it.Next)
+		it.Next += it.Step
+		return value
+	}
+}
+
+type FiberState byte
+
+const (
+	FiberNew FiberState = iota
+	FiberSuspended
+	FiberRunning
+	FiberDone
+)
+
+// ResumeMode tells what the resumer receives when the fiber yields or returns.
+type ResumeMode byte
+
+const (
+	ResumeValue   ResumeMode = iota // the yielded or returned value
+	ResumeHasNext                   // true if the fiber has yielded, the value is kept as Peeked
+	ResumeNext                      // the yielded value, error if the fiber has returned
+)
+
+// ObjFiber is the coroutine with its own call frame and stack slots. The fiber yields only
+// from its bottom frame, so the suspended fiber keeps that single frame and its stack slots.
+// FiberFrame is the call frame of the suspended fiber, its SlotsTop is relative to the fiber stack.
+type FiberFrame struct {
+	Closure        *ObjClosure
+	IP             int
+	SlotsTop       int
+	ArgCount       int
+	InvokeResult   bool
+	InvokeArgCount byte
+	DiscardResult  bool
+}
+
+type ObjFiber struct {
+	Obj
+	State   FiberState
+	Mode    ResumeMode
+	Closure *ObjClosure
+	// AwaitingValue is set if the fiber is suspended at `yield`, which evaluates to the resumed value.
+	AwaitingValue bool
+
+	// suspended call frames from the bottom one, their stack slots and the open upvalues pointing to them,
+	// the upvalues use their Closed value while the fiber is suspended
+	Frames       []FiberFrame
+	Stack        ValueArray
+	Upvalues     []*ObjUpvalue
+	UpvalueSlots []int
+
+	// the value of the last `yield` seen by `hasNext()` and not taken by `next()` yet
+	Peeked    Value
+	HasPeeked bool
+
+	// the fiber which has resumed this one
+	Parent *ObjFiber
+
+	// the promise of the async function call, settled once the fiber returns
+	Promise *ObjPromise
+}
+
+func NewFiber(closure *ObjClosure) *ObjFiber {
+	obj := allocateObject[ObjFiber](ObjTypeFiber, gObjFiberSize)
+	obj.State = FiberNew
+	obj.Closure = closure
+	obj.Peeked = NilValue
+	return obj
+}
+
+type PromiseState byte
+
+const (
+	PromisePending PromiseState = iota
+	PromiseFulfilled
+	PromiseRejected
+)
+
+// PromiseReaction is run by the event loop once the promise settles. It either resumes the fiber
+// awaiting the promise or calls the handler and resolves the Result promise with what it returns.
+type PromiseReaction struct {
+	OnFulfilled Value
+	OnRejected  Value
+	Result      *ObjPromise
+	Fiber       *ObjFiber
+
+	// Promise.all stores the value at Index of the Values list of the Result promise
+	Values *ObjList
+	Index  int
+}
+
+// ObjPromise is the eventual result of the asynchronous operation.
+type ObjPromise struct {
+	Obj
+	State     PromiseState
+	Value     Value
+	Reactions []PromiseReaction
+	// Waiting is the number of promises Promise.all still waits for
+	Waiting int
+	// Handled is set once a reaction is added, the rejections of unhandled promises are reported
+	Handled bool
+}
+
+func NewPromise() *ObjPromise {
+	obj := allocateObject[ObjPromise](ObjTypePromise, gObjPromiseSize)
+	obj.State = PromisePending
+	obj.Value = NilValue
+	return obj
+}
+
+// AddReaction registers the reaction of the pending promise, its values must be reachable by the GC.
+func (p *ObjPromise) AddReaction(reaction PromiseReaction) {
+	length := len(p.Reactions)
+	if cap(p.Reactions) < length+1 {
+		capacity := vmmem.GrowCapacity(cap(p.Reactions))
+		p.Reactions = vmmem.GrowSlice(p.Reactions, capacity)[:length]
+	}
+	p.Reactions = append(p.Reactions, reaction)
+}
+
+// ObjChannel refers to the channel shared by the isolated VMs, the channel itself lives outside
+// of the heap and carries copies of the values.
+type ObjChannel struct {
+	Obj
+	ID int64
+}
+
+func NewChannel(id int64) *ObjChannel {
+	obj := allocateObject[ObjChannel](ObjTypeChannel, gObjChannelSize)
+	obj.ID = id
+	return obj
+}
+
+// Mark marks the values of the reaction, the event loop marks the reactions it has queued.
+func (r *PromiseReaction) Mark() {
+	MarkValue(r.OnFulfilled)
+	MarkValue(r.OnRejected)
+	MarkObject(r.Result)
+	MarkObject(r.Fiber)
+	MarkObject(r.Values)
+}
+
 func InitObjects() {
 	GRoots = nil
 	gcTrace = gcTraceStack{}
@@ -246,6 +645,12 @@ func FreeObject(obj *Obj) {
 		debugPrintFreeObject(obj, gObjClassSize)
 		v := castObject[ObjClass](obj)
 		v.Methods.Free()
+		v.Getters.Free()
+		v.Setters.Free()
+		v.StaticMethods.Free()
+		v.Fields.Free()
+		v.Traits.Free()
+		v.Abstract.Free()
 		vmmem.TriggerGC(gObjClassSize, 1, 0)
 	case ObjTypeInstance:
 		debugPrintFreeObject(obj, gObjInstanceSize)
@@ -255,6 +660,55 @@ func FreeObject(obj *Obj) {
 	case ObjTypeBoundMethod:
 		debugPrintFreeObject(obj, gObjBoundMethodSize)
 		vmmem.TriggerGC(gObjBoundMethodSize, 1, 0)
+	case ObjTypeList:
+		debugPrintFreeObject(obj, gObjListSize)
+		v := castObject[ObjList](obj)
+		v.Items.Free()
+		vmmem.TriggerGC(gObjListSize, 1, 0)
+	case ObjTypeMap:
+		debugPrintFreeObject(obj, gObjMapSize)
+		v := castObject[ObjMap](obj)
+		v.Table.Free()
+		vmmem.TriggerGC(gObjMapSize, 1, 0)
+	case ObjTypeInt:
+		debugPrintFreeObject(obj, gObjIntSize)
+		vmmem.TriggerGC(gObjIntSize, 1, 0)
+	case ObjTypeBigInt:
+		debugPrintFreeObject(obj, gObjBigIntSize)
+		castObject[ObjBigInt](obj).Value = nil
+		vmmem.TriggerGC(gObjBigIntSize, 1, 0)
+	case ObjTypeDecimal:
+		debugPrintFreeObject(obj, gObjDecimalSize)
+		castObject[ObjDecimal](obj).Unscaled = nil
+		vmmem.TriggerGC(gObjDecimalSize, 1, 0)
+	case ObjTypeIterator:
+		debugPrintFreeObject(obj, gObjIteratorSize)
+		vmmem.TriggerGC(gObjIteratorSize, 1, 0)
+	case ObjTypeFiber:
+		debugPrintFreeObject(obj, gObjFiberSize)
+		v := castObject[ObjFiber](obj)
+		v.Frames = vmmem.FreeSlice(v.Frames)
+		v.Stack.Free()
+		v.Upvalues = vmmem.FreeSlice(v.Upvalues)
+		v.UpvalueSlots = vmmem.FreeSlice(v.UpvalueSlots)
+		vmmem.TriggerGC(gObjFiberSize, 1, 0)
+	case ObjTypePromise:
+		debugPrintFreeObject(obj, gObjPromiseSize)
+		v := castObject[ObjPromise](obj)
+		v.Reactions = vmmem.FreeSlice(v.Reactions)
+		vmmem.TriggerGC(gObjPromiseSize, 1, 0)
+	case ObjTypeChannel:
+		debugPrintFreeObject(obj, gObjChannelSize)
+		vmmem.TriggerGC(gObjChannelSize, 1, 0)
+	case ObjTypeEnum:
+		debugPrintFreeObject(obj, gObjEnumSize)
+		v := castObject[ObjEnum](obj)
+		v.Members.Free()
+		v.ByName.Free()
+		vmmem.TriggerGC(gObjEnumSize, 1, 0)
+	case ObjTypeEnumMember:
+		debugPrintFreeObject(obj, gObjEnumMemberSize)
+		vmmem.TriggerGC(gObjEnumMemberSize, 1, 0)
 	default:
 		panic(fmt.Sprintf("unable to free object of type %d", obj.Type))
 	}
@@ -273,21 +727,48 @@ func PrintObject(obj *Obj) {
 		v := castObject[ObjFunction](obj)
 		printFunction(v)
 	case ObjTypeNative:
-		fmt.Print("<native fn>")
+		fmt.Fprint(gPrintOutput, "<native fn>")
 	case ObjTypeClosure:
 		v := castObject[ObjClosure](obj)
 		printFunction(v.Fn)
 	case ObjTypeUpvalue:
-		fmt.Print("upvalue")
+		fmt.Fprint(gPrintOutput, "upvalue")
 	case ObjTypeClass:
 		v := castObject[ObjClass](obj)
 		printString(v.Name)
 	case ObjTypeInstance:
 		v := castObject[ObjInstance](obj)
+		if str, found := userToString(v); found {
+			printString(str)
+			return
+		}
 		printfString("%s instance", v.Klass.Name)
 	case ObjTypeBoundMethod:
 		v := castObject[ObjBoundMethod](obj)
 		printFunction(v.Method.Fn)
+	case ObjTypeList:
+		printList(castObject[ObjList](obj))
+	case ObjTypeMap:
+		printMap(castObject[ObjMap](obj))
+	case ObjTypeInt:
+		fmt.Fprint(gPrintOutput, castObject[ObjInt](obj).Value)
+	case ObjTypeBigInt:
+		fmt.Fprint(gPrintOutput, castObject[ObjBigInt](obj).Value.String())
+	case ObjTypeDecimal:
+		fmt.Fprint(gPrintOutput, DecimalString(castObject[ObjDecimal](obj)))
+	case ObjTypeIterator:
+		fmt.Fprint(gPrintOutput, "<iterator>")
+	case ObjTypeFiber:
+		fmt.Fprint(gPrintOutput, "<fiber>")
+	case ObjTypePromise:
+		fmt.Fprint(gPrintOutput, "<promise>")
+	case ObjTypeChannel:
+		fmt.Fprint(gPrintOutput, "<channel>")
+	case ObjTypeEnum:
+		printString(castObject[ObjEnum](obj).Name)
+	case ObjTypeEnumMember:
+		v := castObject[ObjEnumMember](obj)
+		fmt.Fprintf(gPrintOutput, "%s.%s", v.Enum.Name.Chars, v.Name.Chars)
 	default:
 		panic(fmt.Sprintf("unable to print object of type %d", obj.Type))
 	}
@@ -295,7 +776,7 @@ func PrintObject(obj *Obj) {
 
 func printFunction(f *ObjFunction) {
 	if f.Name == nil {
-		fmt.Print("<script>")
+		fmt.Fprint(gPrintOutput, "<script>")
 		return
 	}
 
@@ -303,11 +784,11 @@ func printFunction(f *ObjFunction) {
 }
 
 func printfString(message string, s *ObjString) {
-	fmt.Printf(message, string(s.Chars))
+	fmt.Fprintf(gPrintOutput, message, string(s.Chars))
 }
 
 func printString(s *ObjString) {
-	fmt.Print(string(s.Chars))
+	fmt.Fprint(gPrintOutput, string(s.Chars))
 }
 
 //go:nosplit
@@ -372,7 +853,7 @@ func blackenObject(obj *Obj) {
 	debugPrintBlackenObject(obj)
 
 	switch obj.Type {
-	case ObjTypeString, ObjTypeNative:
+	case ObjTypeString, ObjTypeNative, ObjTypeInt, ObjTypeBigInt, ObjTypeDecimal, ObjTypeChannel:
 		// do nothing.
 		// strings are interned and handled there.
 		// native functions do not need to be GCed, other than name in globals.
@@ -392,7 +873,14 @@ func blackenObject(obj *Obj) {
 	case ObjTypeClass:
 		v := castObject[ObjClass](obj)
 		MarkObject(v.Name)
+		MarkObject(v.Superclass)
 		v.Methods.Mark()
+		v.Getters.Mark()
+		v.Setters.Mark()
+		v.StaticMethods.Mark()
+		v.Fields.Mark()
+		v.Traits.Mark()
+		v.Abstract.Mark()
 	case ObjTypeInstance:
 		v := castObject[ObjInstance](obj)
 		MarkObject(v.Klass)
@@ -401,6 +889,43 @@ func blackenObject(obj *Obj) {
 		v := castObject[ObjBoundMethod](obj)
 		MarkValue(v.Receiver)
 		MarkObject(v.Method)
+	case ObjTypeList:
+		v := castObject[ObjList](obj)
+		v.Items.Mark()
+	case ObjTypeMap:
+		v := castObject[ObjMap](obj)
+		v.Table.Mark()
+	case ObjTypeIterator:
+		v := castObject[ObjIterator](obj)
+		MarkValue(v.Source)
+	case ObjTypeFiber:
+		v := castObject[ObjFiber](obj)
+		MarkObject(v.Closure)
+		for i := range v.Frames {
+			MarkObject(v.Frames[i].Closure)
+		}
+		v.Stack.Mark()
+		for _, upvalue := range v.Upvalues {
+			MarkObject(upvalue)
+		}
+		MarkValue(v.Peeked)
+		MarkObject(v.Parent)
+		MarkObject(v.Promise)
+	case ObjTypeEnum:
+		v := castObject[ObjEnum](obj)
+		MarkObject(v.Name)
+		v.Members.Mark()
+		v.ByName.Mark()
+	case ObjTypeEnumMember:
+		v := castObject[ObjEnumMember](obj)
+		MarkObject(v.Enum)
+		MarkObject(v.Name)
+	case ObjTypePromise:
+		v := castObject[ObjPromise](obj)
+		MarkValue(v.Value)
+		for i := range v.Reactions {
+			v.Reactions[i].Mark()
+		}
 	default:
 		panic(fmt.Sprintf("unable to print object of type %d", obj.Type))
 	}
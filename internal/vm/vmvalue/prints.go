@@ -2,20 +2,34 @@ package vmvalue
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+var (
+	// gPrintingContainers guards against infinite recursion
+	// when printing self referencing lists and maps.
+	gPrintingContainers []*Obj
+	// gPrintOutput is where values are printed, SprintValue swaps it.
+	gPrintOutput io.Writer = os.Stdout
 )
 
 func PrintValue(v Value) {
 	switch {
-	case IsNumber(v):
+	case IsFloat(v):
 		fv := ValueAsNumber(v)
-		fmt.Printf("%v", fv)
+		fmt.Fprintf(gPrintOutput, "%v", fv)
+	case IsSmallInt(v):
+		fmt.Fprint(gPrintOutput, ValueAsInt(v))
 	case IsNil(v):
-		fmt.Print("nil")
+		fmt.Fprint(gPrintOutput, "nil")
 	case IsBool(v):
 		if ValueAsBool(v) {
-			fmt.Print("true")
+			fmt.Fprint(gPrintOutput, "true")
 		} else {
-			fmt.Print("false")
+			fmt.Fprint(gPrintOutput, "false")
 		}
 	case IsObj(v):
 		PrintObject(ValueAsObj(v))
@@ -24,7 +38,73 @@ func PrintValue(v Value) {
 	}
 }
 
+// SprintValue formats the value the same way PrintValue does.
+// User `toString()` methods run meanwhile still print to the standard output.
+func SprintValue(v Value) string {
+	var sb strings.Builder
+	out := gPrintOutput
+	gPrintOutput = &sb
+	defer func() { gPrintOutput = out }()
+
+	PrintValue(v)
+	return sb.String()
+}
+
 func PrintlnValue(v Value) {
 	PrintValue(v)
-	fmt.Println()
+	fmt.Fprintln(gPrintOutput)
+}
+
+func printList(list *ObjList) {
+	if !enterPrintContainer(&list.Obj) {
+		fmt.Fprint(gPrintOutput, "[...]")
+		return
+	}
+	defer leavePrintContainer()
+
+	fmt.Fprint(gPrintOutput, "[")
+	for i, item := range list.Items {
+		if i > 0 {
+			fmt.Fprint(gPrintOutput, ", ")
+		}
+		PrintValue(item)
+	}
+	fmt.Fprint(gPrintOutput, "]")
+}
+
+func printMap(m *ObjMap) {
+	if m.Table.Len() == 0 {
+		fmt.Fprint(gPrintOutput, "[:]")
+		return
+	}
+	if !enterPrintContainer(&m.Obj) {
+		fmt.Fprint(gPrintOutput, "[...]")
+		return
+	}
+	defer leavePrintContainer()
+
+	fmt.Fprint(gPrintOutput, "[")
+	first := true
+	m.Table.Each(func(key, value Value) {
+		if !first {
+			fmt.Fprint(gPrintOutput, ", ")
+		}
+		first = false
+		PrintValue(key)
+		fmt.Fprint(gPrintOutput, ": ")
+		PrintValue(value)
+	})
+	fmt.Fprint(gPrintOutput, "]")
+}
+
+func enterPrintContainer(obj *Obj) bool {
+	if slices.Contains(gPrintingContainers, obj) {
+		return false
+	}
+	gPrintingContainers = append(gPrintingContainers, obj)
+	return true
+}
+
+func leavePrintContainer() {
+	gPrintingContainers = gPrintingContainers[:len(gPrintingContainers)-1]
 }
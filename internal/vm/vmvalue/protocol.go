@@ -0,0 +1,49 @@
+package vmvalue
+
+// Protocol calls user defined `toString()`, `equals(other)` and `hash()` methods of instances.
+// It is installed by the VM, the methods are run to completion before returning.
+// found is false if the class does not define the method or the call has failed,
+// the caller falls back to the default behaviour then.
+type Protocol interface {
+	ToString(instance *ObjInstance) (str *ObjString, found bool)
+	Equals(instance *ObjInstance, other Value) (equal, found bool)
+	Hash(instance *ObjInstance) (hash uint64, found bool)
+}
+
+var gProtocol Protocol
+
+func SetProtocol(protocol Protocol) {
+	gProtocol = protocol
+}
+
+func userToString(instance *ObjInstance) (*ObjString, bool) {
+	if gProtocol == nil {
+		return nil, false
+	}
+	return gProtocol.ToString(instance)
+}
+
+// isUserEqual compares the values with `equals(other)` method of either instance.
+func isUserEqual(v1, v2 Value) bool {
+	if gProtocol == nil {
+		return false
+	}
+	if IsInstance(v1) {
+		if equal, found := gProtocol.Equals(ValueAsInstance(v1), v2); found {
+			return equal
+		}
+	}
+	if IsInstance(v2) {
+		if equal, found := gProtocol.Equals(ValueAsInstance(v2), v1); found {
+			return equal
+		}
+	}
+	return false
+}
+
+func userHash(instance *ObjInstance) (uint64, bool) {
+	if gProtocol == nil {
+		return 0, false
+	}
+	return gProtocol.Hash(instance)
+}
@@ -17,3 +17,25 @@ func TestStringHash(t *testing.T) {
 
 	assert.Equal(t, hash1, hash2)
 }
+
+func TestPropertyName(t *testing.T) {
+	vmvalue.InitInternStrings()
+	t.Cleanup(vmvalue.FreeInternStrings)
+
+	public := vmvalue.StringInternCopy([]byte("name"))
+	private := vmvalue.StringInternCopy([]byte("#name@12"))
+
+	assert.False(t, vmvalue.IsPrivateName(public))
+	assert.True(t, vmvalue.IsPrivateName(private))
+	assert.Equal(t, "name", string(vmvalue.PropertyName(public)))
+	assert.Equal(t, "#name", string(vmvalue.PropertyName(private)))
+}
+
+func TestStringCharAt(t *testing.T) {
+	chars := []byte("aé→b")
+
+	assert.Equal(t, "a", string(vmvalue.StringCharAt(chars, 0)))
+	assert.Equal(t, "é", string(vmvalue.StringCharAt(chars, 1)))
+	assert.Equal(t, "→", string(vmvalue.StringCharAt(chars, 2)))
+	assert.Equal(t, "b", string(vmvalue.StringCharAt(chars, 3)))
+}
@@ -117,6 +117,16 @@ func (h *Table) PutAll(from *Table) {
 	}
 }
 
+// Each calls fn for every key in the table, order is not defined.
+func (h *Table) Each(fn func(key *ObjString, value Value)) {
+	for i := range h.entries {
+		el := &h.entries[i]
+		if el.key != nil {
+			fn(el.key, el.value)
+		}
+	}
+}
+
 func (h *Table) Get(key *ObjString) (Value, bool) {
 	if h.count == 0 {
 		return NilValue, false
@@ -33,6 +33,13 @@ const (
 	TagNil   uint64 = 1 // 01
 	TagFalse uint64 = 2 // 10
 	TagTrue  uint64 = 3 // 11
+	// TagInt marks small integers, stored as 48 bits two's complement payload.
+	TagInt uint64 = 1 << 49
+	//
+	smallIntBits        = 48
+	smallIntMask uint64 = 1<<smallIntBits - 1
+	MinSmallInt  int64  = -1 << (smallIntBits - 1)
+	MaxSmallInt  int64  = 1<<(smallIntBits-1) - 1
 	//
 	NilValue   Value = Value(QNAN | TagNil)
 	TrueValue  Value = Value(QNAN | TagTrue)
@@ -55,33 +62,86 @@ func IsNil(v Value) bool {
 	return (v) == NilValue
 }
 
+// IsNumber reports whether the value is either float or integer number.
 func IsNumber(v Value) bool {
+	return IsFloat(v) || IsInt(v)
+}
+
+func IsFloat(v Value) bool {
 	return (uint64(v) & QNAN) != QNAN
 }
 
+// IsInt reports whether the value is an integer, either NaN tagged or boxed.
+func IsInt(v Value) bool {
+	return IsSmallInt(v) || isObjType(v, ObjTypeInt)
+}
+
+func IsSmallInt(v Value) bool {
+	return (uint64(v) & (SignBit | QNAN | TagInt)) == (QNAN | TagInt)
+}
+
 func IsObj(v Value) bool {
 	return (uint64(v) & (QNAN | SignBit)) == (QNAN | SignBit)
 }
 
 func IsValuesEqual(v1, v2 Value) bool {
+	if IsFloat(v1) && IsFloat(v2) {
+		// NaN != NaN
+		return ValueAsNumber(v1) == ValueAsNumber(v2)
+	}
+	if v1 == v2 {
+		return true
+	}
+	if IsSmallInt(v1) && IsSmallInt(v2) {
+		return false
+	}
 	if IsNumber(v1) && IsNumber(v2) {
+		if IsInt(v1) && IsInt(v2) {
+			return ValueAsInt(v1) == ValueAsInt(v2)
+		}
 		return ValueAsNumber(v1) == ValueAsNumber(v2)
 	}
-	return v1 == v2
+	if IsBigNumber(v1) || IsBigNumber(v2) {
+		return isBigEqual(v1, v2)
+	}
+	if IsInstance(v1) || IsInstance(v2) {
+		return isUserEqual(v1, v2)
+	}
+	return false
 }
 
 func ValueAsBool(v Value) bool {
 	return v == TrueValue
 }
 
+// ValueAsNumber returns the number as float, integers are converted.
 func ValueAsNumber(v Value) float64 {
-	return math.Float64frombits(uint64(v))
+	if IsFloat(v) {
+		return math.Float64frombits(uint64(v))
+	}
+	return float64(ValueAsInt(v))
 }
 
 func NumberAsValue(num float64) Value {
 	return Value(math.Float64bits(num))
 }
 
+func ValueAsInt(v Value) int64 {
+	if IsSmallInt(v) {
+		// sign extend the payload
+		return int64(uint64(v)<<(64-smallIntBits)) >> (64 - smallIntBits) //nolint:gosec // two's complement
+	}
+	return valueAsObj[ObjInt](v).Value
+}
+
+// IntAsValue returns NaN tagged small integer, or allocates boxed integer for large ones.
+func IntAsValue(num int64) Value {
+	if MinSmallInt <= num && num <= MaxSmallInt {
+		return Value(QNAN | TagInt | (uint64(num) & smallIntMask)) //nolint:gosec // two's complement
+	}
+	return ObjAsValue(NewInt(num))
+}
+
 func BoolAsValue(b bool) Value {
 	if b {
 		return TrueValue
@@ -160,6 +220,38 @@ func IsBoundMethod(v Value) bool {
 	return isObjType(v, ObjTypeBoundMethod)
 }
 
+func IsList(v Value) bool {
+	return isObjType(v, ObjTypeList)
+}
+
+func IsMap(v Value) bool {
+	return isObjType(v, ObjTypeMap)
+}
+
+func IsIterator(v Value) bool {
+	return isObjType(v, ObjTypeIterator)
+}
+
+func IsFiber(v Value) bool {
+	return isObjType(v, ObjTypeFiber)
+}
+
+func IsPromise(v Value) bool {
+	return isObjType(v, ObjTypePromise)
+}
+
+func IsChannel(v Value) bool {
+	return isObjType(v, ObjTypeChannel)
+}
+
+func IsEnum(v Value) bool {
+	return isObjType(v, ObjTypeEnum)
+}
+
+func IsEnumMember(v Value) bool {
+	return isObjType(v, ObjTypeEnumMember)
+}
+
 func ValueAsString(v Value) *ObjString {
 	return valueAsObj[ObjString](v)
 }
@@ -191,3 +283,83 @@ func ValueAsInstance(v Value) *ObjInstance {
 func ValueAsBoundMethod(v Value) *ObjBoundMethod {
 	return valueAsObj[ObjBoundMethod](v)
 }
+
+func ValueAsList(v Value) *ObjList {
+	return valueAsObj[ObjList](v)
+}
+
+func ValueAsMap(v Value) *ObjMap {
+	return valueAsObj[ObjMap](v)
+}
+
+func ValueAsIterator(v Value) *ObjIterator {
+	return valueAsObj[ObjIterator](v)
+}
+
+func ValueAsFiber(v Value) *ObjFiber {
+	return valueAsObj[ObjFiber](v)
+}
+
+func ValueAsPromise(v Value) *ObjPromise {
+	return valueAsObj[ObjPromise](v)
+}
+
+func ValueAsChannel(v Value) *ObjChannel {
+	return valueAsObj[ObjChannel](v)
+}
+
+func ValueAsEnum(v Value) *ObjEnum {
+	return valueAsObj[ObjEnum](v)
+}
+
+func ValueAsEnumMember(v Value) *ObjEnumMember {
+	return valueAsObj[ObjEnumMember](v)
+}
+
+// TypeName returns user facing name of the value type.
+func TypeName(v Value) string {
+	switch {
+	case IsNumber(v):
+		return "number"
+	case IsNil(v):
+		return "nil"
+	case IsBool(v):
+		return "bool"
+	}
+
+	switch ObjTypeTag(v) {
+	case ObjTypeString:
+		return "string"
+	case ObjTypeFunction, ObjTypeClosure, ObjTypeBoundMethod, ObjTypeNative:
+		return "function"
+	case ObjTypeClass:
+		if ValueAsClass(v).IsTrait {
+			return "trait"
+		}
+		return "class"
+	case ObjTypeInstance:
+		return "instance"
+	case ObjTypeList:
+		return "list"
+	case ObjTypeMap:
+		return "map"
+	case ObjTypeBigInt:
+		return "bigint"
+	case ObjTypeDecimal:
+		return "decimal"
+	case ObjTypeIterator:
+		return "iterator"
+	case ObjTypeFiber:
+		return "fiber"
+	case ObjTypePromise:
+		return "promise"
+	case ObjTypeChannel:
+		return "channel"
+	case ObjTypeEnum:
+		return "enum"
+	case ObjTypeEnumMember:
+		return "enum member"
+	default:
+		return "object"
+	}
+}
@@ -0,0 +1,221 @@
+package vmvalue
+
+import (
+	"math"
+
+	"github.com/leonardinius/goloxvm/internal/vm/vmmem"
+)
+
+const (
+	valueSlotEmpty     int32 = -1
+	valueSlotTombstone int32 = -2
+)
+
+// ValueTable is a hash table keyed by arbitrary values.
+// Unlike Table it keeps the insertion order of the keys,
+// so iteration (and printing) is deterministic.
+type ValueTable struct {
+	entries []valueEntry
+	slots   []int32
+	count   int
+}
+
+type valueEntry struct {
+	key     Value
+	value   Value
+	hash    uint64
+	deleted bool
+}
+
+func NewValueTable() ValueTable {
+	h := ValueTable{}
+	h.reset()
+	return h
+}
+
+func (h *ValueTable) reset() {
+	h.entries = nil
+	h.slots = nil
+	h.count = 0
+}
+
+func (h *ValueTable) Free() {
+	h.entries = vmmem.FreeSlice(h.entries)
+	h.slots = vmmem.FreeSlice(h.slots)
+	h.reset()
+}
+
+// Len returns the number of live keys.
+func (h *ValueTable) Len() int {
+	return h.count
+}
+
+func (h *ValueTable) Set(key, value Value) bool {
+	if len(h.entries)+1 > int(float64(len(h.slots))*TableMaxLoad) {
+		h.adjustCapacity(vmmem.GrowCapacity(len(h.slots)))
+	}
+
+	hash := HashValue(key)
+	slot := h.findSlot(key, hash)
+	if at := h.slots[slot]; at >= 0 {
+		h.entries[at].value = value
+		return false
+	}
+
+	if len(h.entries) == cap(h.entries) {
+		h.entries = vmmem.GrowSlice(h.entries, vmmem.GrowCapacity(cap(h.entries)))[:len(h.entries)]
+	}
+	h.entries = append(h.entries, valueEntry{key: key, value: value, hash: hash})
+	h.slots[slot] = int32(len(h.entries) - 1) //nolint:gosec // bounded by slots capacity
+	h.count++
+	return true
+}
+
+func (h *ValueTable) Get(key Value) (Value, bool) {
+	if h.count == 0 {
+		return NilValue, false
+	}
+
+	if at := h.slots[h.findSlot(key, HashValue(key))]; at >= 0 {
+		return h.entries[at].value, true
+	}
+
+	return NilValue, false
+}
+
+func (h *ValueTable) Delete(key Value) bool {
+	if h.count == 0 {
+		return false
+	}
+
+	slot := h.findSlot(key, HashValue(key))
+	at := h.slots[slot]
+	if at < 0 {
+		return false
+	}
+
+	h.slots[slot] = valueSlotTombstone
+	h.entries[at] = valueEntry{key: NilValue, value: NilValue, deleted: true}
+	h.count--
+	return true
+}
+
+// Each calls fn for every live entry in insertion order.
+func (h *ValueTable) Each(fn func(key, value Value)) {
+	for i := range h.entries {
+		if el := &h.entries[i]; !el.deleted {
+			fn(el.key, el.value)
+		}
+	}
+}
+
+// EntryAt returns the live entry at or after the position pos together with the position
+// of the next entry. It allows walking the table while it is being modified.
+func (h *ValueTable) EntryAt(pos int) (key, value Value, next int, ok bool) {
+	for ; pos < len(h.entries); pos++ {
+		if el := &h.entries[pos]; !el.deleted {
+			return el.key, el.value, pos + 1, true
+		}
+	}
+	return NilValue, NilValue, pos, false
+}
+
+func (h *ValueTable) Mark() {
+	for i := range h.entries {
+		el := &h.entries[i]
+		MarkValue(el.key)
+		MarkValue(el.value)
+	}
+}
+
+// findSlot returns the slot holding the key, or the slot where it should be inserted.
+func (h *ValueTable) findSlot(key Value, hash uint64) int {
+	capacity := uint64(len(h.slots))
+	debugAssertIsPowerOfTwo(capacity)
+	mask := capacity - 1
+	index := hash & mask
+	tombstone := -1
+
+	for {
+		switch at := h.slots[index]; at {
+		case valueSlotEmpty:
+			if tombstone != -1 {
+				return tombstone
+			}
+			return int(index)
+		case valueSlotTombstone:
+			if tombstone == -1 {
+				tombstone = int(index)
+			}
+		default:
+			el := &h.entries[at]
+			if el.hash == hash && IsValuesEqual(el.key, key) {
+				return int(index)
+			}
+		}
+		index = (index + 1) & mask
+	}
+}
+
+func (h *ValueTable) adjustCapacity(capacity int) {
+	// compact deleted entries first
+	live := 0
+	for i := range h.entries {
+		if !h.entries[i].deleted {
+			h.entries[live] = h.entries[i]
+			live++
+		}
+	}
+	h.entries = h.entries[:live]
+
+	h.slots = vmmem.FreeSlice(h.slots)
+	h.slots = vmmem.AllocateSlice[int32](capacity)
+	for i := range h.slots {
+		h.slots[i] = valueSlotEmpty
+	}
+
+	mask := uint64(capacity - 1)
+	for i := range h.entries {
+		index := h.entries[i].hash & mask
+		for h.slots[index] != valueSlotEmpty {
+			index = (index + 1) & mask
+		}
+		h.slots[index] = int32(i) //nolint:gosec // bounded by slots capacity
+	}
+}
+
+// HashValue hashes the value in a way consistent with IsValuesEqual.
+func HashValue(v Value) uint64 {
+	switch {
+	case IsString(v):
+		return ValueAsString(v).Hash
+	case IsInt(v):
+		return mixHash(uint64(ValueAsInt(v))) //nolint:gosec // two's complement
+	case IsNumber(v):
+		num := ValueAsNumber(v)
+		if num == math.Trunc(num) && num >= math.MinInt64 && num < math.MaxInt64 {
+			// 1.0 == 1, also -0 == 0
+			return mixHash(uint64(int64(num))) //nolint:gosec // two's complement
+		}
+		return mixHash(math.Float64bits(num))
+	case IsBigNumber(v):
+		return hashBigNumber(v)
+	case IsInstance(v):
+		if hash, found := userHash(ValueAsInstance(v)); found {
+			return hash
+		}
+		return mixHash(uint64(v))
+	default:
+		return mixHash(uint64(v))
+	}
+}
+
+// mixHash is splitmix64 finalizer.
+func mixHash(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
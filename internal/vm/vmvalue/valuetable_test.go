@@ -0,0 +1,82 @@
+package vmvalue_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/leonardinius/goloxvm/internal/vm/vmvalue"
+
+	_ "github.com/leonardinius/goloxvm/internal/tests"
+)
+
+func TestValueTableBasicOps(t *testing.T) {
+	h := vmvalue.NewValueTable()
+	t.Cleanup(h.Free)
+
+	chars := []byte("s1")
+	s1 := vmvalue.ObjAsValue(vmvalue.NewTakeString(chars, vmvalue.HashString(chars)))
+
+	assert.True(t, h.Set(s1, vmvalue.NumberAsValue(10)))
+	assert.True(t, h.Set(vmvalue.NumberAsValue(0), vmvalue.TrueValue))
+	assert.True(t, h.Set(vmvalue.NilValue, vmvalue.FalseValue))
+	assert.False(t, h.Set(s1, vmvalue.NumberAsValue(11)))
+	assert.Equal(t, 3, h.Len())
+
+	v, ok := h.Get(s1)
+	assert.True(t, ok)
+	assert.InDelta(t, 11, vmvalue.ValueAsNumber(v), 0)
+
+	// -0 == 0
+	v, ok = h.Get(vmvalue.NumberAsValue(-0.0 * 1))
+	assert.True(t, ok)
+	assert.Equal(t, vmvalue.TrueValue, v)
+
+	_, ok = h.Get(vmvalue.NumberAsValue(1))
+	assert.False(t, ok)
+
+	assert.True(t, h.Delete(vmvalue.NilValue))
+	assert.False(t, h.Delete(vmvalue.NilValue))
+	assert.Equal(t, 2, h.Len())
+}
+
+func TestValueTableKeepsInsertionOrder(t *testing.T) {
+	h := vmvalue.NewValueTable()
+	t.Cleanup(h.Free)
+
+	for i := range 512 {
+		h.Set(vmvalue.NumberAsValue(float64(i)), vmvalue.NumberAsValue(float64(i*10)))
+	}
+	for i := range 512 {
+		if i%3 == 0 {
+			assert.True(t, h.Delete(vmvalue.NumberAsValue(float64(i))))
+		}
+	}
+	// re-inserted keys go last
+	h.Set(vmvalue.NumberAsValue(0), vmvalue.NilValue)
+
+	keys := []float64{}
+	h.Each(func(key, _ vmvalue.Value) {
+		keys = append(keys, vmvalue.ValueAsNumber(key))
+	})
+
+	expected := []float64{}
+	for i := range 512 {
+		if i%3 != 0 {
+			expected = append(expected, float64(i))
+		}
+	}
+	expected = append(expected, 0)
+	assert.Equal(t, expected, keys)
+	assert.Equal(t, len(expected), h.Len())
+
+	for pos, i := 0, 0; ; i++ {
+		key, _, next, ok := h.EntryAt(pos)
+		if !ok {
+			assert.Equal(t, len(expected), i)
+			break
+		}
+		assert.InDelta(t, expected[i], vmvalue.ValueAsNumber(key), 0)
+		pos = next
+	}
+}
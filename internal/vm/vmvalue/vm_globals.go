@@ -1,23 +1,41 @@
 package vmvalue
 
-var gGlobalEnv Table
+var (
+	gGlobalEnv Table
+	// gGlobalConsts has the names of the constant globals, assigning them fails
+	gGlobalConsts Table
+)
 
 func InitGlobals() {
 	gGlobalEnv = NewHashtable()
+	gGlobalConsts = NewHashtable()
 }
 
 func FreeGlobals() {
 	gGlobalEnv.Free()
+	gGlobalConsts.Free()
 }
 
 func MarkGlobals() {
 	gGlobalEnv.Mark()
+	gGlobalConsts.Mark()
 }
 
 func SetGlobal(name *ObjString, value Value) bool {
 	return gGlobalEnv.Set(name, value)
 }
 
+// DefineConstGlobal defines the global which can't be assigned afterwards.
+func DefineConstGlobal(name *ObjString, value Value) {
+	gGlobalEnv.Set(name, value)
+	gGlobalConsts.Set(name, TrueValue)
+}
+
+func IsConstGlobal(name *ObjString) bool {
+	_, found := gGlobalConsts.Get(name)
+	return found
+}
+
 func GetGlobal(name *ObjString) (Value, bool) {
 	return gGlobalEnv.Get(name)
 }
@@ -25,3 +43,7 @@ func GetGlobal(name *ObjString) (Value, bool) {
 func DeleteGlobal(name *ObjString) bool {
 	return gGlobalEnv.Delete(name)
 }
+
+func EachGlobal(fn func(name *ObjString, value Value)) {
+	gGlobalEnv.Each(fn)
+}
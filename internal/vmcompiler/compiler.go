@@ -19,6 +19,11 @@ const (
 	MaxJump          = math.MaxUint16
 )
 
+const anonymousFunctionName = "anonymous"
+
+// unknownStackHeight marks the stack height unknown, it stays negative whatever is emitted.
+const unknownStackHeight = math.MinInt32
+
 type FunctionType int
 
 const (
@@ -27,6 +32,9 @@ const (
 	FunctionTypeFunction
 	FunctionTypeMethod
 	FunctionTypeInitializer
+	FunctionTypeStaticMethod
+	FunctionTypeGetter
+	FunctionTypeSetter
 )
 
 type Compiler struct {
@@ -38,20 +46,33 @@ type Compiler struct {
 	LocalCount int
 	ScoreDepth int
 
+	// StackHeight is the number of the values on the stack of the call frame,
+	// the match expressions keep their locals above the temporaries.
+	StackHeight int
+
 	Upvalues [MaxUpvalueCount]Upvalue
 
+	// Signature is the function type declared by the annotations, if any
+	Signature signature
+
 	Enclosing *Compiler
 }
 
 type ClassCompiler struct {
 	Enclosing     *ClassCompiler
 	HasSuperclass bool
+	IsTrait       bool
+	IsAbstract    bool
+	ID            int // private member names are unique per class declaration
 }
 
 type Local struct {
 	Name       scanner.Token
 	Depth      int
 	IsCaptured bool
+	IsConst    bool
+	Type       staticType
+	Slot       int // the stack slot, which is the local index unless declared within an expression
 }
 
 func (l *Local) SetName(name string) {
@@ -65,21 +86,28 @@ type Upvalue struct {
 	Local byte
 }
 
-func NewCompiler(fnType FunctionType, fnName *vmvalue.ObjString) *Compiler {
+// NewCompiler starts compiling the function, the name is interned once the function
+// is reachable from the compiler roots, so the garbage collector can't free it in between.
+func NewCompiler(fnType FunctionType, fnName []byte) *Compiler {
 	chunk := vmchunk.NewChunk()
 	compiler := Compiler{}
 	compiler.Chunk = chunk
 	compiler.FnType = fnType
 	compiler.Function = vmvalue.NewFunction(chunk.AsPtr(), chunk.Free, chunk.Mark)
-	compiler.Function.Name = fnName
 	compiler.Enclosing = gCurrent
 	gCurrent = &compiler
+	if fnName != nil {
+		compiler.Function.Name = vmvalue.StringInternTake(fnName)
+	}
 
 	compiler.LocalCount = 0
 	local := &compiler.Locals[compiler.LocalCount]
 	compiler.LocalCount++
+	compiler.StackHeight = 1
 	local.Depth = 0
 	local.IsCaptured = false
+	local.IsConst = false
+	local.Type = typeAny
 	if fnType != FunctionTypeFunction {
 		local.SetName("this")
 	} else {
@@ -92,6 +120,11 @@ func Compile(source []byte) (*vmvalue.ObjFunction, bool) {
 	gScanner = scanner.NewScanner(source)
 	defer gScanner.Free()
 	gParser = NewParser()
+	gConstGlobals = map[string]bool{}
+	gTypes = nil
+	gExprType = nil
+	gGlobalTypes = map[string]staticType{}
+	gClassParents = map[string][]string{}
 
 	_ = NewCompiler(FunctionTypeScript, nil)
 
@@ -105,12 +138,22 @@ func Compile(source []byte) (*vmvalue.ObjFunction, bool) {
 	return fn, !gParser.hadError
 }
 
+// Check compiles the source without running it, reporting the type errors as well as the syntax ones.
+func Check(source []byte) bool {
+	gChecking = true
+	defer func() { gChecking = false }()
+
+	_, ok := Compile(source)
+	return ok && !gParser.hadTypeError
+}
+
 func currentChunk() *vmchunk.Chunk {
 	return vmchunk.FromPtr(gCurrent.Function.Chunk)
 }
 
 func emitOpcode(op bytecode.OpCode) {
 	currentChunk().WriteOpcode(op, gParser.previous.Line)
+	gCurrent.StackHeight += stackEffect(op, 0)
 }
 
 func emitOpcodes(op1, op2 bytecode.OpCode) {
@@ -125,6 +168,43 @@ func emitByte(b byte) {
 func emitOpByte(op bytecode.OpCode, b byte) {
 	currentChunk().WriteOpcode(op, gParser.previous.Line)
 	currentChunk().Write(b, gParser.previous.Line)
+	gCurrent.StackHeight += stackEffect(op, b)
+}
+
+// stackEffect is the change of the stack height made by the instruction when it falls through,
+// the callers adjust the height for the instructions with the count in the second operand.
+func stackEffect(op bytecode.OpCode, operand byte) int {
+	switch op {
+	case bytecode.OpConstant, bytecode.OpNil, bytecode.OpTrue, bytecode.OpFalse,
+		bytecode.OpDup, bytecode.OpDupUnder, bytecode.OpGetLocal, bytecode.OpGetUpvalue, bytecode.OpGetGlobal,
+		bytecode.OpClass, bytecode.OpTrait, bytecode.OpAbstractClass, bytecode.OpEnum, bytecode.OpClosure:
+		return 1
+	case bytecode.OpPop, bytecode.OpPrint, bytecode.OpDefineGlobal, bytecode.OpDefineConst,
+		bytecode.OpEqual, bytecode.OpGreater, bytecode.OpLess, bytecode.OpAdd, bytecode.OpSubtract,
+		bytecode.OpMultiply, bytecode.OpDivide, bytecode.OpModulo, bytecode.OpBitAnd, bytecode.OpBitOr,
+		bytecode.OpBitXor, bytecode.OpShiftLeft, bytecode.OpShiftRight, bytecode.OpIs,
+		bytecode.OpSetProperty, bytecode.OpGetIndex, bytecode.OpMethod, bytecode.OpStaticMethod,
+		bytecode.OpStaticField, bytecode.OpGetter, bytecode.OpSetter, bytecode.OpEndClass, bytecode.OpInherit,
+		bytecode.OpGetSuper, bytecode.OpSuperInvoke, bytecode.OpCloseUpvalue, bytecode.OpReturn:
+		return -1
+	case bytecode.OpSetIndex, bytecode.OpMixin:
+		return -2
+	case bytecode.OpCall:
+		return -int(operand)
+	case bytecode.OpList:
+		return 1 - int(operand)
+	case bytecode.OpMap:
+		return 1 - 2*int(operand)
+	default:
+		return 0
+	}
+}
+
+// emitInvoke emits the method call, the arguments are replaced with the result.
+func emitInvoke(op bytecode.OpCode, name, argCount byte) {
+	emitOpByte(op, name)
+	emitByte(argCount)
+	gCurrent.StackHeight -= int(argCount)
 }
 
 func emitJump(op bytecode.OpCode) int {
@@ -134,6 +214,14 @@ func emitJump(op bytecode.OpCode) int {
 	return currentChunk().Count - 2
 }
 
+// emitArgJump emits jump over default value of the parameter at slot, taken when the argument is passed.
+func emitArgJump(slot int) int {
+	emitOpByte(bytecode.OpJumpIfArgPassed, byte(slot))
+	currentChunk().Write(0xff, gParser.previous.Line)
+	currentChunk().Write(0xff, gParser.previous.Line)
+	return currentChunk().Count - 2
+}
+
 func emitLoop(loopStart int) {
 	emitOpcode(bytecode.OpLoop)
 
@@ -177,9 +265,13 @@ func makeConstant(v vmvalue.Value) int {
 }
 
 func emitReturn() {
-	if gCurrent.FnType == FunctionTypeInitializer {
+	switch gCurrent.FnType {
+	case FunctionTypeInitializer:
 		emitOpByte(bytecode.OpGetLocal, 0)
-	} else {
+	case FunctionTypeSetter:
+		// assignment evaluates to the assigned value
+		emitOpByte(bytecode.OpGetLocal, 1)
+	default:
 		emitOpcode(bytecode.OpNil)
 	}
 	emitOpcode(bytecode.OpReturn)
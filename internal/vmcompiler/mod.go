@@ -9,4 +9,17 @@ var (
 	gParser       Parser
 	gCurrent      *Compiler      = nil
 	gCurrentClass *ClassCompiler = nil
+	gClassCount   int
+	// gConstGlobals are the names of the global constants declared by the compiled source so far
+	gConstGlobals map[string]bool
+	// gChecking enables the type errors reported by `check`
+	gChecking bool
+	// gTypes are the types of the expressions parsed in the current statement
+	gTypes []typedExpr
+	// gExprType is the type set by the current parse rule
+	gExprType *staticType
+	// gGlobalTypes are the types of the global variables declared by the compiled source so far
+	gGlobalTypes map[string]staticType
+	// gClassParents are the superclass and the traits of the classes declared by the compiled source so far
+	gClassParents map[string][]string
 )
@@ -3,8 +3,11 @@ package vmcompiler
 import (
 	"bytes"
 	"fmt"
+	"math/big"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/leonardinius/goloxvm/internal/vm/bytecode"
 	"github.com/leonardinius/goloxvm/internal/vm/vmvalue"
@@ -17,6 +20,11 @@ type Parser struct {
 	previous  scanner.Token
 	hadError  bool
 	panicMode bool
+	// hadTypeError is set by the type errors reported by `check`
+	hadTypeError bool
+	// prefixIncrement is OpIncrement/OpDecrement of the pending `++x`/`--x`,
+	// applied by the variable or property at the end of the operand chain.
+	prefixIncrement bytecode.OpCode
 }
 
 func NewParser() Parser {
@@ -31,15 +39,21 @@ type ParsePrecedence int
 const (
 	_ ParsePrecedence = iota
 	PrecedenceNone
-	PrecedenceAssignment // =
-	PrecedenceOr         // or
-	PrecedenceAnd        // and
-	PrecedenceEquality   // == !=
-	PrecedenceComparison // < > <= >=
-	PrecedenceTerm       // + -
-	PrecedenceFactor     // * /
-	PrecedenceUnary      // ! -
-	PrecedenceCall       // . ()
+	PrecedenceAssignment  // =
+	PrecedenceConditional // ?:
+	PrecedenceCoalesce    // ??
+	PrecedenceOr          // or
+	PrecedenceAnd         // and
+	PrecedenceEquality    // == !=
+	PrecedenceComparison  // < > <= >=
+	PrecedenceBitOr       // |
+	PrecedenceBitXor      // ^
+	PrecedenceBitAnd      // &
+	PrecedenceShift       // << >>
+	PrecedenceTerm        // + -
+	PrecedenceFactor      // * / %
+	PrecedenceUnary       // ! - ~
+	PrecedenceCall        // . ()
 	PrecedencePrimary
 )
 
@@ -51,6 +65,12 @@ func (p ParsePrecedence) CanAssign() bool {
 	return p <= PrecedenceAssignment
 }
 
+// CanIncrement reports whether the property can be the `++`/`--` target, the members
+// of the optional chain are parsed with PrecedencePrimary and can't.
+func (p ParsePrecedence) CanIncrement() bool {
+	return p <= PrecedenceCall
+}
+
 type (
 	ParseFn func(precedence ParsePrecedence)
 )
@@ -75,32 +95,131 @@ func advance() {
 }
 
 func parsePrecedence(precedence ParsePrecedence) {
+	// nested expressions never apply the enclosing prefix increment
+	prefixIncrement := gParser.prefixIncrement
+	gParser.prefixIncrement = 0
+
+	promoteOperandKeyword()
 	advance()
+	parsePrecedenceFromPrevious(precedence)
+
+	gParser.prefixIncrement = prefixIncrement
+}
 
+// parsePrecedenceFromPrevious parses expression starting with already consumed token.
+func parsePrecedenceFromPrevious(precedence ParsePrecedence) {
 	prefixRule := mustGetRule(gParser.previous.Type).prefixRule
 	if prefixRule == nil {
 		errorAtPrev("Expect expression.")
 		return
 	}
+	token := gParser.previous
+	base := len(gTypes)
+	gExprType = nil
 	prefixRule(precedence)
+	resolveExprType(base, token)
 
-	for precedence <= mustGetRule(gParser.current.Type).precedence {
+	for promoteInfixKeyword(); precedence <= mustGetRule(gParser.current.Type).precedence; promoteInfixKeyword() {
 		advance()
 		infixRule := mustGetRule(gParser.previous.Type).infixRule
+		gExprType = nil
 		infixRule(precedence)
+		// the left operand type is replaced by the type of the whole expression
+		resolveExprType(base, token)
 	}
 
-	if precedence.CanAssign() && match(tokens.TokenEqual) {
+	if precedence.CanAssign() && (match(tokens.TokenEqual) || matchCompoundAssign() != 0) {
 		errorAtPrev("Invalid assignment target.")
 	}
 }
 
+var compoundAssignOps = map[tokens.TokenType]bytecode.OpCode{
+	tokens.TokenPlusEqual:    bytecode.OpAdd,
+	tokens.TokenMinusEqual:   bytecode.OpSubtract,
+	tokens.TokenStarEqual:    bytecode.OpMultiply,
+	tokens.TokenSlashEqual:   bytecode.OpDivide,
+	tokens.TokenPercentEqual: bytecode.OpModulo,
+}
+
+var incrementOps = map[tokens.TokenType]bytecode.OpCode{
+	tokens.TokenPlusPlus:   bytecode.OpIncrement,
+	tokens.TokenMinusMinus: bytecode.OpDecrement,
+}
+
+// matchCompoundAssign consumes `+=`, `-=`, etc. and returns the arithmetic opcode, or 0.
+func matchCompoundAssign() bytecode.OpCode {
+	op, ok := compoundAssignOps[gParser.current.Type]
+	if ok {
+		advance()
+	}
+	return op
+}
+
+// matchIncrement consumes postfix `++` or `--` and returns the opcode, or 0.
+func matchIncrement() bytecode.OpCode {
+	op, ok := incrementOps[gParser.current.Type]
+	if ok {
+		advance()
+	}
+	return op
+}
+
+func canIncrementPrefix(canIncrement bool) bytecode.OpCode {
+	if !canIncrement {
+		return 0
+	}
+	return takePrefixIncrement()
+}
+
+func canIncrementPostfix(canIncrement bool) bytecode.OpCode {
+	if !canIncrement {
+		return 0
+	}
+	return matchIncrement()
+}
+
+// takePrefixIncrement returns the pending prefix increment if the operand chain ends here.
+func takePrefixIncrement() bytecode.OpCode {
+	op := gParser.prefixIncrement
+	if op == 0 {
+		return 0
+	}
+
+	switch gParser.current.Type {
+	case tokens.TokenDot, tokens.TokenQuestionDot, tokens.TokenLeftParen, tokens.TokenLeftBracket:
+		return 0
+	}
+
+	gParser.prefixIncrement = 0
+	return op
+}
+
 func identifierConstant(token *scanner.Token) int {
 	identifier := vmvalue.StringInternCopy(token.Lexeme())
 	value := vmvalue.ObjAsValue(identifier)
 	return makeConstant(value)
 }
 
+// propertyConstant parses property name, either identifier or private `#name`.
+func propertyConstant(message string) int {
+	if match(tokens.TokenPrivateIdentifier) {
+		return privateConstant(&gParser.previous)
+	}
+	consume(tokens.TokenIdentifier, message)
+	return identifierConstant(&gParser.previous)
+}
+
+// privateConstant mangles private member name `#name` with the innermost class id,
+// so the name is accessible only from the code of the declaring class.
+func privateConstant(token *scanner.Token) int {
+	if gCurrentClass == nil {
+		errorAtPrev("Can't use private member outside of a class.")
+		return 0
+	}
+	name := fmt.Appendf(nil, "%s%c%d", token.Lexeme(), vmvalue.PrivateNameSeparator, gCurrentClass.ID)
+	return makeConstant(vmvalue.ObjAsValue(vmvalue.StringInternCopy(name)))
+}
+
 func resolveLocal(compiler *Compiler, name *scanner.Token) (slot int, ok bool) {
 	for i := compiler.LocalCount - 1; i >= 0; i-- {
 		local := &compiler.Locals[i]
@@ -122,10 +241,13 @@ func addLocal(name scanner.Token) {
 	}
 
 	local := &gCurrent.Locals[gCurrent.LocalCount]
+	local.Slot = gCurrent.LocalCount
 	gCurrent.LocalCount++
 	local.Name = name
 	local.Depth = -1
 	local.IsCaptured = false
+	local.IsConst = false
+	local.Type = typeAny
 }
 
 func resolveUpvalue(compiler *Compiler, name *scanner.Token) (slot int, ok bool) {
@@ -135,7 +257,7 @@ func resolveUpvalue(compiler *Compiler, name *scanner.Token) (slot int, ok bool)
 
 	if local, ok := resolveLocal(compiler.Enclosing, name); ok {
 		compiler.Enclosing.Locals[local].IsCaptured = true
-		return addUpvalue(compiler, local, 1), true
+		return addUpvalue(compiler, compiler.Enclosing.Locals[local].Slot, 1), true
 	}
 
 	if upvalue, ok := resolveUpvalue(compiler.Enclosing, name); ok {
@@ -168,11 +290,16 @@ func addUpvalue(compiler *Compiler, index int, islocal byte) int {
 }
 
 func declareVariable() {
+	declareLocal(&gParser.previous)
+}
+
+// declareLocal adds the local variable, unless in the global scope.
+func declareLocal(name *scanner.Token) {
 	if gCurrent.ScoreDepth == 0 {
+		delete(gGlobalTypes, name.LexemeAsString())
 		return
 	}
 
-	name := &gParser.previous
 	// search for local variable
 	for i := gCurrent.LocalCount - 1; i >= 0; i-- {
 		local := &gCurrent.Locals[i]
@@ -181,7 +308,7 @@ func declareVariable() {
 		}
 
 		if identifierEquals(name, &local.Name) {
-			errorAtPrev("Already a variable with this name in this scope.")
+			errorAt(name, "Already a variable with this name in this scope.")
 		}
 	}
 
@@ -239,6 +366,31 @@ func or_(ParsePrecedence) {
 	patchJump(endJump)
 }
 
+// conditional parses `cond ? then : else`, the condition has been already parsed.
+func conditional(ParsePrecedence) {
+	thenJump := emitJump(bytecode.OpJumpIfFalse)
+	emitOpcode(bytecode.OpPop)
+	parsePrecedence(PrecedenceConditional)
+	elseJump := emitJump(bytecode.OpJump)
+
+	consume(tokens.TokenColon, "Expect ':' after then branch of conditional expression.")
+	patchJump(thenJump)
+	emitOpcode(bytecode.OpPop)
+	// right associative: a ? b : c ? d : e
+	parsePrecedence(PrecedenceConditional)
+	patchJump(elseJump)
+}
+
+// coalesce parses `a ?? b`, b is evaluated only if a is nil.
+func coalesce(ParsePrecedence) {
+	endJump := emitJump(bytecode.OpJumpIfNotNil)
+
+	emitOpcode(bytecode.OpPop)
+	parsePrecedence(PrecedenceCoalesce.Next())
+
+	patchJump(endJump)
+}
+
 func expression() {
 	parsePrecedence(PrecedenceAssignment)
 }
@@ -251,32 +403,100 @@ func block() {
 	consume(tokens.TokenRightBrace, "Expect '}' after block.")
 }
 
-func function(fnType FunctionType, fnName *vmvalue.ObjString) {
+func function(fnType FunctionType, fnName []byte) staticType {
+	return functionBody(NewCompiler(fnType, fnName))
+}
+
+// asyncFunction compiles `async` function, calling it runs the function as the fiber
+// and returns the promise of its result.
+func asyncFunction(fnType FunctionType, fnName []byte) staticType {
 	compiler := NewCompiler(fnType, fnName)
+	compiler.Function.Async = true
+	t := functionBody(compiler)
+	// the call returns the promise
+	t.fn.result = typeAny
+	return t
+}
+
+// functionBody parses `(params): Type { ... }` and returns the function type.
+func functionBody(compiler *Compiler) staticType {
 	beginScope()
 
 	consume(tokens.TokenLeftParen, "Expect '(' after function name.")
-	if !check(tokens.TokenRightParen) {
-		for {
-			gCurrent.Function.Arity++
-			if gCurrent.Function.Arity > MaxArity {
-				errorAtCurrent("Can't have more than 255 parameters.")
-			}
+	parameters()
+	compiler.Signature.result = typeAnnotation()
+	t := functionType(compiler.Signature)
 
-			paramConstant := parseVariable("Expect parameter name.")
-			defineVariable(paramConstant)
+	consume(tokens.TokenLeftBrace, "Expect '{' before function body.")
+	block()
 
-			if !match(tokens.TokenComma) {
-				break
-			}
+	endFunction(compiler)
+	return t
+}
+
+// parameters parses parameter list `a, b: Type = default, ...rest`.
+func parameters() {
+	fn := gCurrent.Function
+	sig := &gCurrent.Signature
+	paramCount := 0
+	hasDefaults := false
+	// the default values are evaluated with all the arguments on the stack, counted once parsed
+	gCurrent.StackHeight = unknownStackHeight
+	for !check(tokens.TokenRightParen) && !check(tokens.TokenEOF) {
+		if fn.Variadic {
+			errorAtCurrent("Rest parameter must be last.")
+		}
+		paramCount++
+		if paramCount > MaxArity {
+			errorAtCurrent("Can't have more than 255 parameters.")
+		}
+		isRest := match(tokens.TokenEllipsis)
+		if !isRest {
+			fn.Arity++
+		}
+
+		paramConstant := parseVariable("Expect parameter name.")
+		paramType := typeAnnotation()
+		slot := gCurrent.LocalCount - 1
+		if isRest {
+			gCurrent.Locals[slot].Type = typeList
+		} else {
+			gCurrent.Locals[slot].Type = paramType
+			sig.params = append(sig.params, paramType)
+		}
+		switch {
+		case isRest:
+			fn.Variadic = true
+		case match(tokens.TokenEqual):
+			hasDefaults = true
+			defaultValue(slot)
+		case hasDefaults:
+			errorAtPrev("Parameter without default value can't follow parameters with default values.")
+		default:
+			fn.MinArity++
+		}
+		defineVariable(paramConstant)
+
+		if !match(tokens.TokenComma) {
+			break
 		}
 	}
 	consume(tokens.TokenRightParen, "Expect ')' after parameters.")
+	sig.minArity, sig.arity, sig.variadic = fn.MinArity, fn.Arity, fn.Variadic
+	gCurrent.StackHeight = gCurrent.LocalCount
+}
 
-	consume(tokens.TokenLeftBrace, "Expect '{' before function body.")
-	block()
+// defaultValue compiles the default value expression of the parameter at slot,
+// evaluated in the callee only when the argument is missing.
+func defaultValue(slot int) {
+	skipJump := emitArgJump(slot)
+	expression()
+	emitOpByte(bytecode.OpSetLocal, byte(slot))
+	emitOpcode(bytecode.OpPop)
+	patchJump(skipJump)
+}
 
-	// end of function
+func endFunction(compiler *Compiler) {
 	fn := endCompiler()
 	emitOpByte(bytecode.OpClosure, byte(makeConstant(vmvalue.ObjAsValue(fn))))
 	for i := range fn.UpvalueCount {
@@ -286,29 +506,375 @@ func function(fnType FunctionType, fnName *vmvalue.ObjString) {
 	}
 }
 
-func method() {
-	consume(tokens.TokenIdentifier, "Expect method name.")
-	name := identifierConstant(&gParser.previous)
+// lambda parses anonymous function expression `fun (a, b) { ... }`.
+func lambda(ParsePrecedence) {
+	if !check(tokens.TokenLeftParen) {
+		// function declaration is not an expression
+		errorAtPrev("Expect expression.")
+		return
+	}
+	setExprType(function(FunctionTypeFunction, []byte(anonymousFunctionName)))
+}
+
+// asyncLambda parses `async fun (...) { ... }` function expression.
+func asyncLambda(ParsePrecedence) {
+	consume(tokens.TokenFun, "Expect 'fun' after 'async'.")
+	setExprType(asyncFunction(FunctionTypeFunction, []byte(anonymousFunctionName)))
+}
+
+// arrowFunction parses `(a, b) => expression` or `(a, b): Type => { ... }`, '(' is already consumed.
+func arrowFunction() staticType {
+	compiler := NewCompiler(FunctionTypeFunction, []byte(anonymousFunctionName))
+	beginScope()
+
+	parameters()
+	compiler.Signature.result = typeAnnotation()
+	t := functionType(compiler.Signature)
+	consume(tokens.TokenArrow, "Expect '=>' after parameters.")
+
+	if match(tokens.TokenLeftBrace) {
+		block()
+	} else {
+		expression()
+		checkReturnType()
+		emitOpcode(bytecode.OpReturn)
+	}
+
+	endFunction(compiler)
+	return t
+}
+
+// isArrowFunctionAhead looks ahead (without consuming) if the '(' just consumed
+// starts parameter list of an arrow function. The lookahead follows the parameter list
+// and gives up at the first token which can't be there, so the nested groupings are
+// not scanned to their end by every enclosing one. Only the default values are skipped.
+func isArrowFunctionAhead() bool {
+	lookahead := gScanner
+	token := gParser.current
+	for token.Type != tokens.TokenRightParen {
+		if token.Type == tokens.TokenEllipsis {
+			token = lookahead.ScanToken()
+		}
+		if token.Type != tokens.TokenIdentifier {
+			return false
+		}
+		token = lookahead.ScanToken()
+		if token.Type == tokens.TokenColon {
+			// skip the parameter type annotation `a: Type`
+			lookahead.ScanToken()
+			token = lookahead.ScanToken()
+		}
+		if token.Type == tokens.TokenEqual {
+			token = skipDefaultValue(&lookahead)
+		}
+		switch token.Type {
+		case tokens.TokenComma:
+			token = lookahead.ScanToken()
+		case tokens.TokenRightParen:
+		default:
+			return false
+		}
+	}
+	next := lookahead.ScanToken()
+	if next.Type == tokens.TokenColon {
+		// skip the return type annotation `(a): Type =>`
+		lookahead.ScanToken()
+		next = lookahead.ScanToken()
+	}
+	return next.Type == tokens.TokenArrow
+}
+
+// skipDefaultValue scans the default parameter value up to the ',' or ')' which ends it,
+// and returns that token.
+func skipDefaultValue(lookahead *scanner.Scanner) scanner.Token {
+	depth := 0
+	for {
+		token := lookahead.ScanToken()
+		switch token.Type {
+		case tokens.TokenLeftParen, tokens.TokenLeftBracket, tokens.TokenLeftBrace:
+			depth++
+		case tokens.TokenRightParen, tokens.TokenRightBracket, tokens.TokenRightBrace:
+			if depth == 0 {
+				return token
+			}
+			depth--
+		case tokens.TokenComma:
+			if depth == 0 {
+				return token
+			}
+		case tokens.TokenEOF, tokens.TokenError:
+			return token
+		default: // skip
+		}
+	}
+}
+
+// classMember parses class body member: method, `static` method or field, `get` or `set` accessor.
+func classMember() {
+	promoteMemberKeyword()
+	switch {
+	case checkContextualKeyword("static"):
+		advance()
+		staticMember()
+	case checkContextualKeyword("get"):
+		advance()
+		accessor(FunctionTypeGetter, bytecode.OpGetter)
+	case checkContextualKeyword("set"):
+		advance()
+		accessor(FunctionTypeSetter, bytecode.OpSetter)
+	case match(tokens.TokenAsync):
+		method(true)
+	case match(tokens.TokenAbstract):
+		abstractMethod()
+	default:
+		method(false)
+	}
+}
+
+// checkContextualKeyword checks if the current token is the identifier used as a keyword,
+// e.g. `static name` or `static async`, so `get()` is still a regular method.
+func checkContextualKeyword(keyword string) bool {
+	return check(tokens.TokenIdentifier) && gParser.current.LexemeAsString() == keyword && !followsName(peekNext())
+}
+
+// matchContextualKeyword consumes the identifier used as the keyword within the statement,
+// like `case` within the match statement.
+func matchContextualKeyword(keyword string) bool {
+	if !check(tokens.TokenIdentifier) || gParser.current.LexemeAsString() != keyword {
+		return false
+	}
+	advance()
+	return true
+}
+
+// peekNext returns the token after the current one.
+func peekNext() scanner.Token {
+	lookahead := gScanner
+	return lookahead.ScanToken()
+}
+
+// followsName reports the token which can follow the name within the expression. The contextual keywords
+// are identifiers followed by anything else, so `enum Color {}` declares the enum while `enum = 1` assigns.
+func followsName(next scanner.Token) bool {
+	switch next.Type {
+	case tokens.TokenIdentifier:
+		// the infix contextual keyword, or `in` of the for-in loop
+		return next.LexemeAsString() == "is" || next.LexemeAsString() == "in"
+	case tokens.TokenEqual, tokens.TokenPlusEqual, tokens.TokenMinusEqual, tokens.TokenStarEqual,
+		tokens.TokenSlashEqual, tokens.TokenPercentEqual, tokens.TokenSemicolon, tokens.TokenComma,
+		tokens.TokenRightParen, tokens.TokenRightBracket, tokens.TokenRightBrace, tokens.TokenColon,
+		tokens.TokenArrow, tokens.TokenEOF, tokens.TokenError:
+		return true
+	default:
+		return mustGetRule(next.Type).infixRule != nil
+	}
+}
+
+// promoteKeyword turns the current identifier into the keyword token when it is used as the keyword,
+// so the parser matches the contextual keyword as any other.
+func promoteKeyword(keyword tokens.TokenType, used bool) {
+	if used {
+		gParser.current.Type = keyword
+	}
+}
+
+// promoteDeclarationKeyword promotes the keyword starting the declaration:
+// `abstract class`, `trait Name`, `enum Name`, `const name` or `async fun`.
+func promoteDeclarationKeyword() {
+	if !check(tokens.TokenIdentifier) {
+		return
+	}
+	keyword, ok := declarationKeywords[gParser.current.LexemeAsString()]
+	promoteKeyword(keyword, ok && !followsName(peekNext()))
+}
+
+var declarationKeywords = map[string]tokens.TokenType{
+	"abstract": tokens.TokenAbstract,
+	"async":    tokens.TokenAsync,
+	"const":    tokens.TokenConst,
+	"enum":     tokens.TokenEnum,
+	"trait":    tokens.TokenTrait,
+}
+
+// promoteMemberKeyword promotes the keyword of the class member `async name()` or `abstract name();`.
+func promoteMemberKeyword() {
+	if !check(tokens.TokenIdentifier) {
+		return
+	}
+	switch gParser.current.LexemeAsString() {
+	case "async":
+		promoteKeyword(tokens.TokenAsync, !followsName(peekNext()))
+	case "abstract":
+		promoteKeyword(tokens.TokenAbstract, !followsName(peekNext()))
+	}
+}
+
+// promoteOperandKeyword promotes the keyword starting the operand: `async fun`, `match (value) {`,
+// `await` within the async function and `yield` within the function. Elsewhere they are the keywords
+// where the name can't appear, so the misplaced `await value` is reported.
+func promoteOperandKeyword() {
+	if !check(tokens.TokenIdentifier) {
+		return
+	}
+	switch gParser.current.LexemeAsString() {
+	case "async":
+		promoteKeyword(tokens.TokenAsync, !followsName(peekNext()))
+	case "await":
+		promoteKeyword(tokens.TokenAwait, gCurrent.Function.Async || !followsName(peekNext()))
+	case "yield":
+		promoteKeyword(tokens.TokenYield, gCurrent.FnType != FunctionTypeScript || !followsName(peekNext()))
+	case "match":
+		promoteKeyword(tokens.TokenMatch, isMatchAhead())
+	}
+}
+
+// promoteInfixKeyword promotes `is` following the operand, where the name can't appear.
+func promoteInfixKeyword() {
+	if check(tokens.TokenIdentifier) && gParser.current.LexemeAsString() == "is" {
+		gParser.current.Type = tokens.TokenIs
+	}
+}
+
+// isMatchAhead reports `match (value) {`. The `match` is the contextual keyword,
+// so it is still the name of the variable or the function called by the expression.
+func isMatchAhead() bool {
+	if !check(tokens.TokenIdentifier) || gParser.current.LexemeAsString() != "match" {
+		return false
+	}
+	lookahead := gScanner
+	if lookahead.ScanToken().Type != tokens.TokenLeftParen {
+		return false
+	}
+	for depth := 1; depth > 0; {
+		switch lookahead.ScanToken().Type {
+		case tokens.TokenLeftParen:
+			depth++
+		case tokens.TokenRightParen:
+			depth--
+		case tokens.TokenEOF, tokens.TokenError:
+			return false
+		default: // skip
+		}
+	}
+	return lookahead.ScanToken().Type == tokens.TokenLeftBrace
+}
+
+func method(async bool) {
+	name := propertyConstant("Expect method name.")
 
 	fnType := FunctionTypeMethod
 	if gParser.previous.Length == 4 &&
 		gParser.previous.LexemeAsString() == "init" {
 		fnType = FunctionTypeInitializer
 	}
-	function(fnType, vmvalue.StringInternTake(gParser.previous.Lexeme()))
+	fnName := gParser.previous.Lexeme()
+	switch {
+	case !async:
+		function(fnType, fnName)
+	case fnType == FunctionTypeInitializer:
+		errorAtPrev("Can't make an initializer async.")
+		function(fnType, fnName)
+	default:
+		asyncFunction(fnType, fnName)
+	}
 
 	emitOpByte(bytecode.OpMethod, byte(name))
 }
 
-func classDeclaration() {
+// abstractMethod parses `abstract name(params);` declaration without the body,
+// the concrete subclasses have to implement the method.
+func abstractMethod() {
+	name := propertyConstant("Expect method name.")
+	if !gCurrentClass.IsAbstract && !gCurrentClass.IsTrait {
+		errorAtPrev("Only abstract classes and traits can have abstract methods.")
+	}
+	if gParser.previous.LexemeAsString() == "init" {
+		errorAtPrev("Can't make an initializer abstract.")
+	}
+
+	consume(tokens.TokenLeftParen, "Expect '(' after method name.")
+	if !check(tokens.TokenRightParen) {
+		for {
+			match(tokens.TokenEllipsis)
+			consume(tokens.TokenIdentifier, "Expect parameter name.")
+			typeAnnotation()
+			if !match(tokens.TokenComma) {
+				break
+			}
+		}
+	}
+	consume(tokens.TokenRightParen, "Expect ')' after parameters.")
+	typeAnnotation()
+	consume(tokens.TokenSemicolon, "Expect ';' after abstract method declaration.")
+
+	emitOpByte(bytecode.OpAbstractMethod, byte(name))
+}
+
+// staticMember parses `static name(...) { ... }` method or `static name = value;` class field.
+func staticMember() {
+	promoteMemberKeyword()
+	async := match(tokens.TokenAsync)
+	name := propertyConstant("Expect static member name.")
+
+	if async {
+		asyncFunction(FunctionTypeStaticMethod, gParser.previous.Lexeme())
+		emitOpByte(bytecode.OpStaticMethod, byte(name))
+		return
+	}
+	if check(tokens.TokenLeftParen) {
+		function(FunctionTypeStaticMethod, gParser.previous.Lexeme())
+		emitOpByte(bytecode.OpStaticMethod, byte(name))
+		return
+	}
+
+	if match(tokens.TokenEqual) {
+		expression()
+	} else {
+		emitOpcode(bytecode.OpNil)
+	}
+	consume(tokens.TokenSemicolon, "Expect ';' after static field declaration.")
+	emitOpByte(bytecode.OpStaticField, byte(name))
+}
+
+// accessor parses `get name { ... }` or `set name(value) { ... }` property accessor.
+func accessor(fnType FunctionType, op bytecode.OpCode) {
+	name := propertyConstant("Expect property name.")
+	fnName := gParser.previous.Lexeme()
+
+	compiler := NewCompiler(fnType, fnName)
+	beginScope()
+	if fnType == FunctionTypeSetter {
+		consume(tokens.TokenLeftParen, "Expect '(' after setter name.")
+		parameters()
+		if fn := compiler.Function; fn.Arity != 1 || fn.Variadic {
+			errorAtPrev("Setter must have exactly one parameter.")
+		}
+	}
+	consume(tokens.TokenLeftBrace, "Expect '{' before accessor body.")
+	block()
+	endFunction(compiler)
+
+	emitOpByte(op, byte(name))
+}
+
+// classDeclaration parses `class Name < Superclass with Trait { ... }`, the abstract class
+// can't be instantiated and can have abstract methods.
+func classDeclaration(abstract bool) {
 	consume(tokens.TokenIdentifier, "Expect class name.")
 	className := gParser.previous
 	nameConstant := identifierConstant(&className)
 	declareVariable()
+	declareType(&className, classType(&className))
+	gClassParents[className.LexemeAsString()] = nil
 
-	emitOpByte(bytecode.OpClass, byte(nameConstant))
+	if abstract {
+		emitOpByte(bytecode.OpAbstractClass, byte(nameConstant))
+	} else {
+		emitOpByte(bytecode.OpClass, byte(nameConstant))
+	}
 	defineVariable(nameConstant)
-	classCompiler := ClassCompiler{Enclosing: gCurrentClass, HasSuperclass: false}
+	gClassCount++
+	classCompiler := ClassCompiler{Enclosing: gCurrentClass, HasSuperclass: false, IsAbstract: abstract, ID: gClassCount}
 	gCurrentClass = &classCompiler
 
 	if match(tokens.TokenLess) {
@@ -317,6 +883,7 @@ func classDeclaration() {
 		if identifierEquals(&className, &gParser.previous) {
 			errorAtPrev("A class can't inherit from itself.")
 		}
+		addClassParent(&className, &gParser.previous)
 
 		beginScope()
 		addLocal(syntheticToken("super"))
@@ -326,47 +893,283 @@ func classDeclaration() {
 		emitOpcode(bytecode.OpInherit)
 		classCompiler.HasSuperclass = true
 	}
+	traitList(className)
 
-	namedVariable(className, false)
-	consume(tokens.TokenLeftBrace, "Expect '{' before class body.")
-	for !check(tokens.TokenRightBrace) && !check(tokens.TokenEOF) {
-		method()
-	}
-	consume(tokens.TokenRightBrace, "Expect '}' after class body.")
-	emitOpcode(bytecode.OpPop)
+	classBody(className, "Expect '{' before class body.", "Expect '}' after class body.")
 	if classCompiler.HasSuperclass {
 		endScope()
 	}
 	gCurrentClass = gCurrentClass.Enclosing
 }
 
-func funDeclaration() {
-	global := parseVariable("Expect function name.")
-	markInitialized()
-	function(FunctionTypeFunction, vmvalue.StringInternTake(gParser.previous.Lexeme()))
-	defineVariable(global)
-}
-
-func varDeclaration() {
-	global := parseVariable("Expect variable name.")
+// traitDeclaration parses `trait Name with Other { ... }`, the trait has the members of the class,
+// which are copied into the classes mixing it in.
+func traitDeclaration() {
+	consume(tokens.TokenIdentifier, "Expect trait name.")
+	traitName := gParser.previous
+	nameConstant := identifierConstant(&traitName)
+	declareVariable()
+	declareType(&traitName, classType(&traitName))
+	gClassParents[traitName.LexemeAsString()] = nil
 
-	if match(tokens.TokenEqual) {
-		expression()
-	} else {
-		emitOpcode(bytecode.OpNil)
-	}
-	consume(tokens.TokenSemicolon, "Expect ';' after variable declaration.")
+	emitOpByte(bytecode.OpTrait, byte(nameConstant))
+	defineVariable(nameConstant)
+	gClassCount++
+	classCompiler := ClassCompiler{Enclosing: gCurrentClass, IsTrait: true, ID: gClassCount}
+	gCurrentClass = &classCompiler
 
-	defineVariable(global)
+	traitList(traitName)
+	classBody(traitName, "Expect '{' before trait body.", "Expect '}' after trait body.")
+	gCurrentClass = gCurrentClass.Enclosing
 }
 
-func printStatement() {
-	expression()
-	consume(tokens.TokenSemicolon, "Expect ';' after value.")
-	emitOpcode(bytecode.OpPrint)
+// traitList parses `with Trait, ...` clause, the traits are mixed in before the members are defined.
+func traitList(className scanner.Token) {
+	if !check(tokens.TokenIdentifier) || gParser.current.LexemeAsString() != "with" {
+		return
+	}
+	advance()
+	for {
+		consume(tokens.TokenIdentifier, "Expect trait name.")
+		if identifierEquals(&className, &gParser.previous) {
+			errorAtPrev("A class can't mix in itself.")
+		}
+		addClassParent(&className, &gParser.previous)
+		variable_(false)
+		namedVariable(className, false)
+		emitOpcode(bytecode.OpMixin)
+		if !match(tokens.TokenComma) {
+			break
+		}
+	}
 }
 
-func returnStatement() {
+// classBody parses the members, OpEndClass completes the class once they are defined.
+func classBody(className scanner.Token, beforeMessage, afterMessage string) {
+	namedVariable(className, false)
+	consume(tokens.TokenLeftBrace, beforeMessage)
+	for !check(tokens.TokenRightBrace) && !check(tokens.TokenEOF) {
+		classMember()
+	}
+	consume(tokens.TokenRightBrace, afterMessage)
+	emitOpcode(bytecode.OpEndClass)
+}
+
+// enumDeclaration parses `enum Name { Member, ... }`, a trailing comma is allowed.
+func enumDeclaration() {
+	consume(tokens.TokenIdentifier, "Expect enum name.")
+	nameConstant := identifierConstant(&gParser.previous)
+	declareVariable()
+	emitOpByte(bytecode.OpEnum, byte(nameConstant))
+
+	consume(tokens.TokenLeftBrace, "Expect '{' before enum body.")
+	var members []scanner.Token
+	for !check(tokens.TokenRightBrace) && !check(tokens.TokenEOF) {
+		consume(tokens.TokenIdentifier, "Expect enum member name.")
+		member := gParser.previous
+		for i := range members {
+			if identifierEquals(&members[i], &member) {
+				errorAtPrev("Already a member with this name in this enum.")
+			}
+		}
+		members = append(members, member)
+		emitOpByte(bytecode.OpEnumMember, byte(identifierConstant(&member)))
+		if !match(tokens.TokenComma) {
+			break
+		}
+	}
+	consume(tokens.TokenRightBrace, "Expect '}' after enum members.")
+	defineVariable(nameConstant)
+}
+
+func funDeclaration() {
+	if check(tokens.TokenLeftParen) {
+		// anonymous function expression statement, e.g. `fun () { ... }();`
+		parsePrecedenceFromPrevious(PrecedenceAssignment)
+		consume(tokens.TokenSemicolon, "Expect ';' after expression.")
+		emitOpcode(bytecode.OpPop)
+		return
+	}
+
+	global := parseVariable("Expect function name.")
+	name := gParser.previous
+	markInitialized()
+	declareType(&name, function(FunctionTypeFunction, name.Lexeme()))
+	defineVariable(global)
+}
+
+// asyncFunDeclaration parses `async fun name(...) { ... }`, `async` is already consumed.
+func asyncFunDeclaration() {
+	if lookahead := gScanner; check(tokens.TokenFun) && lookahead.ScanToken().Type == tokens.TokenLeftParen {
+		// anonymous async function expression statement, e.g. `async fun () { ... }();`
+		parsePrecedenceFromPrevious(PrecedenceAssignment)
+		consume(tokens.TokenSemicolon, "Expect ';' after expression.")
+		emitOpcode(bytecode.OpPop)
+		return
+	}
+
+	if !match(tokens.TokenFun) {
+		errorAtCurrent("Expect 'fun' after 'async'.")
+		return
+	}
+	global := parseVariable("Expect function name.")
+	name := gParser.previous
+	markInitialized()
+	declareType(&name, asyncFunction(FunctionTypeFunction, name.Lexeme()))
+	defineVariable(global)
+}
+
+func varDeclaration() {
+	if match(tokens.TokenLeftBracket) {
+		listPatternDeclaration()
+		return
+	}
+	if match(tokens.TokenLeftBrace) {
+		fieldPatternDeclaration()
+		return
+	}
+
+	global := parseVariable("Expect variable name.")
+	name := gParser.previous
+	declared := typeAnnotation()
+
+	if match(tokens.TokenEqual) {
+		expression()
+		checkAssignType(&name, declared)
+	} else {
+		emitOpcode(bytecode.OpNil)
+	}
+	consume(tokens.TokenSemicolon, "Expect ';' after variable declaration.")
+
+	declareType(&name, declared)
+	defineVariable(global)
+}
+
+// constDeclaration parses `const NAME = value;`, the constant local is marked in the compiler,
+// the global one is defined by OpDefineConst.
+func constDeclaration() {
+	global := parseVariable("Expect constant name.")
+	name := gParser.previous
+	declared := typeAnnotation()
+
+	consume(tokens.TokenEqual, "Expect '=' after constant name.")
+	expression()
+	if declared.isAny() {
+		// the constant keeps the type of its value
+		declared = exprType(0).t
+	} else {
+		checkAssignType(&name, declared)
+	}
+	consume(tokens.TokenSemicolon, "Expect ';' after constant declaration.")
+	declareType(&name, declared)
+
+	if gCurrent.ScoreDepth > 0 {
+		markInitialized()
+		gCurrent.Locals[gCurrent.LocalCount-1].IsConst = true
+		return
+	}
+	gConstGlobals[name.LexemeAsString()] = true
+	emitOpByte(bytecode.OpDefineConst, byte(global))
+}
+
+// patternNames parses the variable names of the flat destructuring pattern up to the closing token,
+// the opening token is already consumed. Only the list pattern has the trailing `...rest` name.
+func patternNames(closing tokens.TokenType, message string) (names []scanner.Token, rest bool) {
+	for {
+		rest = closing == tokens.TokenRightBracket && match(tokens.TokenEllipsis)
+		consume(tokens.TokenIdentifier, "Expect variable name.")
+		for i := range names {
+			if identifierEquals(&gParser.previous, &names[i]) {
+				errorAtPrev("Already a variable with this name in this pattern.")
+			}
+		}
+		names = append(names, gParser.previous)
+		if len(names) > MaxArity {
+			errorAtPrev("Can't have more than 255 variables in a pattern.")
+		}
+		if rest || !match(tokens.TokenComma) {
+			break
+		}
+	}
+	consume(closing, message)
+	return names, rest
+}
+
+// patternInitializer parses the value being destructured.
+func patternInitializer() {
+	consume(tokens.TokenEqual, "Expect '=' after destructuring pattern.")
+	expression()
+	consume(tokens.TokenSemicolon, "Expect ';' after variable declaration.")
+}
+
+// listPatternDeclaration parses `var [a, b, ...rest] = list;`, the list items are unpacked
+// onto the stack, where they become the locals or get defined as globals.
+func listPatternDeclaration() {
+	names, rest := patternNames(tokens.TokenRightBracket, "Expect ']' after destructuring pattern.")
+	patternInitializer()
+
+	emitUnpackList(names, rest)
+
+	if gCurrent.ScoreDepth > 0 {
+		for i := range names {
+			declareLocal(&names[i])
+			markInitialized()
+		}
+		return
+	}
+	for i := len(names) - 1; i >= 0; i-- {
+		emitOpByte(bytecode.OpDefineGlobal, byte(identifierConstant(&names[i])))
+	}
+}
+
+// emitUnpackList emits the list unpacking into the pattern variables, the rest variable is the last one.
+func emitUnpackList(names []scanner.Token, rest bool) {
+	if rest {
+		emitOpByte(bytecode.OpUnpackList, byte(len(names)-1))
+		emitByte(1)
+	} else {
+		emitOpByte(bytecode.OpUnpackList, byte(len(names)))
+		emitByte(0)
+	}
+	// the list is replaced with its items
+	gCurrent.StackHeight += len(names) - 1
+}
+
+// fieldPatternDeclaration parses `var {x, y} = value;`, the variables are read from the instance
+// properties or from the map string keys of the same name.
+func fieldPatternDeclaration() {
+	names, _ := patternNames(tokens.TokenRightBrace, "Expect '}' after destructuring pattern.")
+	patternInitializer()
+
+	if gCurrent.ScoreDepth > 0 {
+		// the value is kept in the hidden local below the variables
+		addLocal(syntheticToken(" destructured"))
+		markInitialized()
+		slot := byte(gCurrent.LocalCount - 1)
+		for i := range names {
+			emitOpByte(bytecode.OpGetLocal, slot)
+			emitOpByte(bytecode.OpUnpackField, byte(identifierConstant(&names[i])))
+			declareLocal(&names[i])
+			markInitialized()
+		}
+		return
+	}
+	for i := range names {
+		name := byte(identifierConstant(&names[i]))
+		emitOpcode(bytecode.OpDup)
+		emitOpByte(bytecode.OpUnpackField, name)
+		emitOpByte(bytecode.OpDefineGlobal, name)
+	}
+	emitOpcode(bytecode.OpPop)
+}
+
+func printStatement() {
+	expression()
+	consume(tokens.TokenSemicolon, "Expect ';' after value.")
+	emitOpcode(bytecode.OpPrint)
+}
+
+func returnStatement() {
 	if gCurrent.FnType == FunctionTypeScript {
 		errorAtPrev("Can't return from top-level code.")
 	}
@@ -374,11 +1177,16 @@ func returnStatement() {
 	if match(tokens.TokenSemicolon) {
 		emitReturn()
 	} else {
-		if gCurrent.FnType == FunctionTypeInitializer {
+		switch gCurrent.FnType {
+		case FunctionTypeInitializer:
 			errorAtPrev("Can't return a value from an initializer.")
+		case FunctionTypeSetter:
+			errorAtPrev("Can't return a value from a setter.")
+		default: // any value
 		}
 
 		expression()
+		checkReturnType()
 		consume(tokens.TokenSemicolon, "Expect ';' after return value.")
 		emitOpcode(bytecode.OpReturn)
 	}
@@ -392,10 +1200,15 @@ func synchronize() {
 			return
 		}
 
+		promoteDeclarationKeyword()
 		switch gParser.current.Type {
 		case tokens.TokenClass:
+		case tokens.TokenAbstract:
+		case tokens.TokenTrait:
+		case tokens.TokenEnum:
 		case tokens.TokenFun:
 		case tokens.TokenVar:
+		case tokens.TokenConst:
 		case tokens.TokenFor:
 		case tokens.TokenIf:
 		case tokens.TokenWhile:
@@ -410,13 +1223,34 @@ func synchronize() {
 }
 
 func declaration() {
+	// the expression types are needed within the statement only
+	base := len(gTypes)
+	defer func() { gTypes = gTypes[:base] }()
+	// only the locals are on the stack between the statements
+	gCurrent.StackHeight = gCurrent.LocalCount
+
+	promoteDeclarationKeyword()
 	switch {
 	case match(tokens.TokenClass):
-		classDeclaration()
+		classDeclaration(false)
+	case match(tokens.TokenAbstract):
+		if match(tokens.TokenClass) {
+			classDeclaration(true)
+		} else {
+			errorAtCurrent("Expect 'class' after 'abstract'.")
+		}
+	case match(tokens.TokenTrait):
+		traitDeclaration()
+	case match(tokens.TokenEnum):
+		enumDeclaration()
 	case match(tokens.TokenFun):
 		funDeclaration()
+	case match(tokens.TokenAsync):
+		asyncFunDeclaration()
 	case match(tokens.TokenVar):
 		varDeclaration()
+	case match(tokens.TokenConst):
+		constDeclaration()
 	default:
 		statement()
 	}
@@ -427,6 +1261,7 @@ func declaration() {
 }
 
 func statement() {
+	gCurrent.StackHeight = gCurrent.LocalCount
 	switch {
 	case match(tokens.TokenPrint):
 		printStatement()
@@ -436,6 +1271,9 @@ func statement() {
 		ifStatement()
 	case match(tokens.TokenWhile):
 		whileStatement()
+	case isMatchAhead():
+		advance()
+		matchStatement()
 	case match(tokens.TokenReturn):
 		returnStatement()
 	case match(tokens.TokenLeftBrace):
@@ -507,6 +1345,11 @@ func forStatement() {
 
 	consume(tokens.TokenLeftParen, "Expect '(' after 'for'.")
 
+	if checkForIn() {
+		forInStatement()
+		return
+	}
+
 	if match(tokens.TokenSemicolon) {
 		// No initializer.
 	} else if match(tokens.TokenVar) {
@@ -547,12 +1390,452 @@ func forStatement() {
 	}
 }
 
+// checkForIn reports whether the loop is `for (var x in iterable)`, `in` is contextual keyword.
+func checkForIn() bool {
+	if !check(tokens.TokenVar) {
+		return false
+	}
+	lookahead := gScanner
+	if lookahead.ScanToken().Type != tokens.TokenIdentifier {
+		return false
+	}
+	next := lookahead.ScanToken()
+	if next.Type == tokens.TokenColon {
+		// skip the loop variable type annotation `var x: Type in`
+		lookahead.ScanToken()
+		next = lookahead.ScanToken()
+	}
+	return next.Type == tokens.TokenIdentifier && next.LexemeAsString() == "in"
+}
+
+// forInStatement compiles the loop driven by the iterator protocol, the iterator
+// is kept in the hidden local and the loop variable is fresh for every iteration.
+func forInStatement() {
+	consume(tokens.TokenVar, "Expect 'var' in for-in loop.")
+	consume(tokens.TokenIdentifier, "Expect variable name.")
+	name := gParser.previous
+	itemType := typeAnnotation()
+	consume(tokens.TokenIdentifier, "Expect 'in' after loop variable.")
+
+	expression()
+	consume(tokens.TokenRightParen, "Expect ')' after for-in clauses.")
+	emitOpcode(bytecode.OpIterator)
+	addLocal(syntheticToken(" iterator"))
+	markInitialized()
+	iteratorSlot := byte(gCurrent.LocalCount - 1)
+	hasNextName, nextName := syntheticToken("hasNext"), syntheticToken("next")
+	hasNext := identifierConstant(&hasNextName)
+	next := identifierConstant(&nextName)
+
+	loopStart := currentChunk().Count
+	emitOpByte(bytecode.OpGetLocal, iteratorSlot)
+	emitInvoke(bytecode.OpInvoke, byte(hasNext), 0)
+	exitJump := emitJump(bytecode.OpJumpIfFalse)
+	emitOpcode(bytecode.OpPop) // Condition.
+
+	beginScope()
+	emitOpByte(bytecode.OpGetLocal, iteratorSlot)
+	emitInvoke(bytecode.OpInvoke, byte(next), 0)
+	addLocal(name)
+	markInitialized()
+	declareType(&name, itemType)
+	statement()
+	endScope()
+	emitLoop(loopStart)
+
+	patchJump(exitJump)
+	emitOpcode(bytecode.OpPop) // Condition.
+}
+
+// matchStep is the step of the path from the matched value to the nested value, it reads
+// the field (OpUnpackField), the list item (OpGetIndex) or the rest of the list (OpListRest).
+type matchStep struct {
+	op  bytecode.OpCode
+	arg int
+}
+
+type matchPath []matchStep
+
+func (path matchPath) with(op bytecode.OpCode, arg int) matchPath {
+	return append(slices.Clip(path), matchStep{op: op, arg: arg})
+}
+
+type matchBinding struct {
+	name scanner.Token
+	path matchPath
+}
+
+// matchAlternative collects the failed test jumps and the variables of the case pattern.
+type matchAlternative struct {
+	subject   byte
+	failJumps []int
+	bindings  []matchBinding
+}
+
+// matchStatement compiles `match (value) { case pattern, pattern if guard => statement ... }`.
+// The value is kept in the hidden local, every pattern compiles to the sequence of tests which jump
+// to the next pattern once failed. The variables are bound after the tests have passed, so the guard
+// and the statement see them.
+func matchStatement() {
+	_, endJumps := matchCases(func(byte) { statement() })
+	for _, jump := range endJumps {
+		patchJump(jump)
+	}
+	endScope()
+}
+
+// matchExpression compiles `match (value) { case pattern => expression ... }`, which evaluates
+// to the expression of the matched case, or nil if no case matches. The hidden local of the value
+// is above the temporaries of the enclosing expression, the case result replaces it.
+func matchExpression(ParsePrecedence) {
+	if gCurrent.StackHeight < 0 {
+		errorAtPrev("Can't use match expression in a default parameter value.")
+	}
+	subject, endJumps := matchCases(func(subject byte) {
+		expression()
+		consume(tokens.TokenSemicolon, "Expect ';' after case value.")
+		emitOpByte(bytecode.OpSetLocal, subject)
+		emitOpcode(bytecode.OpPop)
+	})
+	// no case has matched
+	emitOpcode(bytecode.OpNil)
+	emitOpByte(bytecode.OpSetLocal, subject)
+	emitOpcode(bytecode.OpPop)
+	for _, jump := range endJumps {
+		patchJump(jump)
+	}
+
+	// the result is left on the stack in place of the value
+	gCurrent.ScoreDepth--
+	gCurrent.LocalCount--
+}
+
+// matchCases compiles the match value and the cases, the case body is compiled by the given function.
+// The returned jumps leave the match once the case body has run, the scope of the hidden local
+// of the value is ended by the caller.
+func matchCases(body func(subject byte)) (subject byte, endJumps []int) {
+	consume(tokens.TokenLeftParen, "Expect '(' after 'match'.")
+	expression()
+	consume(tokens.TokenRightParen, "Expect ')' after match value.")
+	consume(tokens.TokenLeftBrace, "Expect '{' before match cases.")
+
+	beginScope()
+	addLocal(syntheticToken(" match"))
+	markInitialized()
+	subject = markStackSlot()
+
+	// the literals matched by the previous cases, and whether the previous case matches anything
+	literals := map[string]bool{}
+	exhausted := false
+	for matchContextualKeyword("case") {
+		endJump, catchAll := caseClause(subject, literals, exhausted, body)
+		endJumps = append(endJumps, endJump)
+		exhausted = exhausted || catchAll
+	}
+	consume(tokens.TokenRightBrace, "Expect '}' after match cases.")
+	return subject, endJumps
+}
+
+// caseClause compiles the case, the returned jump leaves the match once the case body has run.
+// The case catches all values if it has the pattern without tests and has no guard.
+func caseClause(subject byte, literals map[string]bool, exhausted bool, body func(subject byte)) (endJump int, catchAll bool) {
+	caseToken := gParser.previous
+	var alternative *matchAlternative
+	var matchedJumps []int
+	var caseLiterals []string
+	var bound *scanner.Token
+	seen := true
+	for {
+		literal := patternLiteral()
+		alternative = &matchAlternative{subject: subject}
+		pattern(alternative, nil)
+
+		seen = seen && literal != "" && literals[literal]
+		caseLiterals = append(caseLiterals, literal)
+		catchAll = catchAll || len(alternative.failJumps) == 0
+		if bound == nil && len(alternative.bindings) > 0 {
+			bound = &alternative.bindings[0].name
+		}
+		if !match(tokens.TokenComma) {
+			break
+		}
+		// the alternative has matched, skip the rest
+		matchedJumps = append(matchedJumps, emitJump(bytecode.OpJump))
+		patchFailJumps(alternative)
+	}
+	if bound != nil && len(caseLiterals) > 1 {
+		errorAt(bound, "Can't bind variables in alternative patterns.")
+	}
+	if exhausted || seen {
+		warningAt(&caseToken, "Unreachable case.")
+	}
+
+	for _, jump := range matchedJumps {
+		patchJump(jump)
+	}
+	beginScope()
+	for i := range alternative.bindings {
+		binding := &alternative.bindings[i]
+		emitMatchPath(subject, binding.path)
+		declareLocal(&binding.name)
+		markInitialized()
+		markStackSlot()
+	}
+
+	guardJump := -1
+	if match(tokens.TokenIf) {
+		expression()
+		guardJump = emitJump(bytecode.OpJumpIfFalse)
+		emitOpcode(bytecode.OpPop)
+		catchAll = false
+	} else {
+		for _, literal := range caseLiterals {
+			literals[literal] = literal != ""
+		}
+	}
+	consume(tokens.TokenArrow, "Expect '=>' after case pattern.")
+	body(subject)
+
+	bindings := gCurrent.Locals[gCurrent.LocalCount-len(alternative.bindings) : gCurrent.LocalCount]
+	captured := make([]bool, len(bindings))
+	for i := range bindings {
+		captured[i] = bindings[i].IsCaptured
+	}
+	endScope()
+	endJump = emitJump(bytecode.OpJump)
+
+	if guardJump != -1 {
+		// the guard has failed, the variables are dropped before the next case
+		patchJump(guardJump)
+		gCurrent.StackHeight += len(captured) + 1
+		emitOpcode(bytecode.OpPop)
+		for i := len(captured) - 1; i >= 0; i-- {
+			if captured[i] {
+				emitOpcode(bytecode.OpCloseUpvalue)
+			} else {
+				emitOpcode(bytecode.OpPop)
+			}
+		}
+		nextJump := emitJump(bytecode.OpJump)
+		patchFailJumps(alternative)
+		patchJump(nextJump)
+	} else {
+		patchFailJumps(alternative)
+	}
+	return endJump, catchAll
+}
+
+// patchFailJumps lands the failed tests of the pattern, the test result is popped.
+func patchFailJumps(alternative *matchAlternative) {
+	if len(alternative.failJumps) == 0 {
+		return
+	}
+	for _, jump := range alternative.failJumps {
+		patchJump(jump)
+	}
+	// the failed test result is on the stack
+	gCurrent.StackHeight++
+	emitOpcode(bytecode.OpPop)
+}
+
+// patternLiteral returns the key of the literal pattern, which is the whole alternative, or "" otherwise.
+func patternLiteral() string {
+	switch gParser.current.Type {
+	case tokens.TokenNumber, tokens.TokenInteger, tokens.TokenBigInt, tokens.TokenDecimal,
+		tokens.TokenString, tokens.TokenTrue, tokens.TokenFalse, tokens.TokenNil:
+	default:
+		return ""
+	}
+	lookahead := gScanner
+	switch lookahead.ScanToken().Type {
+	case tokens.TokenComma, tokens.TokenIf, tokens.TokenArrow:
+		return fmt.Sprintf("%d %s", gParser.current.Type, gParser.current.Lexeme())
+	default:
+		return ""
+	}
+}
+
+// pattern compiles the tests of the pattern against the value at the path: literal `1`,
+// value `Color.Red`, class `Point(x, y: 0)`, list `[a, _, ...rest]`, wildcard `_` or variable `x`.
+func pattern(alternative *matchAlternative, path matchPath) {
+	switch gParser.current.Type {
+	case tokens.TokenNumber, tokens.TokenInteger, tokens.TokenBigInt, tokens.TokenDecimal,
+		tokens.TokenString, tokens.TokenTrue, tokens.TokenFalse, tokens.TokenNil, tokens.TokenMinus:
+		emitMatchPath(alternative.subject, path)
+		parsePrecedence(PrecedenceUnary)
+		emitOpcode(bytecode.OpEqual)
+		emitMatchTest(alternative)
+	case tokens.TokenLeftBracket:
+		advance()
+		listPattern(alternative, path)
+	case tokens.TokenIdentifier:
+		advance()
+		name := gParser.previous
+		switch {
+		case check(tokens.TokenLeftParen):
+			classPattern(alternative, path, name)
+		case check(tokens.TokenDot):
+			emitMatchPath(alternative.subject, path)
+			readVariable(name)
+			for match(tokens.TokenDot) {
+				consume(tokens.TokenIdentifier, "Expect property name after '.'.")
+				emitOpByte(bytecode.OpGetProperty, byte(identifierConstant(&gParser.previous)))
+			}
+			emitOpcode(bytecode.OpEqual)
+			emitMatchTest(alternative)
+		case name.LexemeAsString() == "_":
+			// wildcard
+		default:
+			bindPattern(alternative, path, name)
+		}
+	default:
+		errorAtCurrent("Expect pattern.")
+	}
+}
+
+// classPattern tests the value is the instance of the class, then the field patterns.
+// The field without the pattern binds the variable of the same name.
+func classPattern(alternative *matchAlternative, path matchPath, class scanner.Token) {
+	emitMatchPath(alternative.subject, path)
+	readVariable(class)
+	emitOpcode(bytecode.OpIs)
+	emitMatchTest(alternative)
+
+	consume(tokens.TokenLeftParen, "Expect '(' after class name.")
+	if !check(tokens.TokenRightParen) {
+		for {
+			consume(tokens.TokenIdentifier, "Expect field name.")
+			field := gParser.previous
+			fieldPath := path.with(bytecode.OpUnpackField, identifierConstant(&field))
+			if match(tokens.TokenColon) {
+				pattern(alternative, fieldPath)
+			} else {
+				bindPattern(alternative, fieldPath, field)
+			}
+			if !match(tokens.TokenComma) {
+				break
+			}
+		}
+	}
+	consume(tokens.TokenRightParen, "Expect ')' after class pattern fields.")
+}
+
+// listPattern tests the value is the list of the pattern length, then the item patterns.
+func listPattern(alternative *matchAlternative, path matchPath) {
+	emitMatchPath(alternative.subject, path)
+	// the item count is known once the items are parsed
+	emitOpByte(bytecode.OpMatchList, 0)
+	emitByte(0)
+	shape := currentChunk().Count - 2
+	emitMatchTest(alternative)
+
+	count, rest := 0, false
+	for !check(tokens.TokenRightBracket) && !rest {
+		if match(tokens.TokenEllipsis) {
+			consume(tokens.TokenIdentifier, "Expect variable name after '...'.")
+			if name := gParser.previous; name.LexemeAsString() != "_" {
+				bindPattern(alternative, path.with(bytecode.OpListRest, count), name)
+			}
+			rest = true
+		} else {
+			pattern(alternative, path.with(bytecode.OpGetIndex, count))
+			count++
+			if count > MaxArity {
+				errorAtPrev("Can't have more than 255 items in a list pattern.")
+			}
+		}
+		if !match(tokens.TokenComma) {
+			break
+		}
+	}
+	consume(tokens.TokenRightBracket, "Expect ']' after list pattern.")
+
+	currentChunk().Code[shape] = byte(count)
+	if rest {
+		currentChunk().Code[shape+1] = 1
+	}
+}
+
+// markStackSlot places the last declared local on the top of the stack, as the locals declared
+// within the expression are above the temporaries, and returns the slot.
+func markStackSlot() byte {
+	slot := gCurrent.StackHeight - 1
+	if slot >= MaxLocalCount {
+		errorAtPrev("Too many local variables in function.")
+		return 0
+	}
+	gCurrent.Locals[gCurrent.LocalCount-1].Slot = slot
+	return byte(slot)
+}
+
+func bindPattern(alternative *matchAlternative, path matchPath, name scanner.Token) {
+	for i := range alternative.bindings {
+		if identifierEquals(&name, &alternative.bindings[i].name) {
+			errorAt(&name, "Already a variable with this name in this pattern.")
+		}
+	}
+	alternative.bindings = append(alternative.bindings, matchBinding{name: name, path: path})
+}
+
+// emitMatchPath loads the value at the path from the matched value.
+func emitMatchPath(subject byte, path matchPath) {
+	emitOpByte(bytecode.OpGetLocal, subject)
+	for _, step := range path {
+		if step.op == bytecode.OpGetIndex {
+			emitConstant(vmvalue.IntAsValue(int64(step.arg)))
+			emitOpcode(bytecode.OpGetIndex)
+		} else {
+			emitOpByte(step.op, byte(step.arg))
+		}
+	}
+}
+
+// emitMatchTest jumps to the next pattern if the test has failed.
+func emitMatchTest(alternative *matchAlternative) {
+	alternative.failJumps = append(alternative.failJumps, emitJump(bytecode.OpJumpIfFalse))
+	emitOpcode(bytecode.OpPop)
+}
+
 func number(ParsePrecedence) {
 	v, err := strconv.ParseFloat(gParser.previous.LexemeAsString(), 64)
 	if err != nil {
 		errorAtPrev(err.Error())
 	}
 	emitConstant(vmvalue.NumberAsValue(v))
+	setExprType(typeFloat)
+}
+
+func integer(precedence ParsePrecedence) {
+	v, err := strconv.ParseInt(gParser.previous.LexemeAsString(), 10, 64)
+	if err != nil {
+		// does not fit in int64, use float instead
+		number(precedence)
+		return
+	}
+	emitConstant(vmvalue.IntAsValue(v))
+	setExprType(typeNumber)
+}
+
+func bigInt(ParsePrecedence) {
+	lexeme := gParser.previous.LexemeAsString()
+	v, ok := new(big.Int).SetString(strings.TrimSuffix(lexeme, "n"), 10)
+	if !ok {
+		errorAtPrev("Invalid big integer literal.")
+		return
+	}
+	emitConstant(vmvalue.ObjAsValue(vmvalue.NewBigInt(v)))
+	setExprType(typeBigInt)
+}
+
+func decimal(ParsePrecedence) {
+	lexeme := gParser.previous.LexemeAsString()
+	unscaled, scale, ok := vmvalue.ParseDecimal(strings.TrimSuffix(lexeme, "d"))
+	if !ok {
+		errorAtPrev("Invalid decimal literal.")
+		return
+	}
+	emitConstant(vmvalue.ObjAsValue(vmvalue.NewDecimal(unscaled, scale)))
+	setExprType(typeDecimal)
 }
 
 func string_(ParsePrecedence) {
@@ -560,32 +1843,85 @@ func string_(ParsePrecedence) {
 	chars := t.Source[t.Start+1 : t.Start+t.Length-1]
 	str := vmvalue.StringInternCopy(chars)
 	emitConstant(vmvalue.ObjAsValue(str))
+	setExprType(typeString)
 }
 
-func namedVariable(name scanner.Token, canAssign bool) {
-	var getOp, setOp bytecode.OpCode
-
-	arg, ok := resolveLocal(gCurrent, &name)
+func resolveVariable(name *scanner.Token) (getOp, setOp bytecode.OpCode, arg int) {
+	arg, ok := resolveLocal(gCurrent, name)
 	if ok {
-		getOp = bytecode.OpGetLocal
-		setOp = bytecode.OpSetLocal
-	} else if arg, ok = resolveUpvalue(gCurrent, &name); ok {
-		getOp = bytecode.OpGetUpvalue
-		setOp = bytecode.OpSetUpvalue
-	} else {
-		arg = identifierConstant(&name)
-		getOp = bytecode.OpGetGlobal
-		setOp = bytecode.OpSetGlobal
+		return bytecode.OpGetLocal, bytecode.OpSetLocal, gCurrent.Locals[arg].Slot
+	} else if arg, ok = resolveUpvalue(gCurrent, name); ok {
+		return bytecode.OpGetUpvalue, bytecode.OpSetUpvalue, arg
 	}
+	arg = identifierConstant(name)
+	return bytecode.OpGetGlobal, bytecode.OpSetGlobal, arg
+}
+
+func namedVariable(name scanner.Token, canAssign bool) {
+	getOp, setOp, arg := resolveVariable(&name)
 
 	if canAssign && match(tokens.TokenEqual) {
+		checkAssignable(&name)
+		expression()
+		checkAssignType(&name, variableType(&name))
+		setExprType(exprType(0).t)
+		emitOpByte(setOp, byte(arg))
+	} else if op := canAssignCompound(canAssign); op != 0 {
+		checkAssignable(&name)
+		emitOpByte(getOp, byte(arg))
 		expression()
+		emitOpcode(op)
+		emitOpByte(setOp, byte(arg))
+	} else if op := takePrefixIncrement(); op != 0 {
+		checkAssignable(&name)
+		emitOpByte(getOp, byte(arg))
+		emitOpcode(op)
 		emitOpByte(setOp, byte(arg))
+	} else if op := matchIncrement(); op != 0 {
+		checkAssignable(&name)
+		// leave the old value on the stack
+		emitOpByte(getOp, byte(arg))
+		emitOpcodes(bytecode.OpDup, op)
+		emitOpByte(setOp, byte(arg))
+		emitOpcode(bytecode.OpPop)
 	} else {
 		emitOpByte(getOp, byte(arg))
+		setExprType(variableType(&name))
 	}
 }
 
+// checkAssignable reports the assignment of the constant, which is the local or the upvalue
+// declared with `const`, or the global constant declared earlier in the compiled source.
+// The global constants declared elsewhere are checked at runtime.
+func checkAssignable(name *scanner.Token) {
+	for compiler := gCurrent; compiler != nil; compiler = compiler.Enclosing {
+		for i := compiler.LocalCount - 1; i >= 0; i-- {
+			if local := &compiler.Locals[i]; identifierEquals(name, &local.Name) {
+				if local.IsConst {
+					errorAt(name, "Can't assign to constant variable.")
+				}
+				return
+			}
+		}
+	}
+	if gConstGlobals[name.LexemeAsString()] {
+		errorAt(name, "Can't assign to constant variable.")
+	}
+}
+
+// readVariable emits the variable read only, without looking for assignment or increment.
+func readVariable(name scanner.Token) {
+	getOp, _, arg := resolveVariable(&name)
+	emitOpByte(getOp, byte(arg))
+}
+
+func canAssignCompound(canAssign bool) bytecode.OpCode {
+	if !canAssign {
+		return 0
+	}
+	return matchCompoundAssign()
+}
+
 func variable(precedence ParsePrecedence) {
 	variable_(precedence.CanAssign())
 }
@@ -607,12 +1943,14 @@ func this(ParsePrecedence) {
 		errorAtPrev("Can't use 'this' outside of a class.")
 		return
 	}
-	variable_(false)
+	readVariable(gParser.previous)
 }
 
 func super(ParsePrecedence) {
 	if gCurrentClass == nil {
 		errorAtPrev("Can't use 'super' outside of a class.")
+	} else if gCurrentClass.IsTrait {
+		errorAtPrev("Can't use 'super' in a trait.")
 	} else if !gCurrentClass.HasSuperclass {
 		errorAtPrev("Can't use 'super' in a class with no superclass.")
 	}
@@ -621,31 +1959,39 @@ func super(ParsePrecedence) {
 	consume(tokens.TokenIdentifier, "Expect superclass method name.")
 	name := identifierConstant(&gParser.previous)
 
-	namedVariable(syntheticToken("this"), false)
+	readVariable(syntheticToken("this"))
 	if match(tokens.TokenLeftParen) {
 		argCount := argumentList()
-		namedVariable(syntheticToken("super"), false)
-		emitOpByte(bytecode.OpSuperInvoke, byte(name))
-		emitByte(argCount)
+		readVariable(syntheticToken("super"))
+		emitInvoke(bytecode.OpSuperInvoke, byte(name), argCount)
 	} else {
-		namedVariable(syntheticToken("super"), false)
+		readVariable(syntheticToken("super"))
 		emitOpByte(bytecode.OpGetSuper, byte(name))
 	}
 }
 
 func grouping(ParsePrecedence) {
+	if isArrowFunctionAhead() {
+		setExprType(arrowFunction())
+		return
+	}
+
 	expression()
 	consume(tokens.TokenRightParen, "Expect ')' after expression.")
+	setExprType(exprType(0).t)
 }
 
 func literal(ParsePrecedence) {
 	switch literalType := gParser.previous.Type; literalType {
 	case tokens.TokenFalse:
 		emitOpcode(bytecode.OpFalse)
+		setExprType(typeBool)
 	case tokens.TokenNil:
 		emitOpcode(bytecode.OpNil)
+		setExprType(typeNil)
 	case tokens.TokenTrue:
 		emitOpcode(bytecode.OpTrue)
+		setExprType(typeBool)
 	default:
 		panic(fmt.Sprintf("unexpected literal type: %s (%d)", literalType, literalType))
 	}
@@ -655,7 +2001,8 @@ func binary(ParsePrecedence) {
 	// the 1st (left) operand has been already parsed and consumed by this point
 
 	// operator type
-	operatorType := gParser.previous.Type
+	operator := gParser.previous
+	operatorType := operator.Type
 	// rule for the operator
 	rule := mustGetRule(operatorType)
 	// parse the second (right) operand
@@ -682,14 +2029,32 @@ func binary(ParsePrecedence) {
 		emitOpcode(bytecode.OpMultiply)
 	case tokens.TokenSlash:
 		emitOpcode(bytecode.OpDivide)
+	case tokens.TokenPercent:
+		emitOpcode(bytecode.OpModulo)
+	case tokens.TokenAmpersand:
+		emitOpcode(bytecode.OpBitAnd)
+	case tokens.TokenPipe:
+		emitOpcode(bytecode.OpBitOr)
+	case tokens.TokenCaret:
+		emitOpcode(bytecode.OpBitXor)
+	case tokens.TokenLessLess:
+		emitOpcode(bytecode.OpShiftLeft)
+	case tokens.TokenGreaterGreater:
+		emitOpcode(bytecode.OpShiftRight)
+	case tokens.TokenIs:
+		emitOpcode(bytecode.OpIs)
 	default:
 		panic(fmt.Sprintf("unreachable operator: %s (%d)", operatorType, operatorType))
 	}
+	setExprType(binaryType(&operator, exprType(1).t, exprType(0).t))
 }
 
 func call(ParsePrecedence) {
+	callee := exprType(0)
+	base := len(gTypes)
 	argCount := argumentList()
 	emitOpByte(bytecode.OpCall, argCount)
+	setExprType(checkCall(callee, gTypes[base:]))
 }
 
 func argumentList() byte {
@@ -711,24 +2076,209 @@ func argumentList() byte {
 }
 
 func dot(precedence ParsePrecedence) {
-	consume(tokens.TokenIdentifier, "Expect property name after '.'.")
-	name := identifierConstant(&gParser.previous)
+	name := propertyConstant("Expect property name after '.'.")
 
 	if precedence.CanAssign() && match(tokens.TokenEqual) {
 		expression()
 		emitOpByte(bytecode.OpSetProperty, byte(name))
+	} else if op := canAssignCompound(precedence.CanAssign()); op != 0 {
+		// the receiver is evaluated once: obj -> obj obj -> obj value
+		emitOpcode(bytecode.OpDup)
+		emitOpByte(bytecode.OpGetProperty, byte(name))
+		expression()
+		emitOpcode(op)
+		emitOpByte(bytecode.OpSetProperty, byte(name))
 	} else if match(tokens.TokenLeftParen) {
 		argCount := argumentList()
-		emitOpByte(bytecode.OpInvoke, byte(name))
-		emitByte(argCount)
+		emitInvoke(bytecode.OpInvoke, byte(name), argCount)
+	} else if op := canIncrementPrefix(precedence.CanIncrement()); op != 0 {
+		emitOpcode(bytecode.OpDup)
+		emitOpByte(bytecode.OpGetProperty, byte(name))
+		emitOpcode(op)
+		emitOpByte(bytecode.OpSetProperty, byte(name))
+	} else if op := canIncrementPostfix(precedence.CanIncrement()); op != 0 {
+		// obj old -> old obj old -> old obj new -> old
+		emitOpcode(bytecode.OpDup)
+		emitOpByte(bytecode.OpGetProperty, byte(name))
+		emitOpcodes(bytecode.OpDupUnder, op)
+		emitOpByte(bytecode.OpSetProperty, byte(name))
+		emitOpcode(bytecode.OpPop)
 	} else {
 		emitOpByte(bytecode.OpGetProperty, byte(name))
 	}
 }
 
+// list parses list literal `[a, b]`, or map literal `[k: v]` (`[:]` is an empty map),
+// or the destructuring assignment `[a, b] = [b, a]`.
+func list(precedence ParsePrecedence) {
+	if precedence.CanAssign() && isListPatternAhead() {
+		listPatternAssignment()
+		return
+	}
+
+	if match(tokens.TokenColon) {
+		consume(tokens.TokenRightBracket, "Expect ']' after ':' in empty map literal.")
+		emitOpByte(bytecode.OpMap, 0)
+		setExprType(typeMap)
+		return
+	}
+
+	if check(tokens.TokenRightBracket) {
+		advance()
+		emitOpByte(bytecode.OpList, 0)
+		setExprType(typeList)
+		return
+	}
+
+	expression()
+	if match(tokens.TokenColon) {
+		mapEntries()
+		setExprType(typeMap)
+	} else {
+		listItems()
+		setExprType(typeList)
+	}
+}
+
+// isListPatternAhead looks ahead (without consuming) if the '[' just consumed
+// starts the list pattern `[a, b, ...rest] =` of the destructuring assignment.
+func isListPatternAhead() bool {
+	lookahead := gScanner
+	token := gParser.current
+	for {
+		if token.Type == tokens.TokenEllipsis {
+			if lookahead.ScanToken().Type != tokens.TokenIdentifier {
+				return false
+			}
+			token = lookahead.ScanToken()
+			break
+		}
+		if token.Type != tokens.TokenIdentifier {
+			return false
+		}
+		if token = lookahead.ScanToken(); token.Type != tokens.TokenComma {
+			break
+		}
+		token = lookahead.ScanToken()
+	}
+	return token.Type == tokens.TokenRightBracket && lookahead.ScanToken().Type == tokens.TokenEqual
+}
+
+// listPatternAssignment assigns the unpacked list items to the variables, the assigned list
+// is the value of the expression.
+func listPatternAssignment() {
+	names, rest := patternNames(tokens.TokenRightBracket, "Expect ']' after destructuring pattern.")
+	consume(tokens.TokenEqual, "Expect '=' after destructuring pattern.")
+	expression()
+
+	emitOpcode(bytecode.OpDup)
+	emitUnpackList(names, rest)
+	for i := len(names) - 1; i >= 0; i-- {
+		checkAssignable(&names[i])
+		_, setOp, arg := resolveVariable(&names[i])
+		emitOpByte(setOp, byte(arg))
+		emitOpcode(bytecode.OpPop)
+	}
+}
+
+func listItems() {
+	itemCount := 1
+	for match(tokens.TokenComma) && !check(tokens.TokenRightBracket) {
+		expression()
+		itemCount++
+		if itemCount > MaxArity {
+			errorAtPrev("Can't have more than 255 elements in a list literal.")
+		}
+	}
+	consume(tokens.TokenRightBracket, "Expect ']' after list elements.")
+	emitOpByte(bytecode.OpList, byte(itemCount))
+}
+
+func mapEntries() {
+	// the 1st key and ':' has been already parsed and consumed by this point
+	entryCount := 1
+	expression()
+	for match(tokens.TokenComma) && !check(tokens.TokenRightBracket) {
+		expression()
+		consume(tokens.TokenColon, "Expect ':' after map key.")
+		expression()
+		entryCount++
+		if entryCount > MaxArity {
+			errorAtPrev("Can't have more than 255 entries in a map literal.")
+		}
+	}
+	consume(tokens.TokenRightBracket, "Expect ']' after map entries.")
+	emitOpByte(bytecode.OpMap, byte(entryCount))
+}
+
+func subscript(precedence ParsePrecedence) {
+	expression()
+	consume(tokens.TokenRightBracket, "Expect ']' after index.")
+
+	if precedence.CanAssign() && match(tokens.TokenEqual) {
+		expression()
+		emitOpcode(bytecode.OpSetIndex)
+	} else {
+		emitOpcode(bytecode.OpGetIndex)
+	}
+}
+
+// optionalDot parses `obj?.field` and `obj?.method()`.
+// If obj is nil, the rest of the call chain is skipped and the result is nil.
+func optionalDot(ParsePrecedence) {
+	endJump := emitJump(bytecode.OpJumpIfNil)
+	// the chain is neither the assignment nor the increment target
+	dot(PrecedencePrimary)
+
+	for PrecedenceCall <= mustGetRule(gParser.current.Type).precedence {
+		advance()
+		infixRule := mustGetRule(gParser.previous.Type).infixRule
+		infixRule(PrecedencePrimary)
+	}
+
+	patchJump(endJump)
+}
+
+// yield suspends the fiber, the function with `yield` is the generator.
+func yield(ParsePrecedence) {
+	switch gCurrent.FnType {
+	case FunctionTypeScript:
+		errorAtPrev("Can't yield from top-level code.")
+	case FunctionTypeInitializer:
+		errorAtPrev("Can't yield from an initializer.")
+	case FunctionTypeGetter, FunctionTypeSetter:
+		errorAtPrev("Can't yield from an accessor.")
+	default: // generator
+	}
+	if gCurrent.Function.Async {
+		errorAtPrev("Can't yield from an async function.")
+	}
+	gCurrent.Function.Generator = true
+
+	switch gParser.current.Type {
+	case tokens.TokenSemicolon, tokens.TokenRightParen, tokens.TokenRightBracket,
+		tokens.TokenRightBrace, tokens.TokenComma, tokens.TokenColon:
+		emitOpcode(bytecode.OpNil)
+	default:
+		parsePrecedence(PrecedenceAssignment)
+	}
+	emitOpcode(bytecode.OpYield)
+}
+
+// await suspends the async function until the awaited promise settles.
+func await(ParsePrecedence) {
+	if !gCurrent.Function.Async {
+		errorAtPrev("Can't await outside of an async function.")
+	}
+	parsePrecedence(PrecedenceUnary)
+	emitOpcode(bytecode.OpAwait)
+}
+
 func unary(ParsePrecedence) {
-	operatorType := gParser.previous.Type
+	operator := gParser.previous
+	operatorType := operator.Type
 	parsePrecedence(PrecedenceUnary)
+	setExprType(unaryType(&operator, exprType(0).t))
 
 	// emit the operator instruction
 	switch operatorType {
@@ -736,11 +2286,39 @@ func unary(ParsePrecedence) {
 		emitOpcode(bytecode.OpNot)
 	case tokens.TokenMinus:
 		emitOpcode(bytecode.OpNegate)
+	case tokens.TokenTilde:
+		emitOpcode(bytecode.OpBitNot)
 	default:
 		panic("Unreachable unary: " + gParser.previous.LexemeAsString())
 	}
 }
 
+// prefixIncrement parses `++x`/`--x`, the operand must be a variable or a property.
+func prefixIncrement(ParsePrecedence) {
+	op := incrementOps[gParser.previous.Type]
+	if op == bytecode.OpDecrement && !check(tokens.TokenIdentifier) && !check(tokens.TokenThis) {
+		// not a variable, `--(3)` is a double negation
+		parsePrecedence(PrecedenceUnary)
+		emitOpcodes(bytecode.OpNegate, bytecode.OpNegate)
+		return
+	}
+
+	gParser.prefixIncrement = op
+
+	advance()
+	parsePrecedenceFromPrevious(PrecedenceCall)
+
+	if gParser.prefixIncrement != 0 {
+		gParser.prefixIncrement = 0
+		errorAtPrev("Invalid increment target.")
+	}
+}
+
+// postfixIncrement is reached only if `++`/`--` follows something that is not a variable or a property.
+func postfixIncrement(ParsePrecedence) {
+	errorAtPrev("Invalid increment target.")
+}
+
 func mustGetRule(t tokens.TokenType) *ParseRule {
 	if r, ok := rules[t]; ok {
 		return r
@@ -778,6 +2356,14 @@ func errorAtPrev(message string) {
 	errorAt(&gParser.previous, message)
 }
 
+// warningAt reports the problem which doesn't fail the compilation.
+func warningAt(token *scanner.Token, message string) {
+	if gParser.panicMode {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "[line %d] Warning at '%s': %s\n", token.Line, token.LexemeAsString(), message)
+}
+
 func errorAt(token *scanner.Token, message string) {
 	if gParser.panicMode {
 		return
@@ -801,45 +2387,80 @@ var rules map[tokens.TokenType]*ParseRule
 
 func init() {
 	rules = map[tokens.TokenType]*ParseRule{
-		tokens.TokenLeftParen:    {grouping, call, PrecedenceCall},
-		tokens.TokenRightParen:   {nil, nil, PrecedenceNone},
-		tokens.TokenLeftBrace:    {nil, nil, PrecedenceNone},
-		tokens.TokenRightBrace:   {nil, nil, PrecedenceNone},
-		tokens.TokenComma:        {nil, nil, PrecedenceNone},
-		tokens.TokenDot:          {nil, dot, PrecedenceCall},
-		tokens.TokenMinus:        {unary, binary, PrecedenceTerm},
-		tokens.TokenPlus:         {nil, binary, PrecedenceTerm},
-		tokens.TokenSemicolon:    {nil, nil, PrecedenceNone},
-		tokens.TokenSlash:        {nil, binary, PrecedenceFactor},
-		tokens.TokenStar:         {nil, binary, PrecedenceFactor},
-		tokens.TokenBang:         {unary, nil, PrecedenceNone},
-		tokens.TokenBangEqual:    {nil, binary, PrecedenceEquality},
-		tokens.TokenEqual:        {nil, nil, PrecedenceNone},
-		tokens.TokenEqualEqual:   {nil, binary, PrecedenceEquality},
-		tokens.TokenGreater:      {nil, binary, PrecedenceComparison},
-		tokens.TokenGreaterEqual: {nil, binary, PrecedenceComparison},
-		tokens.TokenLess:         {nil, binary, PrecedenceComparison},
-		tokens.TokenLessEqual:    {nil, binary, PrecedenceComparison},
-		tokens.TokenIdentifier:   {variable, nil, PrecedenceNone},
-		tokens.TokenString:       {string_, nil, PrecedenceNone},
-		tokens.TokenNumber:       {number, nil, PrecedenceNone},
-		tokens.TokenAnd:          {nil, and_, PrecedenceAnd},
-		tokens.TokenClass:        {nil, nil, PrecedenceNone},
-		tokens.TokenElse:         {nil, nil, PrecedenceNone},
-		tokens.TokenFalse:        {literal, nil, PrecedenceNone},
-		tokens.TokenFor:          {nil, nil, PrecedenceNone},
-		tokens.TokenFun:          {nil, nil, PrecedenceNone},
-		tokens.TokenIf:           {nil, nil, PrecedenceNone},
-		tokens.TokenNil:          {literal, nil, PrecedenceNone},
-		tokens.TokenOr:           {nil, or_, PrecedenceOr},
-		tokens.TokenPrint:        {nil, nil, PrecedenceNone},
-		tokens.TokenReturn:       {nil, nil, PrecedenceNone},
-		tokens.TokenSuper:        {super, nil, PrecedenceNone},
-		tokens.TokenThis:         {this, nil, PrecedenceNone},
-		tokens.TokenTrue:         {literal, nil, PrecedenceNone},
-		tokens.TokenVar:          {nil, nil, PrecedenceNone},
-		tokens.TokenWhile:        {nil, nil, PrecedenceNone},
-		tokens.TokenError:        {nil, nil, PrecedenceNone},
-		tokens.TokenEOF:          {nil, nil, PrecedenceNone},
+		tokens.TokenLeftParen:         {grouping, call, PrecedenceCall},
+		tokens.TokenRightParen:        {nil, nil, PrecedenceNone},
+		tokens.TokenLeftBrace:         {nil, nil, PrecedenceNone},
+		tokens.TokenRightBrace:        {nil, nil, PrecedenceNone},
+		tokens.TokenLeftBracket:       {list, subscript, PrecedenceCall},
+		tokens.TokenRightBracket:      {nil, nil, PrecedenceNone},
+		tokens.TokenColon:             {nil, nil, PrecedenceNone},
+		tokens.TokenComma:             {nil, nil, PrecedenceNone},
+		tokens.TokenDot:               {nil, dot, PrecedenceCall},
+		tokens.TokenEllipsis:          {nil, nil, PrecedenceNone},
+		tokens.TokenMinus:             {unary, binary, PrecedenceTerm},
+		tokens.TokenPlus:              {nil, binary, PrecedenceTerm},
+		tokens.TokenSemicolon:         {nil, nil, PrecedenceNone},
+		tokens.TokenSlash:             {nil, binary, PrecedenceFactor},
+		tokens.TokenStar:              {nil, binary, PrecedenceFactor},
+		tokens.TokenPercent:           {nil, binary, PrecedenceFactor},
+		tokens.TokenAmpersand:         {nil, binary, PrecedenceBitAnd},
+		tokens.TokenPipe:              {nil, binary, PrecedenceBitOr},
+		tokens.TokenCaret:             {nil, binary, PrecedenceBitXor},
+		tokens.TokenTilde:             {unary, nil, PrecedenceNone},
+		tokens.TokenLessLess:          {nil, binary, PrecedenceShift},
+		tokens.TokenGreaterGreater:    {nil, binary, PrecedenceShift},
+		tokens.TokenPlusEqual:         {nil, nil, PrecedenceNone},
+		tokens.TokenMinusEqual:        {nil, nil, PrecedenceNone},
+		tokens.TokenStarEqual:         {nil, nil, PrecedenceNone},
+		tokens.TokenSlashEqual:        {nil, nil, PrecedenceNone},
+		tokens.TokenPercentEqual:      {nil, nil, PrecedenceNone},
+		tokens.TokenPlusPlus:          {prefixIncrement, postfixIncrement, PrecedenceCall},
+		tokens.TokenMinusMinus:        {prefixIncrement, postfixIncrement, PrecedenceCall},
+		tokens.TokenQuestion:          {nil, conditional, PrecedenceConditional},
+		tokens.TokenQuestionQuestion:  {nil, coalesce, PrecedenceCoalesce},
+		tokens.TokenQuestionDot:       {nil, optionalDot, PrecedenceCall},
+		tokens.TokenBang:              {unary, nil, PrecedenceNone},
+		tokens.TokenBangEqual:         {nil, binary, PrecedenceEquality},
+		tokens.TokenEqual:             {nil, nil, PrecedenceNone},
+		tokens.TokenArrow:             {nil, nil, PrecedenceNone},
+		tokens.TokenEqualEqual:        {nil, binary, PrecedenceEquality},
+		tokens.TokenGreater:           {nil, binary, PrecedenceComparison},
+		tokens.TokenGreaterEqual:      {nil, binary, PrecedenceComparison},
+		tokens.TokenLess:              {nil, binary, PrecedenceComparison},
+		tokens.TokenIs:                {nil, binary, PrecedenceComparison},
+		tokens.TokenLessEqual:         {nil, binary, PrecedenceComparison},
+		tokens.TokenIdentifier:        {variable, nil, PrecedenceNone},
+		tokens.TokenPrivateIdentifier: {nil, nil, PrecedenceNone},
+		tokens.TokenString:            {string_, nil, PrecedenceNone},
+		tokens.TokenNumber:            {number, nil, PrecedenceNone},
+		tokens.TokenInteger:           {integer, nil, PrecedenceNone},
+		tokens.TokenBigInt:            {bigInt, nil, PrecedenceNone},
+		tokens.TokenDecimal:           {decimal, nil, PrecedenceNone},
+		tokens.TokenAbstract:          {nil, nil, PrecedenceNone},
+		tokens.TokenAnd:               {nil, and_, PrecedenceAnd},
+		tokens.TokenAsync:             {asyncLambda, nil, PrecedenceNone},
+		tokens.TokenAwait:             {await, nil, PrecedenceNone},
+		tokens.TokenClass:             {nil, nil, PrecedenceNone},
+		tokens.TokenConst:             {nil, nil, PrecedenceNone},
+		tokens.TokenEnum:              {nil, nil, PrecedenceNone},
+		tokens.TokenElse:              {nil, nil, PrecedenceNone},
+		tokens.TokenFalse:             {literal, nil, PrecedenceNone},
+		tokens.TokenFor:               {nil, nil, PrecedenceNone},
+		tokens.TokenFun:               {lambda, nil, PrecedenceNone},
+		tokens.TokenIf:                {nil, nil, PrecedenceNone},
+		tokens.TokenMatch:             {matchExpression, nil, PrecedenceNone},
+		tokens.TokenNil:               {literal, nil, PrecedenceNone},
+		tokens.TokenOr:                {nil, or_, PrecedenceOr},
+		tokens.TokenPrint:             {nil, nil, PrecedenceNone},
+		tokens.TokenReturn:            {nil, nil, PrecedenceNone},
+		tokens.TokenSuper:             {super, nil, PrecedenceNone},
+		tokens.TokenThis:              {this, nil, PrecedenceNone},
+		tokens.TokenTrait:             {nil, nil, PrecedenceNone},
+		tokens.TokenYield:             {yield, nil, PrecedenceNone},
+		tokens.TokenTrue:              {literal, nil, PrecedenceNone},
+		tokens.TokenVar:               {nil, nil, PrecedenceNone},
+		tokens.TokenWhile:             {nil, nil, PrecedenceNone},
+		tokens.TokenError:             {nil, nil, PrecedenceNone},
+		tokens.TokenEOF:               {nil, nil, PrecedenceNone},
 	}
 }
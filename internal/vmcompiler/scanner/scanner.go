@@ -3,18 +3,22 @@ package scanner
 import "github.com/leonardinius/goloxvm/internal/vmcompiler/tokens"
 
 type Scanner struct {
-	source  []byte
-	start   int
-	current int
-	line    int
+	source    []byte
+	start     int
+	current   int
+	line      int
+	lineStart int // offset of the current line, for the token column
+	column    int
 }
 
 func NewScanner(source []byte) Scanner {
 	return Scanner{
-		source:  source,
-		start:   0,
-		current: 0,
-		line:    1,
+		source:    source,
+		start:     0,
+		current:   0,
+		line:      1,
+		lineStart: 0,
+		column:    1,
 	}
 }
 
@@ -26,6 +30,7 @@ func (s *Scanner) ScanToken() Token {
 	s.skipWhitespace()
 
 	s.start = s.current
+	s.column = s.start - s.lineStart + 1
 	if s.isAtEnd() {
 		return s.makeToken(tokens.TokenEOF)
 	}
@@ -47,20 +52,62 @@ func (s *Scanner) ScanToken() Token {
 		return s.makeToken(tokens.TokenLeftBrace)
 	case '}':
 		return s.makeToken(tokens.TokenRightBrace)
+	case '[':
+		return s.makeToken(tokens.TokenLeftBracket)
+	case ']':
+		return s.makeToken(tokens.TokenRightBracket)
+	case ':':
+		return s.makeToken(tokens.TokenColon)
 	case ';':
 		return s.makeToken(tokens.TokenSemicolon)
 	case ',':
 		return s.makeToken(tokens.TokenComma)
 	case '.':
+		if s.peek() == '.' && s.peekNext() == '.' {
+			s.advance()
+			s.advance()
+			return s.makeToken(tokens.TokenEllipsis)
+		}
 		return s.makeToken(tokens.TokenDot)
 	case '-':
+		if s.match('-') {
+			return s.makeToken(tokens.TokenMinusMinus)
+		}
+		if s.match('=') {
+			return s.makeToken(tokens.TokenMinusEqual)
+		}
 		return s.makeToken(tokens.TokenMinus)
 	case '+':
+		if s.match('+') {
+			return s.makeToken(tokens.TokenPlusPlus)
+		}
+		if s.match('=') {
+			return s.makeToken(tokens.TokenPlusEqual)
+		}
 		return s.makeToken(tokens.TokenPlus)
 	case '/':
+		if s.match('=') {
+			return s.makeToken(tokens.TokenSlashEqual)
+		}
 		return s.makeToken(tokens.TokenSlash)
 	case '*':
+		if s.match('=') {
+			return s.makeToken(tokens.TokenStarEqual)
+		}
 		return s.makeToken(tokens.TokenStar)
+	case '%':
+		if s.match('=') {
+			return s.makeToken(tokens.TokenPercentEqual)
+		}
+		return s.makeToken(tokens.TokenPercent)
+	case '&':
+		return s.makeToken(tokens.TokenAmpersand)
+	case '|':
+		return s.makeToken(tokens.TokenPipe)
+	case '^':
+		return s.makeToken(tokens.TokenCaret)
+	case '~':
+		return s.makeToken(tokens.TokenTilde)
 	case '!':
 		if s.match('=') {
 			return s.makeToken(tokens.TokenBangEqual)
@@ -70,17 +117,42 @@ func (s *Scanner) ScanToken() Token {
 		if s.match('=') {
 			return s.makeToken(tokens.TokenEqualEqual)
 		}
+		if s.match('>') {
+			return s.makeToken(tokens.TokenArrow)
+		}
 		return s.makeToken(tokens.TokenEqual)
 	case '<':
 		if s.match('=') {
 			return s.makeToken(tokens.TokenLessEqual)
 		}
+		if s.match('<') {
+			return s.makeToken(tokens.TokenLessLess)
+		}
 		return s.makeToken(tokens.TokenLess)
 	case '>':
 		if s.match('=') {
 			return s.makeToken(tokens.TokenGreaterEqual)
 		}
+		if s.match('>') {
+			return s.makeToken(tokens.TokenGreaterGreater)
+		}
 		return s.makeToken(tokens.TokenGreater)
+	case '?':
+		if s.match('?') {
+			return s.makeToken(tokens.TokenQuestionQuestion)
+		}
+		if s.match('.') {
+			return s.makeToken(tokens.TokenQuestionDot)
+		}
+		return s.makeToken(tokens.TokenQuestion)
+	case '#':
+		// private member name `#name`
+		if s.isAlpha(s.peek()) {
+			for s.isAlpha(s.peek()) || s.isDigit(s.peek()) {
+				s.advance()
+			}
+			return s.makeToken(tokens.TokenPrivateIdentifier)
+		}
 	case '"':
 		return s.string()
 	}
@@ -134,6 +206,7 @@ func (s *Scanner) skipWhitespace() {
 		case '\n':
 			s.line++
 			s.advance()
+			s.lineStart = s.current
 		case '/':
 			if s.peekNext() == '/' {
 				for !s.isAtEnd() && s.peek() != '\n' {
@@ -153,6 +226,7 @@ func (s *Scanner) string() Token {
 	for !s.isAtEnd() && s.peek() != '"' {
 		if s.peek() == '\n' {
 			s.line++
+			s.lineStart = s.current + 1
 		}
 		s.advance()
 	}
@@ -179,6 +253,8 @@ func (s *Scanner) number() Token {
 		s.advance()
 	}
 
+	tokenType := tokens.TokenInteger
+
 	// Look for a fractional part.
 	if s.peek() == '.' && s.isDigit(s.peekNext()) {
 		// Consume the "."
@@ -186,9 +262,22 @@ func (s *Scanner) number() Token {
 		for s.isDigit(s.peek()) {
 			s.advance()
 		}
+		tokenType = tokens.TokenNumber
+	}
+
+	// Big number suffixes: 123n, 1.10d.
+	if suffix := s.peek(); !s.isAlpha(s.peekNext()) && !s.isDigit(s.peekNext()) {
+		if suffix == 'n' && tokenType == tokens.TokenInteger {
+			s.advance()
+			return s.makeToken(tokens.TokenBigInt)
+		}
+		if suffix == 'd' {
+			s.advance()
+			return s.makeToken(tokens.TokenDecimal)
+		}
 	}
 
-	return s.makeToken(tokens.TokenNumber)
+	return s.makeToken(tokenType)
 }
 
 func (s *Scanner) isAlpha(c byte) bool {
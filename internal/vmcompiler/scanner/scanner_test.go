@@ -36,3 +36,17 @@ func TestScanner(t *testing.T) {
 		})
 	}
 }
+
+func TestScannerColumn(t *testing.T) {
+	t.Parallel()
+	s := scanner.NewScanner([]byte("var x = 1;\n  print \"a\nb\" + x;"))
+	columns := []string{}
+	for token := s.ScanToken(); token.Type != tokens.TokenEOF; token = s.ScanToken() {
+		columns = append(columns, fmt.Sprintf("%d:%d %s", token.Line, token.Column, token.LexemeAsString()))
+	}
+
+	assert.Equal(t, []string{
+		"1:1 var", "1:5 x", "1:7 =", "1:9 1", "1:10 ;",
+		"2:3 print", "2:9 \"a\nb\"", "3:4 +", "3:6 x", "3:7 ;",
+	}, columns)
+}
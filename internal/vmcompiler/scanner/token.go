@@ -8,6 +8,7 @@ type Token struct {
 	Start  int
 	Length int
 	Line   int
+	Column int
 }
 
 func MakeToken(scanner *Scanner, token tokens.TokenType) Token {
@@ -17,6 +18,7 @@ func MakeToken(scanner *Scanner, token tokens.TokenType) Token {
 		Start:  scanner.start,
 		Length: scanner.current - scanner.start,
 		Line:   scanner.line,
+		Column: scanner.column,
 	}
 }
 
@@ -28,6 +30,7 @@ func MakeErrorToken(scanner *Scanner, message string) Token {
 		Start:  0,
 		Length: len(bytes),
 		Line:   scanner.line,
+		Column: scanner.column,
 	}
 }
 
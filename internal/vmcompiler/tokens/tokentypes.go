@@ -9,28 +9,54 @@ const (
 	TokenRightParen
 	TokenLeftBrace
 	TokenRightBrace
+	TokenLeftBracket
+	TokenRightBracket
+	TokenColon
 	TokenComma
 	TokenDot
+	TokenEllipsis
 	TokenMinus
 	TokenPlus
 	TokenSemicolon
 	TokenSlash
 	TokenStar
+	TokenPercent
+	TokenAmpersand
+	TokenPipe
+	TokenCaret
+	TokenTilde
+	TokenQuestion
 
 	// One or two character tokens.
 	TokenBang
 	TokenBangEqual
 	TokenEqual
 	TokenEqualEqual
+	TokenArrow
 	TokenGreater
 	TokenGreaterEqual
 	TokenLess
 	TokenLessEqual
+	TokenLessLess
+	TokenGreaterGreater
+	TokenQuestionQuestion
+	TokenQuestionDot
+	TokenPlusEqual
+	TokenMinusEqual
+	TokenStarEqual
+	TokenSlashEqual
+	TokenPercentEqual
+	TokenPlusPlus
+	TokenMinusMinus
 
 	// Literals.
 	TokenIdentifier
+	TokenPrivateIdentifier
 	TokenString
 	TokenNumber
+	TokenInteger
+	TokenBigInt
+	TokenDecimal
 
 	// Keywords.
 	TokenAnd
@@ -50,52 +76,98 @@ const (
 	TokenVar
 	TokenWhile
 
+	// Contextual keywords, scanned as identifiers and promoted by the parser where used as keywords.
+	TokenAbstract
+	TokenAsync
+	TokenAwait
+	TokenConst
+	TokenEnum
+	TokenIs
+	TokenMatch
+	TokenTrait
+	TokenYield
+
 	// Special control tokens.
 	TokenError
 	TokenEOF
 )
 
 var gTokenTypeStrings = map[TokenType]string{
-	TokenLeftParen:    "TOKEN_LEFT_PAREN",
-	TokenRightParen:   "TOKEN_RIGHT_PAREN",
-	TokenLeftBrace:    "TOKEN_LEFT_BRACE",
-	TokenRightBrace:   "TOKEN_RIGHT_BRACE",
-	TokenComma:        "TOKEN_COMMA",
-	TokenDot:          "TOKEN_DOT",
-	TokenMinus:        "TOKEN_MINUS",
-	TokenPlus:         "TOKEN_PLUS",
-	TokenSemicolon:    "TOKEN_SEMICOLON",
-	TokenSlash:        "TOKEN_SLASH",
-	TokenStar:         "TOKEN_STAR",
-	TokenBang:         "TOKEN_BANG",
-	TokenBangEqual:    "TOKEN_BANG_EQUAL",
-	TokenEqual:        "TOKEN_EQUAL",
-	TokenEqualEqual:   "TOKEN_EQUAL_EQUAL",
-	TokenGreater:      "TOKEN_GREATER",
-	TokenGreaterEqual: "TOKEN_GREATER_EQUAL",
-	TokenLess:         "TOKEN_LESS",
-	TokenLessEqual:    "TOKEN_LESS_EQUAL",
-	TokenIdentifier:   "TOKEN_IDENTIFIER",
-	TokenString:       "TOKEN_STRING",
-	TokenNumber:       "TOKEN_NUMBER",
-	TokenAnd:          "TOKEN_AND",
-	TokenClass:        "TOKEN_CLASS",
-	TokenElse:         "TOKEN_ELSE",
-	TokenFalse:        "TOKEN_FALSE",
-	TokenFor:          "TOKEN_FOR",
-	TokenFun:          "TOKEN_FUN",
-	TokenIf:           "TOKEN_IF",
-	TokenNil:          "TOKEN_NIL",
-	TokenOr:           "TOKEN_OR",
-	TokenPrint:        "TOKEN_PRINT",
-	TokenReturn:       "TOKEN_RETURN",
-	TokenSuper:        "TOKEN_SUPER",
-	TokenThis:         "TOKEN_THIS",
-	TokenTrue:         "TOKEN_TRUE",
-	TokenVar:          "TOKEN_VAR",
-	TokenWhile:        "TOKEN_WHILE",
-	TokenError:        "TOKEN_ERROR",
-	TokenEOF:          "TOKEN_EOF",
+	TokenLeftParen:         "TOKEN_LEFT_PAREN",
+	TokenRightParen:        "TOKEN_RIGHT_PAREN",
+	TokenLeftBrace:         "TOKEN_LEFT_BRACE",
+	TokenRightBrace:        "TOKEN_RIGHT_BRACE",
+	TokenLeftBracket:       "TOKEN_LEFT_BRACKET",
+	TokenRightBracket:      "TOKEN_RIGHT_BRACKET",
+	TokenColon:             "TOKEN_COLON",
+	TokenComma:             "TOKEN_COMMA",
+	TokenDot:               "TOKEN_DOT",
+	TokenEllipsis:          "TOKEN_ELLIPSIS",
+	TokenMinus:             "TOKEN_MINUS",
+	TokenPlus:              "TOKEN_PLUS",
+	TokenSemicolon:         "TOKEN_SEMICOLON",
+	TokenSlash:             "TOKEN_SLASH",
+	TokenStar:              "TOKEN_STAR",
+	TokenPercent:           "TOKEN_PERCENT",
+	TokenAmpersand:         "TOKEN_AMPERSAND",
+	TokenPipe:              "TOKEN_PIPE",
+	TokenCaret:             "TOKEN_CARET",
+	TokenTilde:             "TOKEN_TILDE",
+	TokenQuestion:          "TOKEN_QUESTION",
+	TokenBang:              "TOKEN_BANG",
+	TokenBangEqual:         "TOKEN_BANG_EQUAL",
+	TokenEqual:             "TOKEN_EQUAL",
+	TokenEqualEqual:        "TOKEN_EQUAL_EQUAL",
+	TokenArrow:             "TOKEN_ARROW",
+	TokenGreater:           "TOKEN_GREATER",
+	TokenGreaterEqual:      "TOKEN_GREATER_EQUAL",
+	TokenLess:              "TOKEN_LESS",
+	TokenLessEqual:         "TOKEN_LESS_EQUAL",
+	TokenLessLess:          "TOKEN_LESS_LESS",
+	TokenGreaterGreater:    "TOKEN_GREATER_GREATER",
+	TokenQuestionQuestion:  "TOKEN_QUESTION_QUESTION",
+	TokenQuestionDot:       "TOKEN_QUESTION_DOT",
+	TokenPlusEqual:         "TOKEN_PLUS_EQUAL",
+	TokenMinusEqual:        "TOKEN_MINUS_EQUAL",
+	TokenStarEqual:         "TOKEN_STAR_EQUAL",
+	TokenSlashEqual:        "TOKEN_SLASH_EQUAL",
+	TokenPercentEqual:      "TOKEN_PERCENT_EQUAL",
+	TokenPlusPlus:          "TOKEN_PLUS_PLUS",
+	TokenMinusMinus:        "TOKEN_MINUS_MINUS",
+	TokenIdentifier:        "TOKEN_IDENTIFIER",
+	TokenPrivateIdentifier: "TOKEN_PRIVATE_IDENTIFIER",
+	TokenString:            "TOKEN_STRING",
+	TokenNumber:            "TOKEN_NUMBER",
+	TokenInteger:           "TOKEN_INTEGER",
+	TokenBigInt:            "TOKEN_BIGINT",
+	TokenDecimal:           "TOKEN_DECIMAL",
+	TokenAbstract:          "TOKEN_ABSTRACT",
+	TokenAnd:               "TOKEN_AND",
+	TokenAsync:             "TOKEN_ASYNC",
+	TokenAwait:             "TOKEN_AWAIT",
+	TokenClass:             "TOKEN_CLASS",
+	TokenConst:             "TOKEN_CONST",
+	TokenElse:              "TOKEN_ELSE",
+	TokenEnum:              "TOKEN_ENUM",
+	TokenFalse:             "TOKEN_FALSE",
+	TokenFor:               "TOKEN_FOR",
+	TokenFun:               "TOKEN_FUN",
+	TokenIf:                "TOKEN_IF",
+	TokenIs:                "TOKEN_IS",
+	TokenMatch:             "TOKEN_MATCH",
+	TokenNil:               "TOKEN_NIL",
+	TokenOr:                "TOKEN_OR",
+	TokenPrint:             "TOKEN_PRINT",
+	TokenReturn:            "TOKEN_RETURN",
+	TokenSuper:             "TOKEN_SUPER",
+	TokenThis:              "TOKEN_THIS",
+	TokenTrait:             "TOKEN_TRAIT",
+	TokenTrue:              "TOKEN_TRUE",
+	TokenVar:               "TOKEN_VAR",
+	TokenWhile:             "TOKEN_WHILE",
+	TokenYield:             "TOKEN_YIELD",
+	TokenError:             "TOKEN_ERROR",
+	TokenEOF:               "TOKEN_EOF",
 }
 
 func (t TokenType) String() string {
@@ -0,0 +1,314 @@
+package vmcompiler
+
+import (
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/leonardinius/goloxvm/internal/vmcompiler/scanner"
+	"github.com/leonardinius/goloxvm/internal/vmcompiler/tokens"
+)
+
+// staticType is the type of the value known at compile time, it is inferred from the literals,
+// the operators and the type annotations. The type errors are reported by `check` only,
+// the annotations are ignored at runtime. The zero value is `Any`, which matches any type.
+type staticType struct {
+	name     string
+	fn       *signature // the function with the known parameters
+	instance string     // the class, calling it creates the instance of this type
+	float    bool       // the number known to be the float, the big numbers don't mix with it
+}
+
+// signature is the function type declared by the parameter and return type annotations.
+type signature struct {
+	params   []staticType
+	minArity int
+	arity    int
+	variadic bool
+	result   staticType
+}
+
+// typedExpr is the type of the parsed expression and its first token, where the type errors are reported.
+type typedExpr struct {
+	t     staticType
+	token scanner.Token
+}
+
+var (
+	typeAny      = staticType{}
+	typeNumber   = staticType{name: "Number"}
+	typeFloat    = staticType{name: "Number", float: true}
+	typeBigInt   = staticType{name: "BigInt"}
+	typeDecimal  = staticType{name: "Decimal"}
+	typeString   = staticType{name: "String"}
+	typeBool     = staticType{name: "Bool"}
+	typeNil      = staticType{name: "Nil"}
+	typeList     = staticType{name: "List"}
+	typeMap      = staticType{name: "Map"}
+	typeFunction = staticType{name: "Function"}
+	typeClass    = staticType{name: "Class"}
+
+	// builtinTypes are the types of the values, which are not the class instances
+	builtinTypes = []string{"Number", "BigInt", "Decimal", "String", "Bool", "Nil", "List", "Map", "Function", "Class"}
+)
+
+func (t staticType) String() string {
+	if t.name == "" {
+		return "Any"
+	}
+	return t.name
+}
+
+func (t staticType) isAny() bool {
+	return t.name == ""
+}
+
+// isBuiltin reports the known type of the value which can't overload the operators.
+func (t staticType) isBuiltin() bool {
+	return slices.Contains(builtinTypes, t.name)
+}
+
+func (t staticType) isNumber() bool {
+	return t.name == typeNumber.name
+}
+
+// isNumeric reports the number and the big number types.
+func (t staticType) isNumeric() bool {
+	return t.isNumber() || t == typeBigInt || t == typeDecimal
+}
+
+// numericResult is the type of the arithmetic on the numeric operands. The big numbers mix with
+// the integers only, so mixing them with the number which is not the float is known at runtime.
+func numericResult(operator *scanner.Token, left, right staticType) staticType {
+	switch {
+	case left.isNumber() && right.isNumber():
+		if left.float || right.float {
+			return typeFloat
+		}
+		return typeNumber
+	case left == right:
+		return left
+	case left.float || right.float:
+		typeErrorAt(operator, "Can't mix big numbers and floats, convert explicitly.")
+		return typeAny
+	case left.isNumber() || right.isNumber():
+		return typeAny
+	default: // the big integer and the decimal
+		return typeDecimal
+	}
+}
+
+func functionType(sig signature) staticType {
+	return staticType{name: typeFunction.name, fn: &sig}
+}
+
+func classType(className *scanner.Token) staticType {
+	return staticType{name: typeClass.name, instance: className.LexemeAsString()}
+}
+
+// isAssignable reports if the value of the type can be stored in the variable of the declared type.
+// The nil is allowed everywhere, the class instance matches its superclasses and traits.
+func isAssignable(declared, value staticType) bool {
+	if declared.isAny() || value.isAny() || value.name == typeNil.name || declared.name == value.name {
+		return true
+	}
+	return isSubclass(value.name, declared.name, map[string]bool{})
+}
+
+// addClassParent records the superclass or the trait of the class, for the instance type matching.
+func addClassParent(class, parent *scanner.Token) {
+	name := class.LexemeAsString()
+	gClassParents[name] = append(gClassParents[name], parent.LexemeAsString())
+}
+
+func isSubclass(class, parent string, seen map[string]bool) bool {
+	if seen[class] {
+		return false
+	}
+	seen[class] = true
+	for _, name := range gClassParents[class] {
+		if name == parent || isSubclass(name, parent, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// typeAnnotation parses the optional `: Type` annotation, the type is either `nil` or the name.
+func typeAnnotation() staticType {
+	if !match(tokens.TokenColon) {
+		return typeAny
+	}
+	if match(tokens.TokenNil) {
+		return typeNil
+	}
+	consume(tokens.TokenIdentifier, "Expect type name.")
+	if name := gParser.previous.LexemeAsString(); name != "Any" {
+		return staticType{name: name}
+	}
+	return typeAny
+}
+
+// setExprType sets the type of the expression parsed by the current parse rule,
+// the expressions without the type set are `Any`.
+func setExprType(t staticType) {
+	gExprType = &t
+}
+
+// exprType returns the type of the parsed expression, depth 0 is the latest one.
+func exprType(depth int) typedExpr {
+	if i := len(gTypes) - 1 - depth; i >= 0 {
+		return gTypes[i]
+	}
+	return typedExpr{t: typeAny, token: gParser.previous}
+}
+
+// resolveExprType replaces the types above base with the type of the expression started by the token.
+func resolveExprType(base int, token scanner.Token) {
+	t := typeAny
+	if gExprType != nil {
+		t = *gExprType
+		gExprType = nil
+	}
+	gTypes = append(gTypes[:base], typedExpr{t: t, token: token})
+}
+
+// declareType sets the type of the variable just declared.
+func declareType(name *scanner.Token, t staticType) {
+	if gCurrent.ScoreDepth > 0 {
+		gCurrent.Locals[gCurrent.LocalCount-1].Type = t
+		return
+	}
+	gGlobalTypes[name.LexemeAsString()] = t
+}
+
+// variableType looks up the type of the local, the upvalue or the global variable declared in the compiled source.
+func variableType(name *scanner.Token) staticType {
+	for compiler := gCurrent; compiler != nil; compiler = compiler.Enclosing {
+		for i := compiler.LocalCount - 1; i >= 0; i-- {
+			if local := &compiler.Locals[i]; identifierEquals(name, &local.Name) {
+				return local.Type
+			}
+		}
+	}
+	return gGlobalTypes[name.LexemeAsString()]
+}
+
+// checkAssignType reports the value of the latest expression, which does not match the declared type.
+func checkAssignType(name *scanner.Token, declared staticType) {
+	if value := exprType(0); !isAssignable(declared, value.t) {
+		typeErrorAt(&value.token, fmt.Sprintf("Can't assign %s to '%s' of type %s.",
+			value.t, name.LexemeAsString(), declared))
+	}
+}
+
+// checkReturnType reports the returned value, which does not match the return type annotation.
+func checkReturnType() {
+	declared := gCurrent.Signature.result
+	if value := exprType(0); !isAssignable(declared, value.t) {
+		typeErrorAt(&value.token, fmt.Sprintf("Return value must be %s but got %s.", declared, value.t))
+	}
+}
+
+// checkCall reports the wrong arguments of the function with the known signature
+// and returns the type of the call result.
+func checkCall(callee typedExpr, args []typedExpr) staticType {
+	if callee.t.instance != "" {
+		return staticType{name: callee.t.instance}
+	}
+	sig := callee.t.fn
+	if sig == nil {
+		return typeAny
+	}
+
+	argCount := len(args)
+	switch {
+	case sig.variadic && argCount < sig.minArity:
+		typeErrorAt(&callee.token, fmt.Sprintf("Expected at least %d arguments but got %d.", sig.minArity, argCount))
+	case !sig.variadic && sig.minArity != sig.arity && (argCount < sig.minArity || argCount > sig.arity):
+		typeErrorAt(&callee.token, fmt.Sprintf("Expected %d to %d arguments but got %d.", sig.minArity, sig.arity, argCount))
+	case !sig.variadic && sig.minArity == sig.arity && argCount != sig.arity:
+		typeErrorAt(&callee.token, fmt.Sprintf("Expected %d arguments but got %d.", sig.arity, argCount))
+	}
+
+	for i, arg := range args {
+		if i < len(sig.params) && !isAssignable(sig.params[i], arg.t) {
+			typeErrorAt(&arg.token, fmt.Sprintf("Argument %d must be %s but got %s.", i+1, sig.params[i], arg.t))
+		}
+	}
+	return sig.result
+}
+
+// binaryType checks the operand types of the binary operator and returns the type of its result.
+func binaryType(operator *scanner.Token, left, right staticType) staticType {
+	switch operator.Type {
+	case tokens.TokenEqualEqual, tokens.TokenBangEqual, tokens.TokenIs:
+		return typeBool
+	case tokens.TokenPlus:
+		if !left.isBuiltin() || !right.isBuiltin() {
+			// the instance can overload the operator or concatenate the string
+			return typeAny
+		}
+		if left == typeString && right == typeString {
+			return left
+		}
+		if left.isNumeric() && right.isNumeric() {
+			return numericResult(operator, left, right)
+		}
+		typeErrorAt(operator, fmt.Sprintf("Operands must be two numbers or two strings but got %s and %s.", left, right))
+		return typeAny
+	case tokens.TokenGreater, tokens.TokenGreaterEqual, tokens.TokenLess, tokens.TokenLessEqual:
+		checkNumberOperands(operator, left, right, true)
+		return typeBool
+	case tokens.TokenAmpersand, tokens.TokenPipe, tokens.TokenCaret, tokens.TokenLessLess, tokens.TokenGreaterGreater:
+		if checkNumberOperands(operator, left, right, false) {
+			return typeNumber
+		}
+		return typeAny
+	default:
+		if checkNumberOperands(operator, left, right, true) {
+			return numericResult(operator, left, right)
+		}
+		return typeAny
+	}
+}
+
+// checkNumberOperands reports the known operand types, which are not numbers, the big numbers
+// are the numbers unless the operator is bitwise. The left instance operand can overload the operator.
+func checkNumberOperands(operator *scanner.Token, left, right staticType, big bool) bool {
+	if !left.isBuiltin() || right.isAny() {
+		return false
+	}
+	isNumber := func(t staticType) bool {
+		return t.isNumber() || (big && t.isNumeric())
+	}
+	if !isNumber(left) || (!isNumber(right) && right.isBuiltin()) {
+		typeErrorAt(operator, fmt.Sprintf("Operands must be numbers but got %s and %s.", left, right))
+		return false
+	}
+	return isNumber(right)
+}
+
+// unaryType checks the operand type of the unary operator and returns the type of its result.
+func unaryType(operator *scanner.Token, operand staticType) staticType {
+	if operator.Type == tokens.TokenBang {
+		return typeBool
+	}
+	if !operand.isBuiltin() {
+		return typeAny
+	}
+	if !operand.isNumber() && (operator.Type == tokens.TokenTilde || !operand.isNumeric()) {
+		typeErrorAt(operator, fmt.Sprintf("Operand must be a number but got %s.", operand))
+		return typeAny
+	}
+	return operand
+}
+
+// typeErrorAt reports the type error found by `check`, unless the source has the syntax errors.
+func typeErrorAt(token *scanner.Token, message string) {
+	if !gChecking || gParser.hadError {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "[line %d:%d] Type error at '%s': %s\n", token.Line, token.Column, token.LexemeAsString(), message)
+	gParser.hadTypeError = true
+}
@@ -39,9 +39,13 @@ const (
 var (
 	expectedOutputPattern       = regexp.MustCompile(`// expect: ?(.*)`)
 	expectedErrorPattern        = regexp.MustCompile(`// (Error.*)`)
+	expectedWarningPattern      = regexp.MustCompile(`// (Warning.*)`)
+	expectedTypeErrorPattern    = regexp.MustCompile(`// (Type error.*)`)
 	errorLinePattern            = regexp.MustCompile(`// \[((java|c|go) )?line (\d+)\] (Error.*)`)
 	expectedRuntimeErrorPattern = regexp.MustCompile(`// expect runtime error: (.+)`)
 	syntaxErrorPattern          = regexp.MustCompile(`\[.*line (\d+)\] (Error.+)`)
+	warningPattern              = regexp.MustCompile(`\[.*line (\d+)\] (Warning.+)`)
+	typeErrorPattern            = regexp.MustCompile(`\[line (\d+):\d+\] (Type error.+)`)
 	stackTracePattern           = regexp.MustCompile(`\[line (\d+)\]`)
 	nonTestPattern              = regexp.MustCompile(`// nontest`)
 )
@@ -131,7 +135,7 @@ func (r *Runner) runTest(suite *Suite, path string) {
 		return
 	}
 
-	test := &Test{path: path, suite: suite, expectedErrors: make(map[string]string)}
+	test := &Test{path: path, suite: suite, expectedErrors: make(map[string]string), expectedWarnings: make(map[string]string)}
 
 	r.t.Run(suite.name+"/"+path, func(t *testing.T) {
 		test.t = t
@@ -164,6 +168,7 @@ type Test struct {
 	suite                *Suite
 	expectedOutput       []ExpectedOutput
 	expectedErrors       map[string]string
+	expectedWarnings     map[string]string
 	expectedRuntimeError string
 	runtimeErrorLine     int
 	expectedExitCode     int
@@ -217,6 +222,21 @@ func (t *Test) parse() (state string, ok bool) {
 			continue
 		}
 
+		match = expectedWarningPattern.FindStringSubmatch(line)
+		if match != nil {
+			msg := fmt.Sprintf("[line %d] %s", lineNum, match[1])
+			t.expectedWarnings[msg] = msg
+			continue
+		}
+
+		match = expectedTypeErrorPattern.FindStringSubmatch(line)
+		if match != nil {
+			msg := fmt.Sprintf("[line %d] %s", lineNum, match[1])
+			t.expectedErrors[msg] = msg
+			t.expectedExitCode = 65
+			continue
+		}
+
 		match = errorLinePattern.FindStringSubmatch(line)
 		if match != nil {
 			language := match[2]
@@ -366,7 +386,18 @@ func (t *Test) validateCompileErrors(errorLines []string) {
 	unexpectedCount := 0
 
 	for _, line := range errorLines {
+		if match := warningPattern.FindStringSubmatch(line); match != nil {
+			warningMsg := fmt.Sprintf("[line %s] %s", match[1], match[2])
+			if _, ok := t.expectedWarnings[warningMsg]; ok {
+				foundErrors[warningMsg] = true
+				continue
+			}
+		}
+
 		match := syntaxErrorPattern.FindStringSubmatch(line)
+		if match == nil {
+			match = typeErrorPattern.FindStringSubmatch(line)
+		}
 		if match != nil {
 			errorMsg := fmt.Sprintf("[line %s] %s", match[1], match[2])
 			if _, ok := t.expectedErrors[errorMsg]; ok {
@@ -394,6 +425,12 @@ func (t *Test) validateCompileErrors(errorLines []string) {
 			t.Errorf("Missing expected error: %s", errorMsg)
 		}
 	}
+
+	for warningMsg := range t.expectedWarnings {
+		if _, ok := foundErrors[warningMsg]; !ok {
+			t.Errorf("Missing expected warning: %s", warningMsg)
+		}
+	}
 }
 
 func (t *Test) validateExitCode(exitCode int, errorLines []string) {
@@ -451,6 +488,7 @@ func (t *Test) Expectations() int {
 	}
 
 	expectactions += len(t.expectedErrors)
+	expectactions += len(t.expectedWarnings)
 	expectactions += len(t.expectedOutput)
 
 	return expectactions
@@ -471,7 +509,7 @@ func (r *Runner) InitSuites() {
 		r.t.Fatalf("go build failed with %v: %s\n", err, out)
 	}
 
-	golox := func(name string, tests ...map[string]string) {
+	golox := func(name string, args []string, tests ...map[string]string) {
 		suiteTests := map[string]string{}
 		for _, test := range tests {
 			maps.Copy(suiteTests, test)
@@ -482,7 +520,7 @@ func (r *Runner) InitSuites() {
 			mainFn:      mainFn,
 			executable:  bin,
 			testsGroups: suiteTests,
-			args:        []string{},
+			args:        args,
 		}
 		r.goSuites = append(r.goSuites, name)
 	}
@@ -498,9 +536,19 @@ func (r *Runner) InitSuites() {
 		// "testdata/field/set_on_class.lox": "skip",
 	}
 
-	golox("golox-vm",
+	// The type checking tests run by `check` only.
+	typeCheck := map[string]string{
+		"testdata/typecheck": "skip",
+	}
+
+	golox("golox-vm", []string{},
 		map[string]string{"testdata": "pass"},
 		earlyChapters,
 		goloxClassAttributesAccessErrors,
+		typeCheck,
+	)
+
+	golox("golox-vm-check", []string{"check"},
+		map[string]string{"testdata": "skip", "testdata/typecheck": "pass"},
 	)
 }